@@ -0,0 +1,112 @@
+package analysis
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+)
+
+const (
+	// PosteriorDraws is how many draws from the posterior each Bayesian estimate is summarised from
+	PosteriorDraws = 20000
+	// DefaultROPE is the default half-width of the region of practical equivalence around no effect, in standard
+	// deviations, half of what is conventionally a small effect
+	DefaultROPE = 0.1
+)
+
+// Decisions reached by comparing the credible interval of the effect size with the region of practical equivalence
+const (
+	DecisionDifferent  = "different"
+	DecisionEquivalent = "equivalent"
+	DecisionUndecided  = "undecided"
+)
+
+// BayesEstimate is the posterior of the treatment mean minus the reference mean. Each condition's ratings are
+// modelled as normal with their own mean and standard deviation under the noninformative prior p(μ, σ) ∝ 1/σ, so
+// the posterior follows from the data alone. Credible intervals are highest density intervals. The effect size is
+// the difference over the root mean of both variances and is what the region of practical equivalence applies to.
+type BayesEstimate struct {
+	Difference          float64 `json:"difference"`
+	DifferenceLow       float64 `json:"difference_low"`
+	DifferenceHigh      float64 `json:"difference_high"`
+	Effect              float64 `json:"effect"`
+	EffectLow           float64 `json:"effect_low"`
+	EffectHigh          float64 `json:"effect_high"`
+	ProbabilityPositive float64 `json:"probability_positive"`
+	ProbabilityInROPE   float64 `json:"probability_in_rope"`
+	Decision            string  `json:"decision"`
+}
+
+// EstimateDifference draws from the posterior of the difference in means. The effect is different from zero when its
+// credible interval lies entirely outside ±rope, practically equivalent to zero when it lies entirely inside, and
+// undecided otherwise. It returns nil when either group has fewer than two values or neither varies.
+func EstimateDifference(reference []float64, treatment []float64, rope float64, rng *rand.Rand) *BayesEstimate {
+	if len(reference) < 2 || len(treatment) < 2 {
+		return nil
+	}
+	if variance(reference) == 0 && variance(treatment) == 0 {
+		return nil
+	}
+	// draw samples a condition's mean and variance from their joint posterior: the variance from a scaled inverse
+	// chi-squared distribution, then the mean from a normal distribution given that variance
+	draw := func(values []float64) (float64, float64) {
+		n := float64(len(values))
+		chiSquared := 2 * gammaDraw(rng, (n-1)/2)
+		v := (n - 1) * variance(values) / chiSquared
+		return mean(values) + rng.NormFloat64()*math.Sqrt(v/n), v
+	}
+	differences := make([]float64, PosteriorDraws)
+	effects := make([]float64, PosteriorDraws)
+	e := &BayesEstimate{}
+	for i := range differences {
+		meanA, varianceA := draw(reference)
+		meanB, varianceB := draw(treatment)
+		differences[i] = meanB - meanA
+		effects[i] = differences[i] / math.Sqrt((varianceA+varianceB)/2)
+		if differences[i] > 0 {
+			e.ProbabilityPositive++
+		}
+		if math.Abs(effects[i]) <= rope {
+			e.ProbabilityInROPE++
+		}
+	}
+	e.ProbabilityPositive /= PosteriorDraws
+	e.ProbabilityInROPE /= PosteriorDraws
+	e.Difference, e.Effect = mean(differences), mean(effects)
+	e.DifferenceLow, e.DifferenceHigh = highestDensity(differences)
+	e.EffectLow, e.EffectHigh = highestDensity(effects)
+	switch {
+	case e.EffectLow > rope || e.EffectHigh < -rope:
+		e.Decision = DecisionDifferent
+	case e.EffectLow >= -rope && e.EffectHigh <= rope:
+		e.Decision = DecisionEquivalent
+	default:
+		e.Decision = DecisionUndecided
+	}
+	return e
+}
+
+// highestDensity is the narrowest interval holding the report's confidence level of the draws, which it sorts
+func highestDensity(draws []float64) (float64, float64) {
+	sort.Float64s(draws)
+	width := int(math.Floor(Confidence * float64(len(draws))))
+	if width >= len(draws) {
+		return draws[0], draws[len(draws)-1]
+	}
+	low := 0
+	for i := 1; i+width < len(draws); i++ {
+		if draws[i+width]-draws[i] < draws[low+width]-draws[low] {
+			low = i
+		}
+	}
+	return draws[low], draws[low+width]
+}
+
+// EstimateBayes adds Bayesian estimates with a region of practical equivalence of ±rope to every comparison in the
+// report
+func (r *Report) EstimateBayes(seed int64, rope float64) {
+	r.Seed, r.Draws, r.ROPE = &seed, PosteriorDraws, rope
+	for _, c := range r.comparisons() {
+		c.Bayes = EstimateDifference(c.samples[0], c.samples[1], rope, rand.New(rand.NewSource(seed)))
+	}
+}
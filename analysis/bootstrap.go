@@ -0,0 +1,106 @@
+package analysis
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// Resamples is how many bootstrap samples each interval is computed from
+const Resamples = 5000
+
+// BootstrapCI holds bootstrap intervals for the treatment mean minus the reference mean, resampling each condition
+// separately. The percentile interval takes the bootstrap distribution as it is, BCa corrects it for bias and for
+// the standard error changing with the difference, which matters for skewed ratings in small samples.
+type BootstrapCI struct {
+	Difference     float64 `json:"difference"`
+	SE             float64 `json:"se"`
+	PercentileLow  float64 `json:"percentile_low"`
+	PercentileHigh float64 `json:"percentile_high"`
+	BCaLow         float64 `json:"bca_low"`
+	BCaHigh        float64 `json:"bca_high"`
+	Bias           float64 `json:"bias"`
+	Acceleration   float64 `json:"acceleration"`
+}
+
+// BootstrapDifference bootstraps the difference of means, returning nil when either group has fewer than two values
+// or the resamples never differ
+func BootstrapDifference(reference []float64, treatment []float64, rng *rand.Rand) *BootstrapCI {
+	if len(reference) < 2 || len(treatment) < 2 {
+		return nil
+	}
+	b := &BootstrapCI{Difference: mean(treatment) - mean(reference)}
+	resample := func(values []float64) float64 {
+		sum := 0.0
+		for range values {
+			sum += values[rng.Intn(len(values))]
+		}
+		return sum / float64(len(values))
+	}
+	differences := make([]float64, Resamples)
+	below := 0.0
+	for i := range differences {
+		differences[i] = resample(treatment) - resample(reference)
+		switch {
+		case differences[i] < b.Difference:
+			below++
+		case differences[i] == b.Difference:
+			below += 0.5
+		}
+	}
+	sort.Float64s(differences)
+	if differences[0] == differences[Resamples-1] {
+		return nil
+	}
+	b.SE = math.Sqrt(variance(differences))
+	tail := (1 - Confidence) / 2
+	b.PercentileLow, b.PercentileHigh = quantile(differences, tail), quantile(differences, 1-tail)
+
+	// Bias is the median bias of the bootstrap distribution on the normal scale, kept finite when every resample
+	// falls on one side
+	share := math.Min(math.Max(below/Resamples, 0.5/Resamples), 1-0.5/Resamples)
+	b.Bias = normalQuantile(share)
+	// Acceleration comes from each condition's jackknife influence values, weighted by its size
+	skew, spread := 0.0, 0.0
+	for g, values := range [2][]float64{reference, treatment} {
+		sign := float64(2*g - 1)
+		n := float64(len(values))
+		m := mean(values)
+		for _, v := range values {
+			// A rating pulls the difference towards its own condition's side by how far it lies from that mean
+			influence := sign * (v - m)
+			skew += influence * influence * influence / (n * n * n)
+			spread += influence * influence / (n * n)
+		}
+	}
+	if spread > 0 {
+		b.Acceleration = skew / (6 * math.Pow(spread, 1.5))
+	}
+	adjusted := func(p float64) float64 {
+		z := b.Bias + normalQuantile(p)
+		return normalCDF(b.Bias + z/(1-b.Acceleration*z))
+	}
+	b.BCaLow, b.BCaHigh = quantile(differences, adjusted(tail)), quantile(differences, adjusted(1-tail))
+	return b
+}
+
+// quantile interpolates linearly between the order statistics of sorted values
+func quantile(sorted []float64, p float64) float64 {
+	position := p * float64(len(sorted)-1)
+	i := int(math.Floor(position))
+	if i >= len(sorted)-1 {
+		return sorted[len(sorted)-1]
+	}
+	if i < 0 {
+		return sorted[0]
+	}
+	return sorted[i] + (position-float64(i))*(sorted[i+1]-sorted[i])
+}
+
+// Bootstrap adds bootstrap intervals to every comparison in the report
+func (r *Report) Bootstrap(seed int64) {
+	r.Seed, r.Resamples = &seed, Resamples
+	for _, c := range r.comparisons() {
+		c.Bootstrap = BootstrapDifference(c.samples[0], c.samples[1], rand.New(rand.NewSource(seed)))
+	}
+}
@@ -0,0 +1,83 @@
+package analysis
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Correction is a way of adjusting p-values for testing many articles at once
+type Correction string
+
+const (
+	// CorrectionHolm controls the family-wise error rate with Holm's step-down procedure
+	CorrectionHolm Correction = "holm"
+	// CorrectionBonferroni controls the family-wise error rate by multiplying with the number of tests
+	CorrectionBonferroni Correction = "bonferroni"
+	// CorrectionBH controls the false discovery rate with the Benjamini–Hochberg procedure
+	CorrectionBH Correction = "bh"
+	// CorrectionNone leaves p-values as they are
+	CorrectionNone Correction = "none"
+)
+
+// Corrections lists every correction in the order they are offered
+var Corrections = []Correction{CorrectionHolm, CorrectionBonferroni, CorrectionBH, CorrectionNone}
+
+// ParseCorrection accepts a correction name, defaulting to Holm when empty
+func ParseCorrection(s string) (Correction, error) {
+	if s == "" {
+		return CorrectionHolm, nil
+	}
+	for _, c := range Corrections {
+		if string(c) == s {
+			return c, nil
+		}
+	}
+	return "", fmt.Errorf("unknown correction `%s`", s)
+}
+
+// Name describes the correction for people
+func (c Correction) Name() string {
+	switch c {
+	case CorrectionHolm:
+		return "Holm"
+	case CorrectionBonferroni:
+		return "Bonferroni"
+	case CorrectionBH:
+		return "Benjamini–Hochberg"
+	}
+	return "None"
+}
+
+// Adjust returns the corrected p-values in the order they were given
+func (c Correction) Adjust(p []float64) []float64 {
+	m := float64(len(p))
+	adjusted := make([]float64, len(p))
+	order := make([]int, len(p))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool { return p[order[i]] < p[order[j]] })
+	switch c {
+	case CorrectionHolm:
+		running := 0.0
+		for rank, i := range order {
+			running = math.Max(running, (m-float64(rank))*p[i])
+			adjusted[i] = math.Min(running, 1)
+		}
+	case CorrectionBonferroni:
+		for i, v := range p {
+			adjusted[i] = math.Min(m*v, 1)
+		}
+	case CorrectionBH:
+		running := 1.0
+		for rank := len(order) - 1; rank >= 0; rank-- {
+			i := order[rank]
+			running = math.Min(running, m/float64(rank+1)*p[i])
+			adjusted[i] = running
+		}
+	default:
+		copy(adjusted, p)
+	}
+	return adjusted
+}
@@ -0,0 +1,51 @@
+package analysis
+
+import "testing"
+
+func TestCorrectionAdjust(t *testing.T) {
+	p := []float64{0.01, 0.04, 0.03, 0.005}
+	tests := []struct {
+		correction Correction
+		p          []float64
+		want       []float64
+	}{
+		{CorrectionHolm, p, []float64{0.03, 0.06, 0.06, 0.02}},
+		{CorrectionBonferroni, p, []float64{0.04, 0.16, 0.12, 0.02}},
+		{CorrectionBH, p, []float64{0.02, 0.04, 0.04, 0.02}},
+		{CorrectionNone, p, p},
+		{CorrectionHolm, []float64{0.5, 0.6}, []float64{1, 1}},
+		{CorrectionBH, []float64{0.5, 0.6}, []float64{0.6, 0.6}},
+		{CorrectionHolm, nil, []float64{}},
+	}
+	for _, tt := range tests {
+		got := tt.correction.Adjust(tt.p)
+		if len(got) != len(tt.want) {
+			t.Fatalf("%s.Adjust(%v) = %v, want %v", tt.correction, tt.p, got, tt.want)
+		}
+		for i := range got {
+			approx(t, string(tt.correction), got[i], tt.want[i], 1e-12)
+		}
+	}
+}
+
+func TestParseCorrection(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    Correction
+		wantErr bool
+	}{
+		{"", CorrectionHolm, false},
+		{"holm", CorrectionHolm, false},
+		{"bonferroni", CorrectionBonferroni, false},
+		{"bh", CorrectionBH, false},
+		{"none", CorrectionNone, false},
+		{"Holm", "", true},
+		{"fdr", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ParseCorrection(tt.s)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseCorrection(%q) = %q, %v, want %q", tt.s, got, err, tt.want)
+		}
+	}
+}
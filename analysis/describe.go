@@ -0,0 +1,58 @@
+package analysis
+
+import (
+	"math"
+	"sort"
+)
+
+// Descriptives summarises the ratings of one condition. SD is zero below two ratings, Mean and Median below one.
+type Descriptives struct {
+	Condition string  `json:"condition"`
+	N         int     `json:"n"`
+	Mean      float64 `json:"mean"`
+	SD        float64 `json:"sd"`
+	Median    float64 `json:"median"`
+}
+
+// Describe computes the descriptives of a sample
+func Describe(condition string, values []float64) Descriptives {
+	d := Descriptives{Condition: condition, N: len(values)}
+	if d.N == 0 {
+		return d
+	}
+	d.Mean = mean(values)
+	d.SD = math.Sqrt(variance(values))
+	d.Median = median(values)
+	return d
+}
+
+func mean(values []float64) float64 {
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+// variance is the unbiased sample variance, zero for fewer than two values
+func variance(values []float64) float64 {
+	if len(values) < 2 {
+		return 0
+	}
+	m := mean(values)
+	sum := 0.0
+	for _, v := range values {
+		sum += (v - m) * (v - m)
+	}
+	return sum / float64(len(values)-1)
+}
+
+func median(values []float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
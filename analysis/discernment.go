@@ -0,0 +1,110 @@
+package analysis
+
+import "github.com/superc03/carp/models"
+
+// Discernment is how well a participant tells true headlines from false ones. A rating above the middle of the scale
+// counts as believing a headline, so believing a true one is a hit and believing a false one a false alarm. Rates
+// use the log-linear correction, which keeps d′ finite for participants who believed all or none of either kind.
+type Discernment struct {
+	Pseudonym      string  `json:"pseudonym"`
+	Condition      string  `json:"condition"`
+	TrueRatings    int     `json:"true_ratings"`
+	FalseRatings   int     `json:"false_ratings"`
+	TrueMean       float64 `json:"true_mean"`
+	FalseMean      float64 `json:"false_mean"`
+	Discernment    float64 `json:"discernment"`
+	HitRate        float64 `json:"hit_rate"`
+	FalseAlarmRate float64 `json:"false_alarm_rate"`
+	DPrime         float64 `json:"d_prime"`
+	Criterion      float64 `json:"criterion"`
+
+	surveyType int
+}
+
+// HasVeracity reports whether the dataset has both true and false articles, without which discernment is undefined
+func HasVeracity(d *models.Dataset) bool {
+	hasTrue, hasFalse := false, false
+	for _, a := range d.Articles {
+		hasTrue = hasTrue || a.Veracity == models.VeracityTrue
+		hasFalse = hasFalse || a.Veracity == models.VeracityFalse
+	}
+	return hasTrue && hasFalse
+}
+
+// Discernments measures every participant who rated at least one true and one false article, keyed by pseudonym
+func Discernments(d *models.Dataset) map[string]Discernment {
+	midpoint := float64(d.Study.Scale.Min+d.Study.Scale.Max) / 2
+	measures := map[string]Discernment{}
+	for _, u := range d.Participants {
+		var trueRatings, falseRatings []float64
+		hits, falseAlarms := 0.0, 0.0
+		for _, a := range d.Articles {
+			v, ok := u.Rating(a.ID.Hex())
+			if !ok {
+				continue
+			}
+			switch a.Veracity {
+			case models.VeracityTrue:
+				trueRatings = append(trueRatings, float64(v))
+				if float64(v) > midpoint {
+					hits++
+				}
+			case models.VeracityFalse:
+				falseRatings = append(falseRatings, float64(v))
+				if float64(v) > midpoint {
+					falseAlarms++
+				}
+			}
+		}
+		if len(trueRatings) == 0 || len(falseRatings) == 0 {
+			continue
+		}
+		m := Discernment{
+			Pseudonym:    u.Pseudonym,
+			Condition:    models.ConditionCode(u.SurveyType),
+			TrueRatings:  len(trueRatings),
+			FalseRatings: len(falseRatings),
+			TrueMean:     mean(trueRatings),
+			FalseMean:    mean(falseRatings),
+			surveyType:   u.SurveyType,
+		}
+		m.Discernment = m.TrueMean - m.FalseMean
+		m.HitRate = (hits + 0.5) / (float64(m.TrueRatings) + 1)
+		m.FalseAlarmRate = (falseAlarms + 0.5) / (float64(m.FalseRatings) + 1)
+		zHit, zFalseAlarm := normalQuantile(m.HitRate), normalQuantile(m.FalseAlarmRate)
+		m.DPrime = zHit - zFalseAlarm
+		m.Criterion = (-zHit - zFalseAlarm) / 2
+		measures[u.Pseudonym] = m
+	}
+	return measures
+}
+
+// compareDiscernment compares the discernment measures of both conditions
+func (r *Report) compareDiscernment(d *models.Dataset) {
+	measures := Discernments(d)
+	rows := []struct {
+		title string
+		value func(Discernment) float64
+	}{
+		{"Discernment (true minus false)", func(m Discernment) float64 { return m.Discernment }},
+		{"Mean rating of true headlines", func(m Discernment) float64 { return m.TrueMean }},
+		{"Mean rating of false headlines", func(m Discernment) float64 { return m.FalseMean }},
+		{"Sensitivity d′", func(m Discernment) float64 { return m.DPrime }},
+		{"Criterion c", func(m Discernment) float64 { return m.Criterion }},
+	}
+	for _, row := range rows {
+		groups := [2][]float64{}
+		for _, u := range d.Participants {
+			m, ok := measures[u.Pseudonym]
+			if !ok {
+				continue
+			}
+			if group := r.group(m.surveyType); group >= 0 {
+				groups[group] = append(groups[group], row.value(m))
+			}
+		}
+		c := r.compare(groups)
+		c.Title = row.title
+		r.Discernment = append(r.Discernment, c)
+	}
+}
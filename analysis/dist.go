@@ -0,0 +1,115 @@
+package analysis
+
+import (
+	"math"
+	"math/rand"
+)
+
+// normalCDF is the cumulative distribution function of the standard normal distribution
+func normalCDF(x float64) float64 {
+	return 0.5 * math.Erfc(-x/math.Sqrt2)
+}
+
+// normalQuantile is the inverse of normalCDF
+func normalQuantile(p float64) float64 {
+	return -math.Sqrt2 * math.Erfcinv(2*p)
+}
+
+// studentCDF is the cumulative distribution function of Student's t distribution with df degrees of freedom
+func studentCDF(t float64, df float64) float64 {
+	tail := 0.5 * incompleteBeta(df/(df+t*t), df/2, 0.5)
+	if t < 0 {
+		return tail
+	}
+	return 1 - tail
+}
+
+// studentQuantile inverts studentCDF by bisection, which is plenty fast for the handful of quantiles a report needs
+func studentQuantile(p float64, df float64) float64 {
+	lo, hi := -1.0, 1.0
+	for studentCDF(lo, df) > p {
+		lo *= 2
+	}
+	for studentCDF(hi, df) < p {
+		hi *= 2
+	}
+	for i := 0; i < 200 && hi-lo > 1e-12; i++ {
+		mid := (lo + hi) / 2
+		if studentCDF(mid, df) < p {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return (lo + hi) / 2
+}
+
+// incompleteBeta is the regularized incomplete beta function I_x(a, b)
+func incompleteBeta(x float64, a float64, b float64) float64 {
+	if x <= 0 {
+		return 0
+	}
+	if x >= 1 {
+		return 1
+	}
+	la, _ := math.Lgamma(a)
+	lb, _ := math.Lgamma(b)
+	lab, _ := math.Lgamma(a + b)
+	front := math.Exp(a*math.Log(x) + b*math.Log1p(-x) - la - lb + lab)
+	// The continued fraction converges quickly only on one side of the mean, use the symmetry relation on the other
+	if x < (a+1)/(a+b+2) {
+		return front * betaFraction(x, a, b) / a
+	}
+	return 1 - front*betaFraction(1-x, b, a)/b
+}
+
+// betaFraction evaluates the continued fraction of the incomplete beta function with the modified Lentz method
+func betaFraction(x float64, a float64, b float64) float64 {
+	const tiny = 1e-300
+	clamp := func(v float64) float64 {
+		if math.Abs(v) < tiny {
+			return tiny
+		}
+		return v
+	}
+	c := 1.0
+	d := 1 / clamp(1-(a+b)*x/(a+1))
+	f := d
+	for m := 1.0; m <= 500; m++ {
+		num := m * (b - m) * x / ((a + 2*m - 1) * (a + 2*m))
+		d = 1 / clamp(1+num*d)
+		c = clamp(1 + num/c)
+		f *= d * c
+		num = -(a + m) * (a + b + m) * x / ((a + 2*m) * (a + 2*m + 1))
+		d = 1 / clamp(1+num*d)
+		c = clamp(1 + num/c)
+		delta := d * c
+		f *= delta
+		if math.Abs(delta-1) < 1e-15 {
+			break
+		}
+	}
+	return f
+}
+
+// gammaDraw draws from the gamma distribution with the given shape and unit scale by Marsaglia and Tsang's method,
+// boosting shapes below one
+func gammaDraw(rng *rand.Rand, shape float64) float64 {
+	if shape < 1 {
+		return gammaDraw(rng, shape+1) * math.Pow(1-rng.Float64(), 1/shape)
+	}
+	d := shape - 1.0/3
+	c := 1 / math.Sqrt(9*d)
+	for {
+		x := rng.NormFloat64()
+		v := 1 + c*x
+		if v <= 0 {
+			continue
+		}
+		v = v * v * v
+		u := rng.Float64()
+		if math.Log(u) < x*x/2+d-d*v+d*math.Log(v) {
+			return d * v
+		}
+	}
+}
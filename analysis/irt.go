@@ -0,0 +1,364 @@
+package analysis
+
+import (
+	"errors"
+	"math"
+	"time"
+
+	"github.com/superc03/carp/models"
+)
+
+// Settings of the graded response model fit
+const (
+	// quadraturePoints spaced evenly over ±quadratureRange approximate the standard normal latent distribution
+	quadraturePoints = 41
+	quadratureRange  = 5.0
+	// emCycles bounds the EM algorithm, which stops early once no parameter moves more than emTolerance
+	emCycles    = 500
+	emTolerance = 1e-4
+)
+
+// InformationTheta are the latent trait values item and test information are reported at
+var InformationTheta = []float64{-3, -2.5, -2, -1.5, -1, -0.5, 0, 0.5, 1, 1.5, 2, 2.5, 3}
+
+// ErrTooFewRatings is returned when there is not enough data to calibrate the articles
+var ErrTooFewRatings = errors.New("the graded response model needs at least two articles and two participants who rated them")
+
+// GradedResponse is Samejima's graded response model fitted to every article's ratings. The latent trait is how much
+// a participant believes headlines in general, standardized to a mean of zero and a standard deviation of one.
+type GradedResponse struct {
+	Study           *models.Study  `json:"study"`
+	Filter          string         `json:"filter,omitempty"`
+	GeneratedOn     time.Time      `json:"generated_on"`
+	Ratings         int            `json:"ratings"`
+	LogLikelihood   float64        `json:"log_likelihood"`
+	Cycles          int            `json:"cycles"`
+	Converged       bool           `json:"converged"`
+	Theta           []float64      `json:"theta"`
+	TestInformation []float64      `json:"test_information"`
+	Items           []ItemResponse `json:"items"`
+	Scores          []LatentScore  `json:"scores"`
+}
+
+// ItemResponse holds an article's parameters. Rating above the k-th point of the scale has probability one half for
+// participants whose latent trait equals the k-th threshold, and discrimination is how steeply that probability rises.
+// Information is given at each of the model's Theta.
+type ItemResponse struct {
+	ArticleID      string          `json:"article_id"`
+	Title          string          `json:"title"`
+	Veracity       models.Veracity `json:"veracity,omitempty"`
+	Respondents    int             `json:"respondents"`
+	Discrimination float64         `json:"discrimination"`
+	Thresholds     []float64       `json:"thresholds"`
+	Location       float64         `json:"location"`
+	Information    []float64       `json:"information"`
+}
+
+// LatentScore is a participant's expected a posteriori latent trait and its posterior standard deviation
+type LatentScore struct {
+	Pseudonym string  `json:"pseudonym"`
+	Condition string  `json:"condition"`
+	Ratings   int     `json:"ratings"`
+	Theta     float64 `json:"theta"`
+	SE        float64 `json:"se"`
+}
+
+// Calibration returns the article's parameters in the form stored on articles
+func (i ItemResponse) Calibration(scale models.Scale, on time.Time) models.Calibration {
+	return models.Calibration{
+		Discrimination: i.Discrimination,
+		Thresholds:     append([]float64(nil), i.Thresholds...),
+		Location:       i.Location,
+		ScaleMin:       scale.Min,
+		ScaleMax:       scale.Max,
+		Respondents:    i.Respondents,
+		CalibratedOn:   on,
+	}
+}
+
+// FitGradedResponse calibrates the articles by marginal maximum likelihood with the EM algorithm, integrating the
+// latent trait over a fixed quadrature grid. Participants count with whatever ratings they gave. Weak priors, a
+// log-normal one on discriminations and a normal one with a standard deviation of three on thresholds, keep estimates
+// finite for points of the scale that nobody chose for an article.
+func FitGradedResponse(d *models.Dataset) (*GradedResponse, error) {
+	g := &GradedResponse{
+		Study:       d.Study,
+		Filter:      d.Filter.String(),
+		GeneratedOn: d.ExportedOn,
+		Theta:       InformationTheta,
+		Items:       make([]ItemResponse, len(d.Articles)),
+	}
+	categories := d.Study.Scale.Max - d.Study.Scale.Min + 1
+	// responses holds each participant's category per article, -1 where they did not rate it
+	var responses [][]int
+	var raters []models.User
+	for _, u := range d.Participants {
+		row := make([]int, len(d.Articles))
+		rated := 0
+		for i, a := range d.Articles {
+			row[i] = -1
+			if v, ok := u.Rating(a.ID.Hex()); ok && v >= d.Study.Scale.Min && v <= d.Study.Scale.Max {
+				row[i] = v - d.Study.Scale.Min
+				g.Items[i].Respondents++
+				rated++
+			}
+		}
+		if rated > 0 {
+			responses = append(responses, row)
+			raters = append(raters, u)
+			g.Ratings += rated
+		}
+	}
+	if len(d.Articles) < 2 || len(responses) < 2 || categories < 2 {
+		return nil, ErrTooFewRatings
+	}
+
+	nodes, weights := make([]float64, quadraturePoints), make([]float64, quadraturePoints)
+	total := 0.0
+	for q := range nodes {
+		nodes[q] = -quadratureRange + 2*quadratureRange*float64(q)/float64(quadraturePoints-1)
+		weights[q] = math.Exp(-nodes[q] * nodes[q] / 2)
+		total += weights[q]
+	}
+	for q := range weights {
+		weights[q] /= total
+	}
+
+	items := make([]grmItem, len(d.Articles))
+	for i := range items {
+		items[i] = startingValues(responses, i, categories)
+	}
+	posterior := make([][]float64, len(responses))
+	for g.Cycles = 1; g.Cycles <= emCycles; g.Cycles++ {
+		// E-step: each participant's posterior over the grid, summed into expected counts per item and category
+		g.LogLikelihood = expectation(responses, items, nodes, weights, posterior)
+		counts := make([][][]float64, len(items))
+		for i := range counts {
+			counts[i] = make([][]float64, categories)
+			for k := range counts[i] {
+				counts[i][k] = make([]float64, quadraturePoints)
+			}
+		}
+		for p, row := range responses {
+			for i, k := range row {
+				if k < 0 {
+					continue
+				}
+				for q, w := range posterior[p] {
+					counts[i][k][q] += w
+				}
+			}
+		}
+		// M-step: each item's parameters maximize its expected log-likelihood on its own
+		change := 0.0
+		for i := range items {
+			next := items[i].maximize(counts[i], nodes)
+			change = math.Max(change, next.distance(items[i]))
+			items[i] = next
+		}
+		if change < emTolerance {
+			g.Converged = true
+			break
+		}
+	}
+	if g.Cycles > emCycles {
+		g.Cycles = emCycles
+	}
+	g.LogLikelihood = expectation(responses, items, nodes, weights, posterior)
+
+	g.TestInformation = make([]float64, len(g.Theta))
+	for i, a := range d.Articles {
+		it := &g.Items[i]
+		it.ArticleID, it.Title, it.Veracity = a.ID.Hex(), a.Title, a.Veracity
+		it.Discrimination = items[i].discrimination
+		it.Thresholds = items[i].thresholds
+		for _, b := range it.Thresholds {
+			it.Location += b / float64(len(it.Thresholds))
+		}
+		it.Information = make([]float64, len(g.Theta))
+		for t, theta := range g.Theta {
+			it.Information[t] = items[i].information(theta)
+			g.TestInformation[t] += it.Information[t]
+		}
+	}
+	g.Scores = make([]LatentScore, len(raters))
+	for p, u := range raters {
+		s := LatentScore{Pseudonym: u.Pseudonym, Condition: models.ConditionCode(u.SurveyType)}
+		for _, k := range responses[p] {
+			if k >= 0 {
+				s.Ratings++
+			}
+		}
+		for q, w := range posterior[p] {
+			s.Theta += w * nodes[q]
+		}
+		for q, w := range posterior[p] {
+			s.SE += w * (nodes[q] - s.Theta) * (nodes[q] - s.Theta)
+		}
+		s.SE = math.Sqrt(s.SE)
+		g.Scores[p] = s
+	}
+	return g, nil
+}
+
+// grmItem holds one item's parameters while the model is fitted
+type grmItem struct {
+	discrimination float64
+	thresholds     []float64
+}
+
+// startingValues places thresholds where a participant of average trait would cross them if discrimination were one
+func startingValues(responses [][]int, item int, categories int) grmItem {
+	atLeast := make([]float64, categories)
+	n := 0.0
+	for _, row := range responses {
+		if k := row[item]; k >= 0 {
+			n++
+			for c := 0; c <= k; c++ {
+				atLeast[c]++
+			}
+		}
+	}
+	it := grmItem{discrimination: 1, thresholds: make([]float64, categories-1)}
+	for k := range it.thresholds {
+		share := (atLeast[k+1] + 0.5) / (n + 1)
+		it.thresholds[k] = math.Log((1 - share) / share)
+		if k > 0 && it.thresholds[k] < it.thresholds[k-1]+0.1 {
+			it.thresholds[k] = it.thresholds[k-1] + 0.1
+		}
+	}
+	return it
+}
+
+// probabilities are the chances of rating in each category at theta
+func (it grmItem) probabilities(theta float64) []float64 {
+	p := make([]float64, len(it.thresholds)+1)
+	above := 1.0
+	for k, b := range it.thresholds {
+		next := 1 / (1 + math.Exp(-it.discrimination*(theta-b)))
+		p[k] = above - next
+		above = next
+	}
+	p[len(it.thresholds)] = above
+	return p
+}
+
+// information is the Fisher information the item carries about theta
+func (it grmItem) information(theta float64) float64 {
+	star := make([]float64, len(it.thresholds)+2)
+	star[0] = 1
+	for k, b := range it.thresholds {
+		star[k+1] = 1 / (1 + math.Exp(-it.discrimination*(theta-b)))
+	}
+	info := 0.0
+	for k := 0; k <= len(it.thresholds); k++ {
+		p := star[k] - star[k+1]
+		if p <= 0 {
+			continue
+		}
+		slope := star[k]*(1-star[k]) - star[k+1]*(1-star[k+1])
+		info += slope * slope / p
+	}
+	return it.discrimination * it.discrimination * info
+}
+
+// maximize finds the parameters that maximize the item's expected log-likelihood plus priors, given expected counts
+// per category and quadrature node. Thresholds are kept ordered by optimizing the gaps between them on a log scale.
+func (it grmItem) maximize(counts [][]float64, nodes []float64) grmItem {
+	unpack := func(x []float64) grmItem {
+		next := grmItem{discrimination: math.Exp(x[0]), thresholds: make([]float64, len(x)-1)}
+		next.thresholds[0] = x[1]
+		for k := 2; k < len(x); k++ {
+			next.thresholds[k-1] = next.thresholds[k-2] + math.Exp(x[k])
+		}
+		return next
+	}
+	x0 := make([]float64, len(it.thresholds)+1)
+	x0[0] = math.Log(it.discrimination)
+	x0[1] = it.thresholds[0]
+	for k := 1; k < len(it.thresholds); k++ {
+		x0[k+1] = math.Log(math.Max(it.thresholds[k]-it.thresholds[k-1], 1e-6))
+	}
+	x, _, _, _ := minimize(func(x []float64) float64 {
+		candidate := unpack(x)
+		penalty := x[0] * x[0] / 2
+		for _, b := range candidate.thresholds {
+			penalty += b * b / 18
+		}
+		ll := 0.0
+		for q, theta := range nodes {
+			p := candidate.probabilities(theta)
+			for k, c := range counts {
+				if c[q] > 0 {
+					ll += c[q] * math.Log(math.Max(p[k], 1e-300))
+				}
+			}
+		}
+		return penalty - ll
+	}, x0, 0.1, 1e-12, 400)
+	return unpack(x)
+}
+
+// distance is the largest difference between two sets of the same item's parameters
+func (it grmItem) distance(other grmItem) float64 {
+	d := math.Abs(it.discrimination - other.discrimination)
+	for k := range it.thresholds {
+		d = math.Max(d, math.Abs(it.thresholds[k]-other.thresholds[k]))
+	}
+	return d
+}
+
+// expectation fills in every participant's posterior weights over the quadrature nodes and returns the marginal
+// log-likelihood of all responses
+func expectation(responses [][]int, items []grmItem, nodes []float64, weights []float64, posterior [][]float64) float64 {
+	// probabilities[i][q][k] is the chance of category k of item i at node q
+	probabilities := make([][][]float64, len(items))
+	for i, it := range items {
+		probabilities[i] = make([][]float64, len(nodes))
+		for q, theta := range nodes {
+			probabilities[i][q] = it.probabilities(theta)
+		}
+	}
+	ll := 0.0
+	for p, row := range responses {
+		// Work with logs relative to the largest term so long response patterns do not underflow
+		logs := make([]float64, len(nodes))
+		largest := math.Inf(-1)
+		for q := range nodes {
+			logs[q] = math.Log(weights[q])
+			for i, k := range row {
+				if k >= 0 {
+					logs[q] += math.Log(math.Max(probabilities[i][q][k], 1e-300))
+				}
+			}
+			largest = math.Max(largest, logs[q])
+		}
+		w := make([]float64, len(nodes))
+		sum := 0.0
+		for q := range nodes {
+			w[q] = math.Exp(logs[q] - largest)
+			sum += w[q]
+		}
+		for q := range w {
+			w[q] /= sum
+		}
+		posterior[p] = w
+		ll += largest + math.Log(sum)
+	}
+	return ll
+}
+
+// ScoreDescriptives describes the latent scores of each of the study's conditions
+func (g *GradedResponse) ScoreDescriptives() []Descriptives {
+	descriptives := make([]Descriptives, len(g.Study.Conditions))
+	for i, c := range g.Study.Conditions {
+		var thetas []float64
+		for _, s := range g.Scores {
+			if s.Condition == c.Code {
+				thetas = append(thetas, s.Theta)
+			}
+		}
+		descriptives[i] = Describe(c.Code, thetas)
+	}
+	return descriptives
+}
@@ -0,0 +1,140 @@
+package analysis
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestGradedResponseItem(t *testing.T) {
+	logistic := func(x float64) float64 { return 1 / (1 + math.Exp(-x)) }
+	tests := []struct {
+		name          string
+		item          grmItem
+		theta         float64
+		probabilities []float64
+		information   float64
+	}{
+		{
+			name:          "two categories at the threshold",
+			item:          grmItem{discrimination: 2, thresholds: []float64{0.5}},
+			theta:         0.5,
+			probabilities: []float64{0.5, 0.5},
+			information:   1,
+		},
+		{
+			name:          "two categories above the threshold",
+			item:          grmItem{discrimination: 1.5, thresholds: []float64{-1}},
+			theta:         0,
+			probabilities: []float64{1 - logistic(1.5), logistic(1.5)},
+			information:   1.5 * 1.5 * logistic(1.5) * (1 - logistic(1.5)),
+		},
+		{
+			name:          "three categories between the thresholds",
+			item:          grmItem{discrimination: 1, thresholds: []float64{-1, 1}},
+			theta:         0,
+			probabilities: []float64{1 - logistic(1), logistic(1) - logistic(-1), logistic(-1)},
+			information:   0.28746968091443026,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.item.probabilities(tt.theta)
+			if len(got) != len(tt.probabilities) {
+				t.Fatalf("probabilities = %v, want %v", got, tt.probabilities)
+			}
+			sum := 0.0
+			for k := range got {
+				approx(t, "probability", got[k], tt.probabilities[k], 1e-12)
+				sum += got[k]
+			}
+			approx(t, "total probability", sum, 1, 1e-12)
+			approx(t, "information", tt.item.information(tt.theta), tt.information, 1e-12)
+		})
+	}
+}
+
+// Ratings simulated from known parameters should be recovered, and participants who rate higher score higher
+func TestFitGradedResponse(t *testing.T) {
+	truth := []grmItem{
+		{discrimination: 1, thresholds: []float64{-2, -0.5, 0.5, 2}},
+		{discrimination: 1.5, thresholds: []float64{-1.5, -0.5, 0, 1}},
+		{discrimination: 2, thresholds: []float64{-1, 0, 1, 1.5}},
+		{discrimination: 1.2, thresholds: []float64{-0.5, 0.5, 1.5, 2.5}},
+	}
+	rng := rand.New(rand.NewSource(1))
+	rows := make([][]int, 1000)
+	for p := range rows {
+		theta := rng.NormFloat64()
+		rows[p] = make([]int, len(truth))
+		for i, it := range truth {
+			draw, category := rng.Float64(), 0
+			for cumulative := 0.0; category < len(it.thresholds); category++ {
+				cumulative += it.probabilities(theta)[category]
+				if draw < cumulative {
+					break
+				}
+			}
+			rows[p][i] = category + 1
+		}
+	}
+	d := testDataset(len(rows)/2, rows)
+	g, err := FitGradedResponse(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !g.Converged {
+		t.Errorf("did not converge in %d cycles", g.Cycles)
+	}
+	if g.Ratings != len(rows)*len(truth) || len(g.Scores) != len(rows) {
+		t.Errorf("counted %d ratings and %d scores, want %d and %d", g.Ratings, len(g.Scores), len(rows)*len(truth), len(rows))
+	}
+	for i, want := range truth {
+		got := g.Items[i]
+		approx(t, "discrimination", got.Discrimination, want.discrimination, 0.3)
+		for k := range want.thresholds {
+			approx(t, "threshold", got.Thresholds[k], want.thresholds[k], 0.3)
+		}
+		if got.Respondents != len(rows) {
+			t.Errorf("item %d has %d respondents, want %d", i, got.Respondents, len(rows))
+		}
+	}
+
+	lowest, highest := -1, -1
+	for p, row := range rows {
+		sum := 0
+		for _, v := range row {
+			sum += v
+		}
+		if sum == len(truth) && lowest < 0 {
+			lowest = p
+		}
+		if sum == 5*len(truth) && highest < 0 {
+			highest = p
+		}
+	}
+	if lowest < 0 || highest < 0 {
+		t.Fatal("no participant rated everything lowest or highest")
+	}
+	if g.Scores[lowest].Theta >= g.Scores[highest].Theta {
+		t.Errorf("lowest ratings score %g, not below highest ratings at %g", g.Scores[lowest].Theta, g.Scores[highest].Theta)
+	}
+}
+
+func TestFitGradedResponseTooFew(t *testing.T) {
+	tests := []struct {
+		name string
+		rows [][]int
+	}{
+		{"one article", [][]int{{1}, {2}, {3}}},
+		{"one participant", [][]int{{1, 2, 3}}},
+		{"no ratings", [][]int{{0, 0}, {0, 0}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := FitGradedResponse(testDataset(1, tt.rows)); err != ErrTooFewRatings {
+				t.Errorf("FitGradedResponse = %v, want ErrTooFewRatings", err)
+			}
+		})
+	}
+}
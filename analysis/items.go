@@ -0,0 +1,283 @@
+package analysis
+
+import (
+	"math"
+
+	"github.com/superc03/carp/models"
+)
+
+// Thresholds items are flagged at
+const (
+	// FloorCeilingShare is the share of ratings at the bottom or top of the scale above which an item is flagged
+	FloorCeilingShare = 0.15
+	// LowItemTotal is the corrected item–total correlation below which an item discriminates poorly
+	LowItemTotal = 0.2
+)
+
+// ItemAnalysis describes how the articles work together as a scale for one group of participants. Only participants
+// who rated every article are included, so every statistic is computed over the same people. Statistics that are
+// undefined for the data, such as correlations of items nobody disagreed on, are missing.
+type ItemAnalysis struct {
+	Condition     string      `json:"condition"`
+	CompleteCases int         `json:"complete_cases"`
+	Alpha         *float64    `json:"alpha"`
+	Omega         *float64    `json:"omega"`
+	Items         []ItemStats `json:"items"`
+}
+
+// ItemStats describes a single article's ratings
+type ItemStats struct {
+	ArticleID      string          `json:"article_id"`
+	Title          string          `json:"title"`
+	Veracity       models.Veracity `json:"veracity,omitempty"`
+	Mean           float64         `json:"mean"`
+	Variance       float64         `json:"variance"`
+	ItemTotal      *float64        `json:"item_total"`
+	AlphaIfDeleted *float64        `json:"alpha_if_deleted"`
+	Loading        *float64        `json:"loading"`
+	Floor          float64         `json:"floor"`
+	Ceiling        float64         `json:"ceiling"`
+	FloorFlag      bool            `json:"floor_flag"`
+	CeilingFlag    bool            `json:"ceiling_flag"`
+	LowItemTotal   bool            `json:"low_item_total"`
+}
+
+// AnalyzeItems runs the item analysis over all participants and then separately for each condition
+func AnalyzeItems(d *models.Dataset) []ItemAnalysis {
+	analyses := []ItemAnalysis{analyzeItems(d, "all", func(models.User) bool { return true })}
+	for _, c := range d.Study.Conditions {
+		surveyType := c.SurveyType
+		analyses = append(analyses, analyzeItems(d, c.Code, func(u models.User) bool { return u.SurveyType == surveyType }))
+	}
+	return analyses
+}
+
+func analyzeItems(d *models.Dataset, condition string, include func(models.User) bool) ItemAnalysis {
+	k := len(d.Articles)
+	// columns holds each article's ratings from participants who rated all of them
+	columns := make([][]float64, k)
+	for _, u := range d.Participants {
+		if !include(u) {
+			continue
+		}
+		row := make([]float64, 0, k)
+		for _, a := range d.Articles {
+			if v, ok := u.Rating(a.ID.Hex()); ok {
+				row = append(row, float64(v))
+			}
+		}
+		if len(row) < k || k == 0 {
+			continue
+		}
+		for i, v := range row {
+			columns[i] = append(columns[i], v)
+		}
+	}
+	ia := ItemAnalysis{Condition: condition, Items: make([]ItemStats, k)}
+	if k > 0 {
+		ia.CompleteCases = len(columns[0])
+	}
+	n := ia.CompleteCases
+	totals := make([]float64, n)
+	for _, col := range columns {
+		for p, v := range col {
+			totals[p] += v
+		}
+	}
+	ia.Alpha = alpha(columns, -1)
+	loadings := oneFactorLoadings(columns)
+	if loadings != nil {
+		sum, uniqueness := 0.0, 0.0
+		for _, l := range loadings {
+			sum += l
+			uniqueness += 1 - l*l
+		}
+		omega := sum * sum / (sum*sum + uniqueness)
+		ia.Omega = &omega
+	}
+
+	for i, a := range d.Articles {
+		s := ItemStats{ArticleID: a.ID.Hex(), Title: a.Title, Veracity: a.Veracity}
+		if n > 0 {
+			col := columns[i]
+			s.Mean = mean(col)
+			s.Variance = variance(col)
+			rest := make([]float64, n)
+			for p := range rest {
+				rest[p] = totals[p] - col[p]
+				if col[p] == float64(d.Study.Scale.Min) {
+					s.Floor++
+				}
+				if col[p] == float64(d.Study.Scale.Max) {
+					s.Ceiling++
+				}
+			}
+			s.Floor /= float64(n)
+			s.Ceiling /= float64(n)
+			s.FloorFlag = s.Floor > FloorCeilingShare
+			s.CeilingFlag = s.Ceiling > FloorCeilingShare
+			s.ItemTotal = correlation(col, rest)
+			s.LowItemTotal = s.ItemTotal != nil && *s.ItemTotal < LowItemTotal
+			s.AlphaIfDeleted = alpha(columns, i)
+		}
+		if loadings != nil {
+			s.Loading = &loadings[i]
+		}
+		ia.Items[i] = s
+	}
+	return ia
+}
+
+// alpha is Cronbach's alpha of the columns, leaving out the column at skip unless it is negative
+func alpha(columns [][]float64, skip int) *float64 {
+	kept := make([][]float64, 0, len(columns))
+	for i, col := range columns {
+		if i != skip {
+			kept = append(kept, col)
+		}
+	}
+	if len(kept) < 2 || len(kept[0]) < 2 {
+		return nil
+	}
+	totals := make([]float64, len(kept[0]))
+	itemVariance := 0.0
+	for _, col := range kept {
+		itemVariance += variance(col)
+		for p, v := range col {
+			totals[p] += v
+		}
+	}
+	totalVariance := variance(totals)
+	if totalVariance == 0 {
+		return nil
+	}
+	k := float64(len(kept))
+	a := k / (k - 1) * (1 - itemVariance/totalVariance)
+	return &a
+}
+
+// correlation is Pearson's correlation, missing when either variable is constant
+func correlation(x []float64, y []float64) *float64 {
+	if len(x) < 2 {
+		return nil
+	}
+	mx, my := mean(x), mean(y)
+	sxy, sxx, syy := 0.0, 0.0, 0.0
+	for i := range x {
+		sxy += (x[i] - mx) * (y[i] - my)
+		sxx += (x[i] - mx) * (x[i] - mx)
+		syy += (y[i] - my) * (y[i] - my)
+	}
+	if sxx == 0 || syy == 0 {
+		return nil
+	}
+	r := sxy / math.Sqrt(sxx*syy)
+	return &r
+}
+
+// oneFactorLoadings fits a single factor to the items' correlations by iterated principal axis factoring, returning
+// standardized loadings. It needs three items that all vary and returns nil otherwise.
+func oneFactorLoadings(columns [][]float64) []float64 {
+	k := len(columns)
+	if k < 3 || len(columns[0]) < 3 {
+		return nil
+	}
+	r := newMatrix(k)
+	for i := range columns {
+		for j := range columns {
+			if i == j {
+				r[i][j] = 1
+				continue
+			}
+			c := correlation(columns[i], columns[j])
+			if c == nil {
+				return nil
+			}
+			r[i][j] = *c
+		}
+	}
+	// Start from each item's largest correlation with another item as its communality
+	communality := make([]float64, k)
+	for i := range r {
+		for j := range r {
+			if i != j {
+				communality[i] = math.Max(communality[i], math.Abs(r[i][j]))
+			}
+		}
+	}
+	loadings := make([]float64, k)
+	for iteration := 0; iteration < 500; iteration++ {
+		for i := range r {
+			r[i][i] = communality[i]
+		}
+		value, vector := dominantEigen(r)
+		if value <= 0 {
+			return nil
+		}
+		change := 0.0
+		for i := range loadings {
+			loadings[i] = math.Sqrt(value) * vector[i]
+			// Keep communalities below one, the loading of an item explained entirely by the factor
+			next := math.Min(loadings[i]*loadings[i], 0.995)
+			change = math.Max(change, math.Abs(next-communality[i]))
+			communality[i] = next
+		}
+		if change < 1e-8 {
+			break
+		}
+	}
+	// The factor's sign is arbitrary, point it the way most items load
+	sum := 0.0
+	for _, l := range loadings {
+		sum += l
+	}
+	if sum < 0 {
+		for i := range loadings {
+			loadings[i] = -loadings[i]
+		}
+	}
+	return loadings
+}
+
+// dominantEigen finds the largest eigenvalue of a symmetric matrix and its unit eigenvector by power iteration. The
+// matrix is shifted so the largest eigenvalue is also the one of largest magnitude.
+func dominantEigen(m matrix) (float64, []float64) {
+	k := len(m)
+	shift := 0.0
+	for i := range m {
+		row := 0.0
+		for j := range m {
+			row += math.Abs(m[i][j])
+		}
+		shift = math.Max(shift, row)
+	}
+	v := make([]float64, k)
+	for i := range v {
+		v[i] = 1 / math.Sqrt(float64(k))
+	}
+	value := 0.0
+	for iteration := 0; iteration < 10000; iteration++ {
+		next := make([]float64, k)
+		for i := range m {
+			next[i] = shift * v[i]
+			for j := range m {
+				next[i] += m[i][j] * v[j]
+			}
+		}
+		norm := 0.0
+		for _, x := range next {
+			norm += x * x
+		}
+		norm = math.Sqrt(norm)
+		change := 0.0
+		for i := range next {
+			next[i] /= norm
+			change = math.Max(change, math.Abs(next[i]-v[i]))
+		}
+		v, value = next, norm-shift
+		if change < 1e-12 {
+			break
+		}
+	}
+	return value, v
+}
@@ -0,0 +1,82 @@
+package analysis
+
+import "math"
+
+// matrix is a dense square matrix stored row by row
+type matrix [][]float64
+
+func newMatrix(n int) matrix {
+	m := make(matrix, n)
+	for i := range m {
+		m[i] = make([]float64, n)
+	}
+	return m
+}
+
+// cholesky returns the lower triangular L with m = L Lᵀ, or false when m is not positive definite
+func cholesky(m matrix) (matrix, bool) {
+	n := len(m)
+	l := newMatrix(n)
+	for i := 0; i < n; i++ {
+		for j := 0; j <= i; j++ {
+			sum := m[i][j]
+			for k := 0; k < j; k++ {
+				sum -= l[i][k] * l[j][k]
+			}
+			if i == j {
+				if sum <= 0 || math.IsNaN(sum) {
+					return nil, false
+				}
+				l[i][i] = math.Sqrt(sum)
+			} else {
+				l[i][j] = sum / l[j][j]
+			}
+		}
+	}
+	return l, true
+}
+
+// logDet is the log determinant of L Lᵀ
+func (l matrix) logDet() float64 {
+	sum := 0.0
+	for i := range l {
+		sum += 2 * math.Log(l[i][i])
+	}
+	return sum
+}
+
+// solve solves L Lᵀ x = b
+func (l matrix) solve(b []float64) []float64 {
+	n := len(l)
+	x := make([]float64, n)
+	for i := 0; i < n; i++ {
+		sum := b[i]
+		for k := 0; k < i; k++ {
+			sum -= l[i][k] * x[k]
+		}
+		x[i] = sum / l[i][i]
+	}
+	for i := n - 1; i >= 0; i-- {
+		sum := x[i]
+		for k := i + 1; k < n; k++ {
+			sum -= l[k][i] * x[k]
+		}
+		x[i] = sum / l[i][i]
+	}
+	return x
+}
+
+// inverse returns (L Lᵀ)⁻¹
+func (l matrix) inverse() matrix {
+	n := len(l)
+	inv := newMatrix(n)
+	for j := 0; j < n; j++ {
+		e := make([]float64, n)
+		e[j] = 1
+		col := l.solve(e)
+		for i := range col {
+			inv[i][j] = col[i]
+		}
+	}
+	return inv
+}
@@ -0,0 +1,281 @@
+package analysis
+
+import (
+	"errors"
+	"math"
+
+	"github.com/superc03/carp/models"
+)
+
+// MixedModel is a linear mixed model of the ratings with a fixed effect of condition and crossed random intercepts
+// for participants and articles, fitted by restricted maximum likelihood
+type MixedModel struct {
+	Formula      string              `json:"formula"`
+	Observations int                 `json:"observations"`
+	Participants int                 `json:"participants"`
+	Articles     int                 `json:"articles"`
+	Fixed        []FixedEffect       `json:"fixed_effects"`
+	Variance     []VarianceComponent `json:"variance_components"`
+	REML         float64             `json:"reml_criterion"`
+	Iterations   int                 `json:"iterations"`
+	Converged    bool                `json:"converged"`
+}
+
+// FixedEffect is an estimated coefficient. Tests and intervals use the normal approximation.
+type FixedEffect struct {
+	Term     string  `json:"term"`
+	Estimate float64 `json:"estimate"`
+	SE       float64 `json:"se"`
+	Z        float64 `json:"z"`
+	P        float64 `json:"p"`
+	CILow    float64 `json:"ci_low"`
+	CIHigh   float64 `json:"ci_high"`
+}
+
+// VarianceComponent is the estimated variance of a random effect or of the residuals
+type VarianceComponent struct {
+	Group    string  `json:"group"`
+	Variance float64 `json:"variance"`
+	SD       float64 `json:"sd"`
+	// Share is the proportion of the total variance, the intraclass correlation for random intercepts
+	Share float64 `json:"share"`
+}
+
+// ErrTooFewObservations is returned when the ratings cannot identify every parameter of the mixed model
+var ErrTooFewObservations = errors.New("the mixed model needs ratings from both conditions, at least two participants and two articles, and more ratings than parameters")
+
+// FitMixedModel fits the mixed model to the ratings of both compared conditions and stores it on the report
+func (r *Report) FitMixedModel(d *models.Dataset) error {
+	m := &mixedData{}
+	participants := map[string]int{}
+	articles := map[string]int{}
+	ratings := Ratings(d)
+	for _, a := range d.Articles {
+		for _, rating := range ratings[a.ID.Hex()] {
+			group := r.group(rating.SurveyType)
+			if group < 0 {
+				continue
+			}
+			p, ok := participants[rating.Pseudonym]
+			if !ok {
+				p = len(participants)
+				participants[rating.Pseudonym] = p
+				m.treatment = append(m.treatment, float64(group))
+			}
+			j, ok := articles[a.ID.Hex()]
+			if !ok {
+				j = len(articles)
+				articles[a.ID.Hex()] = j
+			}
+			m.obs = append(m.obs, observation{participant: p, article: j, y: rating.Value})
+		}
+	}
+	m.participants, m.articles = len(participants), len(articles)
+	treated := 0.0
+	for _, t := range m.treatment {
+		treated += t
+	}
+	if m.participants < 2 || m.articles < 2 || treated == 0 || int(treated) == m.participants ||
+		len(m.obs) <= mixedFixed+2 {
+		return ErrTooFewObservations
+	}
+	m.prepare()
+
+	// The random effects' standard deviations relative to the residual one are found numerically, everything else
+	// follows from them
+	theta, reml, iterations, converged := minimize(func(theta []float64) float64 {
+		fit, ok := m.fit(theta[0], theta[1])
+		if !ok {
+			return math.Inf(1)
+		}
+		return fit.reml
+	}, []float64{1, 1}, 0.5, 1e-12, 2000)
+	fit, ok := m.fit(theta[0], theta[1])
+	if !ok {
+		return ErrTooFewObservations
+	}
+
+	sigma2 := fit.prss / float64(len(m.obs)-mixedFixed)
+	model := &MixedModel{
+		Formula:      d.Study.Dimension + " ~ condition + (1 | participant) + (1 | article)",
+		Observations: len(m.obs),
+		Participants: m.participants,
+		Articles:     m.articles,
+		REML:         reml,
+		Iterations:   iterations,
+		Converged:    converged,
+	}
+	inv := fit.l.inverse()
+	z := normalQuantile(1 - (1-Confidence)/2)
+	for i, term := range []string{"(Intercept)", "condition " + r.Treatment.Code} {
+		e := FixedEffect{Term: term, Estimate: fit.beta[i], SE: math.Sqrt(sigma2 * inv[m.articles+i][m.articles+i])}
+		e.Z = e.Estimate / e.SE
+		e.P = 2 * normalCDF(-math.Abs(e.Z))
+		e.CILow, e.CIHigh = e.Estimate-z*e.SE, e.Estimate+z*e.SE
+		model.Fixed = append(model.Fixed, e)
+	}
+	variances := []float64{theta[0] * theta[0] * sigma2, theta[1] * theta[1] * sigma2, sigma2}
+	total := variances[0] + variances[1] + variances[2]
+	for i, group := range []string{"participant", "article", "residual"} {
+		model.Variance = append(model.Variance, VarianceComponent{
+			Group:    group,
+			Variance: variances[i],
+			SD:       math.Sqrt(variances[i]),
+			Share:    variances[i] / total,
+		})
+	}
+	r.Mixed = model
+	return nil
+}
+
+// mixedFixed is the number of fixed effects: the intercept and the condition
+const mixedFixed = 2
+
+type observation struct {
+	participant int
+	article     int
+	y           float64
+}
+
+// mixedData holds the sufficient statistics of y = Xβ + Zu·bu + Zv·bv + ε, where participants only ever belong to a
+// single condition
+type mixedData struct {
+	obs          []observation
+	participants int
+	articles     int
+	treatment    []float64
+
+	yy        float64
+	xx        [mixedFixed][mixedFixed]float64
+	xy        [mixedFixed]float64
+	perCount  []float64
+	perY      []float64
+	perRated  [][]int
+	artCount  []float64
+	artY      []float64
+	artX      [][mixedFixed]float64
+	pairCount []map[int]float64
+}
+
+func (m *mixedData) prepare() {
+	m.perCount = make([]float64, m.participants)
+	m.perY = make([]float64, m.participants)
+	m.perRated = make([][]int, m.participants)
+	m.pairCount = make([]map[int]float64, m.participants)
+	m.artCount = make([]float64, m.articles)
+	m.artY = make([]float64, m.articles)
+	m.artX = make([][mixedFixed]float64, m.articles)
+	for i := range m.pairCount {
+		m.pairCount[i] = map[int]float64{}
+	}
+	for _, o := range m.obs {
+		x := [mixedFixed]float64{1, m.treatment[o.participant]}
+		m.yy += o.y * o.y
+		for a := range x {
+			m.xy[a] += x[a] * o.y
+			for b := range x {
+				m.xx[a][b] += x[a] * x[b]
+			}
+			m.artX[o.article][a] += x[a]
+		}
+		m.perCount[o.participant]++
+		m.perY[o.participant] += o.y
+		if m.pairCount[o.participant][o.article] == 0 {
+			m.perRated[o.participant] = append(m.perRated[o.participant], o.article)
+		}
+		m.pairCount[o.participant][o.article]++
+		m.artCount[o.article]++
+		m.artY[o.article] += o.y
+	}
+}
+
+type mixedFit struct {
+	reml float64
+	prss float64
+	beta []float64
+	// l is the Cholesky factor of the system over articles and fixed effects, its inverse scaled by the residual
+	// variance is the covariance of the estimates
+	l matrix
+}
+
+// fit solves the penalized least squares problem for relative standard deviations thetaU and thetaV of the
+// participant and article intercepts. Participants' equations are diagonal and eliminated first, leaving a dense
+// system over articles and fixed effects.
+func (m *mixedData) fit(thetaU float64, thetaV float64) (*mixedFit, bool) {
+	k := m.articles + mixedFixed
+	s := newMatrix(k)
+	c := make([]float64, k)
+	for j := 0; j < m.articles; j++ {
+		s[j][j] = thetaV*thetaV*m.artCount[j] + 1
+		for a := 0; a < mixedFixed; a++ {
+			s[j][m.articles+a] = thetaV * m.artX[j][a]
+			s[m.articles+a][j] = s[j][m.articles+a]
+		}
+		c[j] = thetaV * m.artY[j]
+	}
+	for a := 0; a < mixedFixed; a++ {
+		for b := 0; b < mixedFixed; b++ {
+			s[m.articles+a][m.articles+b] = m.xx[a][b]
+		}
+		c[m.articles+a] = m.xy[a]
+	}
+
+	logDet := 0.0
+	diag := make([]float64, m.participants)
+	cu := make([]float64, m.participants)
+	rows := make([][]int, m.participants)
+	weights := make([][]float64, m.participants)
+	for i := 0; i < m.participants; i++ {
+		diag[i] = thetaU*thetaU*m.perCount[i] + 1
+		cu[i] = thetaU * m.perY[i]
+		logDet += math.Log(diag[i])
+		idx := append(append([]int(nil), m.perRated[i]...), m.articles, m.articles+1)
+		w := make([]float64, len(idx))
+		for n, j := range m.perRated[i] {
+			w[n] = thetaU * thetaV * m.pairCount[i][j]
+		}
+		w[len(w)-2] = thetaU * m.perCount[i]
+		w[len(w)-1] = thetaU * m.perCount[i] * m.treatment[i]
+		for a := range idx {
+			for b := range idx {
+				s[idx[a]][idx[b]] -= w[a] * w[b] / diag[i]
+			}
+			c[idx[a]] -= w[a] * cu[i] / diag[i]
+		}
+		rows[i], weights[i] = idx, w
+	}
+	l, ok := cholesky(s)
+	if !ok {
+		return nil, false
+	}
+	logDet += l.logDet()
+	x := l.solve(c)
+
+	// The penalized residual sum of squares is yᵀy minus the solution's projection onto the right hand side
+	prss := m.yy
+	for j := 0; j < m.articles; j++ {
+		prss -= x[j] * thetaV * m.artY[j]
+	}
+	for a := 0; a < mixedFixed; a++ {
+		prss -= x[m.articles+a] * m.xy[a]
+	}
+	for i := 0; i < m.participants; i++ {
+		xi := cu[i]
+		for n, j := range rows[i] {
+			xi -= weights[i][n] * x[j]
+		}
+		xi /= diag[i]
+		prss -= xi * cu[i]
+	}
+	if prss <= 0 {
+		return nil, false
+	}
+	df := float64(len(m.obs) - mixedFixed)
+	fit := &mixedFit{
+		reml: logDet + df*(1+math.Log(2*math.Pi*prss/df)),
+		prss: prss,
+		beta: x[m.articles:],
+		l:    l,
+	}
+	return fit, true
+}
@@ -0,0 +1,117 @@
+package analysis
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/superc03/carp/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// testDataset builds a dataset of the default study from ratings, one row of values per participant, rated in the
+// order of the articles. Participants of the first condition come first, zero marks an article they did not rate.
+func testDataset(reference int, rows [][]int) *models.Dataset {
+	study := models.DefaultStudy
+	articles := make([]models.Article, len(rows[0]))
+	for j := range articles {
+		articles[j] = models.Article{ID: primitive.NewObjectID(), Title: fmt.Sprintf("Article %d", j+1)}
+	}
+	participants := make([]models.User, len(rows))
+	for i, row := range rows {
+		surveyType := study.Conditions[1].SurveyType
+		if i < reference {
+			surveyType = study.Conditions[0].SurveyType
+		}
+		data := bson.M{}
+		for j, v := range row {
+			if v != 0 {
+				data[articles[j].ID.Hex()] = int32(v)
+			}
+		}
+		participants[i] = models.User{Pseudonym: fmt.Sprintf("P%02d", i+1), SurveyType: surveyType, Data: data}
+	}
+	return &models.Dataset{Study: &study, Articles: articles, Participants: participants, ExportedOn: time.Now()}
+}
+
+// In a balanced crossed design REML agrees with the ANOVA estimators, so the expected values follow from the mean
+// squares: participants within condition 0.75, articles 31/12 and residuals 13/36
+func TestFitMixedModel(t *testing.T) {
+	d := testDataset(2, [][]int{
+		{2, 3, 4},
+		{3, 5, 4},
+		{4, 4, 5},
+		{3, 5, 5},
+	})
+	r, err := Analyze(d, CorrectionHolm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = r.FitMixedModel(d); err != nil {
+		t.Fatal(err)
+	}
+	m := r.Mixed
+	if !m.Converged {
+		t.Errorf("did not converge in %d iterations", m.Iterations)
+	}
+	if m.Observations != 12 || m.Participants != 4 || m.Articles != 3 {
+		t.Errorf("counted %d observations of %d participants and %d articles, want 12, 4 and 3",
+			m.Observations, m.Participants, m.Articles)
+	}
+	fixed := []struct {
+		term     string
+		estimate float64
+		se       float64
+	}{
+		{"(Intercept)", 3.5, 0.556942712660095},
+		{"condition with_image", 5.0 / 6, 0.5},
+	}
+	for i, want := range fixed {
+		got := m.Fixed[i]
+		if got.Term != want.term {
+			t.Errorf("fixed effect %d is %q, want %q", i, got.Term, want.term)
+		}
+		approx(t, want.term+" estimate", got.Estimate, want.estimate, 1e-6)
+		approx(t, want.term+" se", got.SE, want.se, 1e-4)
+	}
+	variances := []struct {
+		group    string
+		variance float64
+	}{
+		{"participant", 7.0 / 54},
+		{"article", 5.0 / 9},
+		{"residual", 13.0 / 36},
+	}
+	for i, want := range variances {
+		got := m.Variance[i]
+		if got.Group != want.group {
+			t.Errorf("variance component %d is %q, want %q", i, got.Group, want.group)
+		}
+		approx(t, want.group+" variance", got.Variance, want.variance, 1e-4)
+	}
+}
+
+func TestFitMixedModelTooFew(t *testing.T) {
+	tests := []struct {
+		name      string
+		reference int
+		rows      [][]int
+	}{
+		{"one condition", 2, [][]int{{1, 2}, {3, 4}}},
+		{"one article", 1, [][]int{{1}, {2}, {3}}},
+		{"too few ratings", 1, [][]int{{1, 0}, {0, 2}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := testDataset(tt.reference, tt.rows)
+			r, err := Analyze(d, CorrectionHolm)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = r.FitMixedModel(d); err != ErrTooFewObservations {
+				t.Errorf("FitMixedModel = %v, want ErrTooFewObservations", err)
+			}
+		})
+	}
+}
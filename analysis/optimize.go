@@ -0,0 +1,75 @@
+package analysis
+
+import (
+	"math"
+	"sort"
+)
+
+// minimize finds a local minimum of f with the Nelder–Mead simplex method, starting from x0 with simplex edges of
+// length step. It stops once the function values of the simplex agree to within tol or after maxIter iterations.
+func minimize(f func([]float64) float64, x0 []float64, step float64, tol float64, maxIter int) (x []float64, fx float64, iterations int, converged bool) {
+	n := len(x0)
+	type vertex struct {
+		x  []float64
+		fx float64
+	}
+	simplex := make([]vertex, n+1)
+	for i := range simplex {
+		v := append([]float64(nil), x0...)
+		if i > 0 {
+			v[i-1] += step
+		}
+		simplex[i] = vertex{v, f(v)}
+	}
+	// along returns centroid + t (centroid - worst)
+	along := func(centroid []float64, worst []float64, t float64) vertex {
+		v := make([]float64, n)
+		for i := range v {
+			v[i] = centroid[i] + t*(centroid[i]-worst[i])
+		}
+		return vertex{v, f(v)}
+	}
+	for iterations = 0; iterations < maxIter; iterations++ {
+		sort.Slice(simplex, func(i, j int) bool { return simplex[i].fx < simplex[j].fx })
+		best, worst := simplex[0], simplex[n]
+		if math.Abs(worst.fx-best.fx) <= tol*(math.Abs(best.fx)+tol) {
+			converged = true
+			break
+		}
+		centroid := make([]float64, n)
+		for _, v := range simplex[:n] {
+			for i := range centroid {
+				centroid[i] += v.x[i] / float64(n)
+			}
+		}
+		reflected := along(centroid, worst.x, 1)
+		switch {
+		case reflected.fx < best.fx:
+			if expanded := along(centroid, worst.x, 2); expanded.fx < reflected.fx {
+				simplex[n] = expanded
+			} else {
+				simplex[n] = reflected
+			}
+		case reflected.fx < simplex[n-1].fx:
+			simplex[n] = reflected
+		default:
+			t := -0.5
+			if reflected.fx < worst.fx {
+				t = 0.5
+			}
+			if contracted := along(centroid, worst.x, t); contracted.fx < math.Min(worst.fx, reflected.fx) {
+				simplex[n] = contracted
+				continue
+			}
+			// Shrink everything towards the best vertex
+			for i := 1; i <= n; i++ {
+				for j := range simplex[i].x {
+					simplex[i].x[j] = best.x[j] + 0.5*(simplex[i].x[j]-best.x[j])
+				}
+				simplex[i].fx = f(simplex[i].x)
+			}
+		}
+	}
+	sort.Slice(simplex, func(i, j int) bool { return simplex[i].fx < simplex[j].fx })
+	return simplex[0].x, simplex[0].fx, iterations, converged
+}
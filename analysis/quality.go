@@ -0,0 +1,150 @@
+package analysis
+
+import (
+	"math"
+	"time"
+
+	"github.com/superc03/carp/models"
+)
+
+// Quality flags, as listed in QualityReport.Flags
+const (
+	FlagSpeeder         = "speeder"
+	FlagFastItems       = "fast_items"
+	FlagStraightLining  = "straight_lining"
+	FlagLowVariance     = "low_variance"
+	FlagAttentionCheck  = "attention_check"
+	FlagDuplicateDevice = "duplicate_device"
+)
+
+// QualityFlags lists every flag in the order they are reported
+var QualityFlags = []string{FlagSpeeder, FlagFastItems, FlagStraightLining, FlagLowVariance, FlagAttentionCheck, FlagDuplicateDevice}
+
+// QualityReport holds the indicators of one participant's response quality, judged against the study's thresholds.
+// SharedDevices counts the other participants who rated from one of the participant's devices. Indicators that cannot
+// be computed, such as durations of participants who have not finished, are missing.
+type QualityReport struct {
+	Pseudonym      string   `json:"pseudonym"`
+	Condition      string   `json:"condition"`
+	Ratings        int      `json:"ratings"`
+	Duration       *float64 `json:"duration_seconds"`
+	TimedItems     int      `json:"timed_items"`
+	FastItems      int      `json:"fast_items"`
+	SD             *float64 `json:"rating_sd"`
+	ChecksAnswered int      `json:"checks_answered"`
+	ChecksFailed   int      `json:"checks_failed"`
+	SharedDevices  int      `json:"shared_devices"`
+	Flags          []string `json:"flags"`
+}
+
+// Flagged reports whether any indicator crossed its threshold
+func (q QualityReport) Flagged() bool {
+	return len(q.Flags) > 0
+}
+
+// Has reports whether the participant raised the given flag
+func (q QualityReport) Has(flag string) bool {
+	for _, f := range q.Flags {
+		if f == flag {
+			return true
+		}
+	}
+	return false
+}
+
+// AssessQuality computes the quality indicators of every participant, in the dataset's order. Durations run from the
+// first article shown to the last rating and are only compared between participants who finished. Devices are
+// shared when another participant in the dataset rated from the same browser.
+func AssessQuality(d *models.Dataset) []QualityReport {
+	thresholds := d.Study.Quality.WithDefaults()
+	articleCount := d.SurveyLength()
+	participantsByDevice := map[string][]int{}
+	for i, u := range d.Participants {
+		for _, device := range u.Devices {
+			participantsByDevice[device] = append(participantsByDevice[device], i)
+		}
+	}
+
+	reports := make([]QualityReport, len(d.Participants))
+	var durations []float64
+	for i, u := range d.Participants {
+		q := QualityReport{Pseudonym: u.Pseudonym, Condition: models.ConditionCode(u.SurveyType), Flags: []string{}}
+		var ratings []float64
+		for _, a := range d.Articles {
+			if v, ok := u.Rating(a.ID.Hex()); ok {
+				ratings = append(ratings, float64(v))
+			}
+		}
+		q.Ratings = len(ratings)
+		for _, c := range d.Checks {
+			if v, ok := u.Rating(c.ID.Hex()); ok {
+				q.ChecksAnswered++
+				if v != *c.AttentionCheck {
+					q.ChecksFailed++
+				}
+			}
+		}
+
+		var first, last *time.Time
+		for _, r := range u.Responses {
+			if r.ShownOn != nil && (first == nil || r.ShownOn.Before(*first)) {
+				first = r.ShownOn
+			}
+			if r.RatedOn != nil && (last == nil || r.RatedOn.After(*last)) {
+				last = r.RatedOn
+			}
+			if r.ShownOn != nil && r.RatedOn != nil {
+				q.TimedItems++
+				if r.RatedOn.Sub(*r.ShownOn).Seconds() < thresholds.FastItemSeconds {
+					q.FastItems++
+				}
+			}
+		}
+		if u.Status(articleCount) == models.StatusCompleted && first != nil && last != nil {
+			duration := last.Sub(*first).Seconds()
+			q.Duration = &duration
+			durations = append(durations, duration)
+		}
+
+		if q.Ratings >= thresholds.MinRatings {
+			sd := math.Sqrt(variance(ratings))
+			q.SD = &sd
+		}
+		others := map[int]bool{}
+		for _, device := range u.Devices {
+			for _, other := range participantsByDevice[device] {
+				if other != i {
+					others[other] = true
+				}
+			}
+		}
+		q.SharedDevices = len(others)
+		reports[i] = q
+	}
+
+	speederBelow := 0.0
+	if len(durations) > 0 {
+		speederBelow = thresholds.SpeederShare * median(durations)
+	}
+	for i := range reports {
+		q := &reports[i]
+		if q.Duration != nil && *q.Duration < speederBelow {
+			q.Flags = append(q.Flags, FlagSpeeder)
+		}
+		if q.TimedItems > 0 && float64(q.FastItems)/float64(q.TimedItems) >= thresholds.FastItemShare {
+			q.Flags = append(q.Flags, FlagFastItems)
+		}
+		if q.SD != nil && *q.SD == 0 {
+			q.Flags = append(q.Flags, FlagStraightLining)
+		} else if q.SD != nil && *q.SD < thresholds.MinSD {
+			q.Flags = append(q.Flags, FlagLowVariance)
+		}
+		if q.ChecksFailed >= thresholds.FailedChecks {
+			q.Flags = append(q.Flags, FlagAttentionCheck)
+		}
+		if q.SharedDevices > 0 {
+			q.Flags = append(q.Flags, FlagDuplicateDevice)
+		}
+	}
+	return reports
+}
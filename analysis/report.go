@@ -0,0 +1,188 @@
+// Package analysis compares the ratings of the study's conditions, per article and over all articles
+package analysis
+
+import (
+	"errors"
+	"time"
+
+	"github.com/superc03/carp/models"
+)
+
+// Report compares a treatment condition against a reference condition. Bootstrap and Bayesian estimates start every
+// comparison's random draws from Seed, so rerunning them with it reproduces each exactly.
+type Report struct {
+	Study       *models.Study    `json:"study"`
+	Filter      string           `json:"filter,omitempty"`
+	GeneratedOn time.Time        `json:"generated_on"`
+	Reference   models.Condition `json:"reference"`
+	Treatment   models.Condition `json:"treatment"`
+	Correction  Correction       `json:"correction"`
+	Confidence  float64          `json:"confidence"`
+	Overall     Comparison       `json:"overall"`
+	Articles    []Comparison     `json:"articles"`
+	Discernment []Comparison     `json:"discernment,omitempty"`
+	Mixed       *MixedModel      `json:"mixed_model,omitempty"`
+	MixedError  string           `json:"mixed_model_error,omitempty"`
+	Seed        *int64           `json:"seed,omitempty"`
+	Resamples   int              `json:"resamples,omitempty"`
+	Draws       int              `json:"posterior_draws,omitempty"`
+	ROPE        float64          `json:"rope,omitempty"`
+}
+
+// Comparison holds the descriptives of both conditions and the tests between them. Tests are missing when there is
+// not enough data to run them, bootstrap and Bayesian estimates also until they are asked for.
+type Comparison struct {
+	ArticleID   string          `json:"article_id,omitempty"`
+	Title       string          `json:"title"`
+	Veracity    models.Veracity `json:"veracity,omitempty"`
+	Groups      []Descriptives  `json:"groups"`
+	Welch       *TTest          `json:"welch,omitempty"`
+	MannWhitney *UTest          `json:"mann_whitney,omitempty"`
+	Effect      *EffectSize     `json:"effect,omitempty"`
+	Bootstrap   *BootstrapCI    `json:"bootstrap,omitempty"`
+	Bayes       *BayesEstimate  `json:"bayes,omitempty"`
+
+	samples [2][]float64
+}
+
+// ErrTooFewConditions is returned for studies that have nothing to compare
+var ErrTooFewConditions = errors.New("the study needs at least two conditions to compare")
+
+// Analyze compares the study's second condition against its first. Articles are compared on their ratings, the
+// overall comparison on each participant's mean rating, so every participant counts once. The per-article tests form
+// one family whose p-values are adjusted with c. Once articles are labelled true and false, participants' discernment
+// is compared as well.
+func Analyze(d *models.Dataset, c Correction) (*Report, error) {
+	if len(d.Study.Conditions) < 2 {
+		return nil, ErrTooFewConditions
+	}
+	r := &Report{
+		Study:       d.Study,
+		Filter:      d.Filter.String(),
+		GeneratedOn: d.ExportedOn,
+		Reference:   d.Study.Conditions[0],
+		Treatment:   d.Study.Conditions[1],
+		Correction:  c,
+		Confidence:  Confidence,
+		Articles:    make([]Comparison, len(d.Articles)),
+	}
+	ratings := Ratings(d)
+	overall := [2][]float64{}
+	for _, u := range d.Participants {
+		group := r.group(u.SurveyType)
+		if group < 0 {
+			continue
+		}
+		values := make([]float64, 0, len(d.Articles))
+		for _, a := range d.Articles {
+			if v, ok := u.Rating(a.ID.Hex()); ok {
+				values = append(values, float64(v))
+			}
+		}
+		if len(values) > 0 {
+			overall[group] = append(overall[group], mean(values))
+		}
+	}
+	r.Overall = r.compare(overall)
+	r.Overall.Title = "All articles (participant means)"
+	for i, a := range d.Articles {
+		groups := [2][]float64{}
+		for _, rating := range ratings[a.ID.Hex()] {
+			if group := r.group(rating.SurveyType); group >= 0 {
+				groups[group] = append(groups[group], rating.Value)
+			}
+		}
+		r.Articles[i] = r.compare(groups)
+		r.Articles[i].ArticleID = a.ID.Hex()
+		r.Articles[i].Title = a.Title
+		r.Articles[i].Veracity = a.Veracity
+	}
+	r.adjust()
+	if HasVeracity(d) {
+		r.compareDiscernment(d)
+	}
+	return r, nil
+}
+
+// Rating is a single rating of an article together with its rater's condition
+type Rating struct {
+	Pseudonym  string
+	SurveyType int
+	Value      float64
+}
+
+// Ratings groups every rating in the dataset by article ID
+func Ratings(d *models.Dataset) map[string][]Rating {
+	ratings := make(map[string][]Rating, len(d.Articles))
+	for _, u := range d.Participants {
+		for _, a := range d.Articles {
+			if v, ok := u.Rating(a.ID.Hex()); ok {
+				ratings[a.ID.Hex()] = append(ratings[a.ID.Hex()], Rating{u.Pseudonym, u.SurveyType, float64(v)})
+			}
+		}
+	}
+	return ratings
+}
+
+func (r *Report) group(surveyType int) int {
+	switch surveyType {
+	case r.Reference.SurveyType:
+		return 0
+	case r.Treatment.SurveyType:
+		return 1
+	}
+	return -1
+}
+
+func (r *Report) compare(groups [2][]float64) Comparison {
+	return Comparison{
+		Groups: []Descriptives{
+			Describe(r.Reference.Code, groups[0]),
+			Describe(r.Treatment.Code, groups[1]),
+		},
+		Welch:       Welch(groups[0], groups[1]),
+		MannWhitney: MannWhitney(groups[0], groups[1]),
+		Effect:      Effect(groups[0], groups[1]),
+		samples:     groups,
+	}
+}
+
+// comparisons lists every comparison in the report, so estimates can be added to each in place
+func (r *Report) comparisons() []*Comparison {
+	all := []*Comparison{&r.Overall}
+	for i := range r.Articles {
+		all = append(all, &r.Articles[i])
+	}
+	for i := range r.Discernment {
+		all = append(all, &r.Discernment[i])
+	}
+	return all
+}
+
+// adjust corrects the p-values of the per-article tests that could be run
+func (r *Report) adjust() {
+	welch := make([]*TTest, 0, len(r.Articles))
+	mannWhitney := make([]*UTest, 0, len(r.Articles))
+	for _, a := range r.Articles {
+		if a.Welch != nil {
+			welch = append(welch, a.Welch)
+		}
+		if a.MannWhitney != nil {
+			mannWhitney = append(mannWhitney, a.MannWhitney)
+		}
+	}
+	p := make([]float64, len(welch))
+	for i, t := range welch {
+		p[i] = t.P
+	}
+	for i, adjusted := range r.Correction.Adjust(p) {
+		welch[i].AdjustedP = adjusted
+	}
+	p = make([]float64, len(mannWhitney))
+	for i, u := range mannWhitney {
+		p[i] = u.P
+	}
+	for i, adjusted := range r.Correction.Adjust(p) {
+		mannWhitney[i].AdjustedP = adjusted
+	}
+}
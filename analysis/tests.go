@@ -0,0 +1,140 @@
+package analysis
+
+import (
+	"math"
+	"sort"
+)
+
+// Confidence is the level of every confidence interval in a report
+const Confidence = 0.95
+
+// TTest is Welch's unequal variances t-test of the treatment mean minus the reference mean
+type TTest struct {
+	Difference float64 `json:"difference"`
+	SE         float64 `json:"se"`
+	T          float64 `json:"t"`
+	DF         float64 `json:"df"`
+	P          float64 `json:"p"`
+	AdjustedP  float64 `json:"adjusted_p"`
+	CILow      float64 `json:"ci_low"`
+	CIHigh     float64 `json:"ci_high"`
+}
+
+// UTest is the Mann–Whitney U test with a normal approximation corrected for ties and continuity. U counts how often
+// a treatment rating beats a reference rating, so the rank-biserial correlation is positive when treatment rates
+// higher.
+type UTest struct {
+	U            float64 `json:"u"`
+	Z            float64 `json:"z"`
+	P            float64 `json:"p"`
+	AdjustedP    float64 `json:"adjusted_p"`
+	RankBiserial float64 `json:"rank_biserial"`
+}
+
+// EffectSize is the standardized mean difference of treatment minus reference, with normal approximation intervals
+type EffectSize struct {
+	CohensD float64 `json:"cohens_d"`
+	DLow    float64 `json:"d_ci_low"`
+	DHigh   float64 `json:"d_ci_high"`
+	HedgesG float64 `json:"hedges_g"`
+	GLow    float64 `json:"g_ci_low"`
+	GHigh   float64 `json:"g_ci_high"`
+}
+
+// Welch runs Welch's t-test, returning nil when either group has fewer than two values or neither varies
+func Welch(reference []float64, treatment []float64) *TTest {
+	na, nb := float64(len(reference)), float64(len(treatment))
+	if na < 2 || nb < 2 {
+		return nil
+	}
+	va, vb := variance(reference)/na, variance(treatment)/nb
+	se := math.Sqrt(va + vb)
+	if se == 0 {
+		return nil
+	}
+	t := &TTest{Difference: mean(treatment) - mean(reference), SE: se}
+	t.T = t.Difference / se
+	t.DF = (va + vb) * (va + vb) / (va*va/(na-1) + vb*vb/(nb-1))
+	t.P = 2 * studentCDF(-math.Abs(t.T), t.DF)
+	t.AdjustedP = t.P
+	margin := studentQuantile(1-(1-Confidence)/2, t.DF) * se
+	t.CILow, t.CIHigh = t.Difference-margin, t.Difference+margin
+	return t
+}
+
+// MannWhitney runs the Mann–Whitney U test, returning nil when either group is empty
+func MannWhitney(reference []float64, treatment []float64) *UTest {
+	na, nb := len(reference), len(treatment)
+	if na == 0 || nb == 0 {
+		return nil
+	}
+	type ranked struct {
+		value     float64
+		treatment bool
+	}
+	all := make([]ranked, 0, na+nb)
+	for _, v := range reference {
+		all = append(all, ranked{v, false})
+	}
+	for _, v := range treatment {
+		all = append(all, ranked{v, true})
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].value < all[j].value })
+
+	// Tied values share the mean of their ranks
+	rankSum, ties := 0.0, 0.0
+	for i := 0; i < len(all); {
+		j := i
+		for j < len(all) && all[j].value == all[i].value {
+			j++
+		}
+		rank := float64(i+j+1) / 2
+		for k := i; k < j; k++ {
+			if all[k].treatment {
+				rankSum += rank
+			}
+		}
+		t := float64(j - i)
+		ties += t*t*t - t
+		i = j
+	}
+
+	n, product := float64(na+nb), float64(na)*float64(nb)
+	u := &UTest{U: rankSum - float64(nb)*float64(nb+1)/2, P: 1, AdjustedP: 1}
+	u.RankBiserial = 2*u.U/product - 1
+	sd := math.Sqrt(product / 12 * ((n + 1) - ties/(n*(n-1))))
+	if sd == 0 {
+		return u
+	}
+	diff := u.U - product/2
+	if diff > 0 {
+		diff = math.Max(diff-0.5, 0)
+	} else {
+		diff = math.Min(diff+0.5, 0)
+	}
+	u.Z = diff / sd
+	u.P = 2 * normalCDF(-math.Abs(u.Z))
+	u.AdjustedP = u.P
+	return u
+}
+
+// Effect computes Cohen's d over the pooled standard deviation and its small sample corrected Hedges' g, returning
+// nil when either group has fewer than two values or neither varies
+func Effect(reference []float64, treatment []float64) *EffectSize {
+	na, nb := float64(len(reference)), float64(len(treatment))
+	if na < 2 || nb < 2 {
+		return nil
+	}
+	pooled := math.Sqrt(((na-1)*variance(reference) + (nb-1)*variance(treatment)) / (na + nb - 2))
+	if pooled == 0 {
+		return nil
+	}
+	z := normalQuantile(1 - (1-Confidence)/2)
+	e := &EffectSize{CohensD: (mean(treatment) - mean(reference)) / pooled}
+	se := math.Sqrt((na+nb)/(na*nb) + e.CohensD*e.CohensD/(2*(na+nb)))
+	e.DLow, e.DHigh = e.CohensD-z*se, e.CohensD+z*se
+	j := 1 - 3/(4*(na+nb-2)-1)
+	e.HedgesG = j * e.CohensD
+	e.GLow, e.GHigh = e.HedgesG-z*j*se, e.HedgesG+z*j*se
+	return e
+}
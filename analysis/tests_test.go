@@ -0,0 +1,198 @@
+package analysis
+
+import (
+	"math"
+	"testing"
+)
+
+// Expected values were computed independently, integrating Student's t density numerically and counting pairs for U,
+// and agree with R's t.test, wilcox.test(correct = TRUE) and the textbook pooled-SD d
+func approx(t *testing.T, name string, got, want, tolerance float64) {
+	t.Helper()
+	if math.Abs(got-want) > tolerance {
+		t.Errorf("%s = %.10g, want %.10g", name, got, want)
+	}
+}
+
+func TestWelch(t *testing.T) {
+	tests := []struct {
+		name       string
+		reference  []float64
+		treatment  []float64
+		wantNil    bool
+		difference float64
+		se         float64
+		t          float64
+		df         float64
+		p          float64
+		ciLow      float64
+		ciHigh     float64
+	}{
+		{
+			name:       "unequal variances",
+			reference:  []float64{1, 2, 3, 4, 5},
+			treatment:  []float64{3, 4, 5, 6, 7, 8},
+			difference: 2.5,
+			se:         1.0408329997330665,
+			t:          2.4019223070763065,
+			df:         8.989361702127662,
+			p:          0.03980308202413539,
+			ciLow:      0.1450473560355907,
+			ciHigh:     4.85495264396441,
+		},
+		{
+			name:       "treatment lower",
+			reference:  []float64{3, 4, 5, 6, 7, 8},
+			treatment:  []float64{1, 2, 3, 4, 5},
+			difference: -2.5,
+			se:         1.0408329997330665,
+			t:          -2.4019223070763065,
+			df:         8.989361702127662,
+			p:          0.03980308202413539,
+			ciLow:      -4.85495264396441,
+			ciHigh:     -0.1450473560355907,
+		},
+		{name: "single value", reference: []float64{1}, treatment: []float64{2, 3}, wantNil: true},
+		{name: "no variation", reference: []float64{2, 2}, treatment: []float64{4, 4, 4}, wantNil: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Welch(tt.reference, tt.treatment)
+			if tt.wantNil {
+				if got != nil {
+					t.Fatalf("Welch = %+v, want nil", got)
+				}
+				return
+			}
+			if got == nil {
+				t.Fatal("Welch = nil")
+			}
+			approx(t, "difference", got.Difference, tt.difference, 1e-12)
+			approx(t, "se", got.SE, tt.se, 1e-12)
+			approx(t, "t", got.T, tt.t, 1e-12)
+			approx(t, "df", got.DF, tt.df, 1e-10)
+			approx(t, "p", got.P, tt.p, 1e-6)
+			approx(t, "adjusted p", got.AdjustedP, tt.p, 1e-6)
+			approx(t, "ci low", got.CILow, tt.ciLow, 1e-5)
+			approx(t, "ci high", got.CIHigh, tt.ciHigh, 1e-5)
+		})
+	}
+}
+
+func TestMannWhitney(t *testing.T) {
+	tests := []struct {
+		name         string
+		reference    []float64
+		treatment    []float64
+		wantNil      bool
+		u            float64
+		z            float64
+		p            float64
+		rankBiserial float64
+	}{
+		{
+			name:         "ties",
+			reference:    []float64{1, 2, 3, 4, 5},
+			treatment:    []float64{3, 4, 5, 6, 7, 8},
+			u:            25.5,
+			z:            1.8383188740373877,
+			p:            0.06601543152123106,
+			rankBiserial: 0.7,
+		},
+		{
+			name:         "treatment lower",
+			reference:    []float64{3, 4, 5, 6, 7, 8},
+			treatment:    []float64{1, 2, 3, 4, 5},
+			u:            4.5,
+			z:            -1.8383188740373877,
+			p:            0.06601543152123106,
+			rankBiserial: -0.7,
+		},
+		{
+			name:         "complete separation",
+			reference:    []float64{1, 2, 3},
+			treatment:    []float64{4, 5, 6},
+			u:            9,
+			z:            1.7457431218879391,
+			p:            0.0808555983700523,
+			rankBiserial: 1,
+		},
+		{
+			name:         "all tied",
+			reference:    []float64{3, 3},
+			treatment:    []float64{3, 3, 3},
+			u:            3,
+			p:            1,
+			rankBiserial: 0,
+		},
+		{name: "empty", reference: nil, treatment: []float64{1}, wantNil: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := MannWhitney(tt.reference, tt.treatment)
+			if tt.wantNil {
+				if got != nil {
+					t.Fatalf("MannWhitney = %+v, want nil", got)
+				}
+				return
+			}
+			if got == nil {
+				t.Fatal("MannWhitney = nil")
+			}
+			approx(t, "u", got.U, tt.u, 1e-12)
+			approx(t, "z", got.Z, tt.z, 1e-12)
+			approx(t, "p", got.P, tt.p, 1e-9)
+			approx(t, "rank-biserial", got.RankBiserial, tt.rankBiserial, 1e-12)
+		})
+	}
+}
+
+func TestEffect(t *testing.T) {
+	tests := []struct {
+		name      string
+		reference []float64
+		treatment []float64
+		wantNil   bool
+		d         float64
+		g         float64
+	}{
+		{
+			name:      "unequal sizes",
+			reference: []float64{1, 2, 3, 4, 5},
+			treatment: []float64{3, 4, 5, 6, 7, 8},
+			d:         1.4301938838683885,
+			g:         1.3076058366796695,
+		},
+		{
+			name:      "equal sizes",
+			reference: []float64{2, 4, 6},
+			treatment: []float64{1, 2, 3},
+			d:         -1.2649110640673518,
+			g:         -1.0119288512538815,
+		},
+		{name: "single value", reference: []float64{1, 2}, treatment: []float64{2}, wantNil: true},
+		{name: "no variation", reference: []float64{2, 2}, treatment: []float64{4, 4}, wantNil: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Effect(tt.reference, tt.treatment)
+			if tt.wantNil {
+				if got != nil {
+					t.Fatalf("Effect = %+v, want nil", got)
+				}
+				return
+			}
+			if got == nil {
+				t.Fatal("Effect = nil")
+			}
+			approx(t, "d", got.CohensD, tt.d, 1e-12)
+			approx(t, "g", got.HedgesG, tt.g, 1e-12)
+			if !(got.DLow < got.CohensD && got.CohensD < got.DHigh) {
+				t.Errorf("d interval [%g, %g] does not contain %g", got.DLow, got.DHigh, got.CohensD)
+			}
+			if !(got.GLow < got.HedgesG && got.HedgesG < got.GHigh) {
+				t.Errorf("g interval [%g, %g] does not contain %g", got.GLow, got.GHigh, got.HedgesG)
+			}
+		})
+	}
+}
@@ -0,0 +1,191 @@
+// Package chart draws the study's results as vector charts. Charts are built as a list of simple shapes on a Canvas,
+// which renders them as SVG and which other formats can draw shape by shape.
+package chart
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Kind is the kind of shape an Element draws
+type Kind int
+
+// Shape kinds
+const (
+	KindLine Kind = iota
+	KindPolyline
+	KindRect
+	KindCircle
+	KindText
+)
+
+// Anchor is which part of a text is placed at its point
+type Anchor string
+
+// Text anchors, as named in SVG
+const (
+	AnchorStart  Anchor = "start"
+	AnchorMiddle Anchor = "middle"
+	AnchorEnd    Anchor = "end"
+)
+
+// Colours used by every chart
+const (
+	ColorText  = "#1f2937"
+	ColorMuted = "#6b7280"
+	ColorGrid  = "#e5e7eb"
+	ColorAxis  = "#9ca3af"
+)
+
+// Palette colours the study's conditions in order
+var Palette = []string{"#9333ea", "#f59e0b", "#0d9488", "#e11d48"}
+
+// Point is a position on the canvas, with y growing downwards
+type Point struct {
+	X float64
+	Y float64
+}
+
+// Element is a single shape. Lines and polylines are drawn through Points, rectangles from their top left point
+// with Width and Height, circles around their point with Radius and text from its point on the baseline. Colours are
+// hex codes, an empty Fill or Stroke is not painted.
+type Element struct {
+	Kind        Kind
+	Points      []Point
+	Width       float64
+	Height      float64
+	Radius      float64
+	Text        string
+	Size        float64
+	Bold        bool
+	Anchor      Anchor
+	Fill        string
+	Stroke      string
+	StrokeWidth float64
+	Dashed      bool
+}
+
+// Canvas is a chart of the given size in points
+type Canvas struct {
+	Width    float64
+	Height   float64
+	Title    string
+	Elements []Element
+}
+
+// NewCanvas starts an empty chart
+func NewCanvas(width float64, height float64, title string) *Canvas {
+	return &Canvas{Width: width, Height: height, Title: title}
+}
+
+// Line draws a straight line
+func (c *Canvas) Line(x1 float64, y1 float64, x2 float64, y2 float64, stroke string, width float64, dashed bool) {
+	c.Elements = append(c.Elements, Element{Kind: KindLine, Points: []Point{{x1, y1}, {x2, y2}}, Stroke: stroke, StrokeWidth: width, Dashed: dashed})
+}
+
+// Polyline draws connected line segments through points
+func (c *Canvas) Polyline(points []Point, stroke string, width float64) {
+	c.Elements = append(c.Elements, Element{Kind: KindPolyline, Points: points, Stroke: stroke, StrokeWidth: width})
+}
+
+// Rect draws a filled rectangle
+func (c *Canvas) Rect(x float64, y float64, width float64, height float64, fill string) {
+	c.Elements = append(c.Elements, Element{Kind: KindRect, Points: []Point{{x, y}}, Width: width, Height: height, Fill: fill})
+}
+
+// Circle draws a filled circle
+func (c *Canvas) Circle(x float64, y float64, radius float64, fill string) {
+	c.Elements = append(c.Elements, Element{Kind: KindCircle, Points: []Point{{x, y}}, Radius: radius, Fill: fill})
+}
+
+// Text writes a single line of text
+func (c *Canvas) Text(x float64, y float64, text string, size float64, anchor Anchor, fill string) {
+	c.Elements = append(c.Elements, Element{Kind: KindText, Points: []Point{{x, y}}, Text: text, Size: size, Anchor: anchor, Fill: fill})
+}
+
+// Heading writes the chart's title in bold across the top
+func (c *Canvas) Heading(text string) {
+	c.Elements = append(c.Elements, Element{Kind: KindText, Points: []Point{{c.Width / 2, 20}}, Text: text, Size: 14,
+		Bold: true, Anchor: AnchorMiddle, Fill: ColorText})
+}
+
+// TextWidth estimates how wide text set in a sans-serif font of the given size is
+func TextWidth(text string, size float64) float64 {
+	return float64(len([]rune(text))) * size * 0.52
+}
+
+// Truncate shortens text with an ellipsis so it fits within width
+func Truncate(text string, size float64, width float64) string {
+	if TextWidth(text, size) <= width {
+		return text
+	}
+	runes := []rune(text)
+	keep := int(width/(size*0.52)) - 1
+	if keep < 1 {
+		return "…"
+	}
+	return strings.TrimSpace(string(runes[:keep])) + "…"
+}
+
+// WriteSVG renders the canvas as a standalone SVG document
+func (c *Canvas) WriteSVG(w io.Writer) error {
+	out := bufio.NewWriter(w)
+	fmt.Fprintf(out, `<svg xmlns="http://www.w3.org/2000/svg" width="%s" height="%s" viewBox="0 0 %s %s" font-family="Helvetica, Arial, sans-serif">`,
+		svgNumber(c.Width), svgNumber(c.Height), svgNumber(c.Width), svgNumber(c.Height))
+	out.WriteString("\n")
+	if c.Title != "" {
+		out.WriteString("<title>")
+		xml.EscapeText(out, []byte(c.Title))
+		out.WriteString("</title>\n")
+	}
+	fmt.Fprintf(out, `<rect x="0" y="0" width="%s" height="%s" fill="#ffffff"/>`+"\n", svgNumber(c.Width), svgNumber(c.Height))
+	for _, e := range c.Elements {
+		switch e.Kind {
+		case KindLine:
+			fmt.Fprintf(out, `<line x1="%s" y1="%s" x2="%s" y2="%s"%s/>`, svgNumber(e.Points[0].X), svgNumber(e.Points[0].Y),
+				svgNumber(e.Points[1].X), svgNumber(e.Points[1].Y), strokeAttributes(e))
+		case KindPolyline:
+			points := make([]string, len(e.Points))
+			for i, p := range e.Points {
+				points[i] = svgNumber(p.X) + "," + svgNumber(p.Y)
+			}
+			fmt.Fprintf(out, `<polyline points="%s" fill="none"%s/>`, strings.Join(points, " "), strokeAttributes(e))
+		case KindRect:
+			fmt.Fprintf(out, `<rect x="%s" y="%s" width="%s" height="%s" fill="%s"/>`, svgNumber(e.Points[0].X), svgNumber(e.Points[0].Y),
+				svgNumber(e.Width), svgNumber(e.Height), e.Fill)
+		case KindCircle:
+			fmt.Fprintf(out, `<circle cx="%s" cy="%s" r="%s" fill="%s"/>`, svgNumber(e.Points[0].X), svgNumber(e.Points[0].Y),
+				svgNumber(e.Radius), e.Fill)
+		case KindText:
+			weight := ""
+			if e.Bold {
+				weight = ` font-weight="bold"`
+			}
+			fmt.Fprintf(out, `<text x="%s" y="%s" font-size="%s" text-anchor="%s" fill="%s"%s>`, svgNumber(e.Points[0].X),
+				svgNumber(e.Points[0].Y), svgNumber(e.Size), e.Anchor, e.Fill, weight)
+			xml.EscapeText(out, []byte(e.Text))
+			out.WriteString("</text>")
+		}
+		out.WriteString("\n")
+	}
+	out.WriteString("</svg>\n")
+	return out.Flush()
+}
+
+func strokeAttributes(e Element) string {
+	attributes := fmt.Sprintf(` stroke="%s" stroke-width="%s"`, e.Stroke, svgNumber(e.StrokeWidth))
+	if e.Dashed {
+		attributes += ` stroke-dasharray="4 3"`
+	}
+	return attributes
+}
+
+// svgNumber prints coordinates with at most two decimals, which is finer than any screen or printer resolves
+func svgNumber(v float64) string {
+	return strconv.FormatFloat(math.Round(v*100)/100, 'f', -1, 64)
+}
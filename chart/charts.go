@@ -0,0 +1,267 @@
+package chart
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/superc03/carp/analysis"
+	"github.com/superc03/carp/models"
+)
+
+// Sizes shared by the charts, in points
+const (
+	width      = 720.0
+	textSize   = 11.0
+	smallSize  = 9.0
+	headingTop = 48.0
+)
+
+// RatingDistribution draws a grouped bar chart of how often each point of the scale was chosen, as the percentage of
+// every condition's ratings of all articles
+func RatingDistribution(d *models.Dataset) *Canvas {
+	c := NewCanvas(width, 380, "Rating distribution per condition")
+	c.Heading("Rating distribution per condition")
+	scale := d.Study.Scale
+	points := scale.Max - scale.Min + 1
+	counts := make([][]int, len(d.Study.Conditions))
+	totals := make([]int, len(d.Study.Conditions))
+	for i := range counts {
+		counts[i] = make([]int, points)
+	}
+	for _, ratings := range analysis.Ratings(d) {
+		for _, r := range ratings {
+			for i, cond := range d.Study.Conditions {
+				value := int(r.Value) - scale.Min
+				if cond.SurveyType == r.SurveyType && value >= 0 && value < points {
+					counts[i][value]++
+					totals[i]++
+				}
+			}
+		}
+	}
+	highest := 0.0
+	for i := range counts {
+		for _, n := range counts[i] {
+			if totals[i] > 0 {
+				highest = math.Max(highest, 100*float64(n)/float64(totals[i]))
+			}
+		}
+	}
+	if highest == 0 || points < 1 {
+		c.Text(c.Width/2, c.Height/2, "No ratings yet", textSize, AnchorMiddle, ColorMuted)
+		return c
+	}
+
+	legend := make([]string, len(d.Study.Conditions))
+	for i, cond := range d.Study.Conditions {
+		legend[i] = fmt.Sprintf("%s (%d ratings)", cond.Name, totals[i])
+	}
+	c.legend(headingTop-12, legend)
+	left, right, top, bottom := 56.0, c.Width-20, headingTop+16, c.Height-56
+	yTicks := ticks(0, highest, 5)
+	y := func(v float64) float64 {
+		return bottom - (bottom-top)*v/yTicks[len(yTicks)-1]
+	}
+	for _, t := range yTicks {
+		c.Line(left, y(t), right, y(t), ColorGrid, 1, false)
+		c.Text(left-6, y(t)+4, formatTick(t, yTicks)+"%", smallSize, AnchorEnd, ColorMuted)
+	}
+	band := (right - left) / float64(points)
+	bar := band * 0.8 / float64(len(counts))
+	for p := 0; p < points; p++ {
+		x := left + band*float64(p) + band*0.1
+		for i := range counts {
+			if totals[i] == 0 {
+				continue
+			}
+			share := 100 * float64(counts[i][p]) / float64(totals[i])
+			c.Rect(x+bar*float64(i), y(share), bar*0.92, bottom-y(share), color(i))
+		}
+		center := left + band*(float64(p)+0.5)
+		value := scale.Min + p
+		c.Text(center, bottom+16, strconv.Itoa(value), textSize, AnchorMiddle, ColorText)
+		if label := scale.AnchorLabel(value); label != strconv.Itoa(value) {
+			c.Text(center, bottom+30, Truncate(label, smallSize, band-4), smallSize, AnchorMiddle, ColorMuted)
+		}
+	}
+	c.Line(left, bottom, right, bottom, ColorAxis, 1, false)
+	c.Text((left+right)/2, c.Height-8, "Rating", textSize, AnchorMiddle, ColorText)
+	return c
+}
+
+// ForestPlot draws every article's difference in mean rating between the treatment and reference conditions with
+// its confidence interval, followed by discernment and the overall comparison. Significant differences are
+// highlighted, judging articles by their adjusted p-values.
+func ForestPlot(r *analysis.Report) *Canvas {
+	rows := make([]*analysis.Comparison, 0, len(r.Articles)+len(r.Discernment)+1)
+	for i := range r.Articles {
+		rows = append(rows, &r.Articles[i])
+	}
+	for i := range r.Discernment {
+		rows = append(rows, &r.Discernment[i])
+	}
+	rows = append(rows, &r.Overall)
+	const rowHeight = 22.0
+	c := NewCanvas(width, headingTop+rowHeight*float64(len(rows))+64, "Condition effects per article")
+	c.Heading("Condition effects per article")
+
+	low, high := 0.0, 0.0
+	for _, row := range rows {
+		if row.Welch != nil {
+			low, high = math.Min(low, row.Welch.CILow), math.Max(high, row.Welch.CIHigh)
+		}
+	}
+	if low == high {
+		low, high = -1, 1
+	}
+	xTicks := ticks(low, high, 6)
+	left, right := 260.0, c.Width-130
+	top, bottom := headingTop, headingTop+rowHeight*float64(len(rows))
+	x := func(v float64) float64 {
+		return left + (right-left)*(v-xTicks[0])/(xTicks[len(xTicks)-1]-xTicks[0])
+	}
+	for _, t := range xTicks {
+		c.Line(x(t), top, x(t), bottom, ColorGrid, 1, false)
+		c.Text(x(t), bottom+16, formatTick(t, xTicks), smallSize, AnchorMiddle, ColorMuted)
+	}
+	c.Line(x(0), top, x(0), bottom, ColorAxis, 1, true)
+	c.Text(c.Width-10, top-8, fmt.Sprintf("Difference [%d%% CI]", int(math.Round(r.Confidence*100))), smallSize, AnchorEnd, ColorMuted)
+
+	for i, row := range rows {
+		overall := row == &r.Overall
+		middle := top + rowHeight*(float64(i)+0.5)
+		if overall {
+			c.Line(10, middle-rowHeight/2, c.Width-10, middle-rowHeight/2, ColorAxis, 1, false)
+		}
+		label := Element{Kind: KindText, Points: []Point{{10, middle + 4}}, Text: Truncate(row.Title, textSize, left-24),
+			Size: textSize, Bold: overall, Anchor: AnchorStart, Fill: ColorText}
+		c.Elements = append(c.Elements, label)
+		if row.Welch == nil {
+			c.Text(c.Width-10, middle+4, "too few ratings", smallSize, AnchorEnd, ColorMuted)
+			continue
+		}
+		// Only the per-article p-values form a family that was adjusted
+		p := row.Welch.P
+		if i < len(r.Articles) {
+			p = row.Welch.AdjustedP
+		}
+		fill := ColorMuted
+		switch {
+		case overall:
+			fill = ColorText
+		case p < 1-r.Confidence:
+			fill = Palette[0]
+		}
+		c.Line(x(row.Welch.CILow), middle, x(row.Welch.CIHigh), middle, fill, 2, false)
+		radius := 4.0
+		if overall {
+			radius = 5.5
+		}
+		c.Circle(x(row.Welch.Difference), middle, radius, fill)
+		c.Text(c.Width-10, middle+4, fmt.Sprintf("%.2f [%.2f, %.2f]", row.Welch.Difference, row.Welch.CILow, row.Welch.CIHigh),
+			smallSize, AnchorEnd, ColorText)
+	}
+	c.Line(left, bottom, right, bottom, ColorAxis, 1, false)
+	c.Text((left+right)/2, bottom+36, fmt.Sprintf("%s minus %s, in scale points", r.Treatment.Name, r.Reference.Name),
+		textSize, AnchorMiddle, ColorText)
+	return c
+}
+
+// Enrollment draws how many participants signed in each day and in total so far
+func Enrollment(days []models.DayCount) *Canvas {
+	c := NewCanvas(width, 320, "Enrollment over time")
+	c.Heading("Enrollment over time")
+	if len(days) == 0 {
+		c.Text(c.Width/2, c.Height/2, "Nobody has signed in yet", textSize, AnchorMiddle, ColorMuted)
+		return c
+	}
+	c.legend(headingTop-12, []string{"Signed in so far", "Signed in that day"})
+	left, right, top, bottom := 56.0, c.Width-20, headingTop+16, c.Height-40
+	yTicks := ticks(0, float64(days[len(days)-1].Cumulative), 5)
+	y := func(v float64) float64 {
+		return bottom - (bottom-top)*v/yTicks[len(yTicks)-1]
+	}
+	for _, t := range yTicks {
+		c.Line(left, y(t), right, y(t), ColorGrid, 1, false)
+		c.Text(left-6, y(t)+4, formatTick(t, yTicks), smallSize, AnchorEnd, ColorMuted)
+	}
+	first := days[0].Day
+	span := days[len(days)-1].Day.Sub(first).Hours() / 24
+	slot := (right - left) / (math.Round(span) + 1)
+	x := func(day time.Time) float64 {
+		return left + slot*(math.Round(day.Sub(first).Hours()/24)+0.5)
+	}
+	line := make([]Point, len(days))
+	for i, d := range days {
+		c.Rect(x(d.Day)-slot*0.35, y(float64(d.Count)), slot*0.7, bottom-y(float64(d.Count)), color(1))
+		line[i] = Point{x(d.Day), y(float64(d.Cumulative))}
+	}
+	c.Polyline(line, color(0), 2)
+	for _, p := range line {
+		c.Circle(p.X, p.Y, 3, color(0))
+	}
+	// Label at most eight days so the dates never overlap
+	every := int(math.Ceil((math.Round(span) + 1) / 8))
+	for day := 0; day <= int(math.Round(span)); day += every {
+		date := first.AddDate(0, 0, day)
+		c.Text(x(date), bottom+16, date.Format("Jan 2"), smallSize, AnchorMiddle, ColorMuted)
+	}
+	c.Line(left, bottom, right, bottom, ColorAxis, 1, false)
+	return c
+}
+
+// legend draws a coloured key for each label in a row centred below the heading
+func (c *Canvas) legend(y float64, labels []string) {
+	total := 0.0
+	for _, l := range labels {
+		total += 14 + TextWidth(l, textSize) + 16
+	}
+	x := (c.Width - total) / 2
+	for i, l := range labels {
+		c.Rect(x, y-9, 10, 10, color(i))
+		c.Text(x+14, y, l, textSize, AnchorStart, ColorText)
+		x += 14 + TextWidth(l, textSize) + 16
+	}
+}
+
+func color(i int) string {
+	return Palette[i%len(Palette)]
+}
+
+// ticks picks round axis values covering low to high with about n steps, the first and last bound the axis
+func ticks(low float64, high float64, n int) []float64 {
+	if high <= low {
+		high = low + 1
+	}
+	raw := (high - low) / float64(n)
+	magnitude := math.Pow(10, math.Floor(math.Log10(raw)))
+	step := 10 * magnitude
+	for _, m := range []float64{1, 2, 5} {
+		if raw <= m*magnitude {
+			step = m * magnitude
+			break
+		}
+	}
+	start, end := math.Floor(low/step), math.Ceil(high/step)
+	values := make([]float64, 0, int(end-start)+1)
+	for i := start; i <= end; i++ {
+		values = append(values, i*step)
+	}
+	return values
+}
+
+// formatTick prints an axis value with as many decimals as the step between ticks needs
+func formatTick(v float64, ticks []float64) string {
+	decimals := 0
+	if len(ticks) > 1 {
+		if step := ticks[1] - ticks[0]; step < 1 {
+			decimals = int(math.Ceil(-math.Log10(step) - 1e-9))
+		}
+	}
+	if math.Abs(v) < 1e-9 {
+		v = 0
+	}
+	return strconv.FormatFloat(v, 'f', decimals, 64)
+}
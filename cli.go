@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/superc03/carp/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const usage = `Usage:
+  carp                          start the web server
+  carp roles list               list everyone holding a staff role
+  carp roles grant EMAIL ROLE   grant ROLE (viewer, analyst, study_owner, superadmin) to EMAIL
+  carp roles revoke EMAIL       make EMAIL a plain participant again
+  carp tokens list              list API tokens with their scopes, expiry and last use
+  carp tokens create NAME SCOPES [TTL]
+                                issue an API token for /api/v1, shown only once. SCOPES is a comma
+                                separated list of responses:read, articles:write, participants:write,
+                                TTL a duration such as 720h (default 2160h)
+  carp tokens revoke ID         stop accepting the API token with the given ID
+`
+
+// runCommand executes an administrative command against the database and returns the process exit code
+func runCommand(args []string) int {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(dbUrl))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Could not connect to MongoDB:", err)
+		return 1
+	}
+	defer client.Disconnect(ctx)
+	db := client.Database("carp")
+	vault, err := models.NewIdentityVault(ctx, client.Database(identityDatabase), []byte(identityKey))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Could not open identity vault:", err)
+		return 1
+	}
+
+	switch {
+	case len(args) == 2 && args[0] == "roles" && args[1] == "list":
+		err = listRoles(ctx, db, vault)
+	case len(args) == 4 && args[0] == "roles" && args[1] == "grant":
+		var role models.Role
+		if role, err = models.ParseRole(args[3]); err == nil {
+			err = models.SetRoleByEmail(ctx, db, vault, args[2], role)
+		}
+	case len(args) == 3 && args[0] == "roles" && args[1] == "revoke":
+		err = models.SetRoleByEmail(ctx, db, vault, args[2], models.RoleParticipant)
+	case len(args) == 2 && args[0] == "tokens" && args[1] == "list":
+		err = listTokens(ctx, db)
+	case (len(args) == 4 || len(args) == 5) && args[0] == "tokens" && args[1] == "create":
+		err = createToken(ctx, db, args[2], args[3], args[4:])
+	case len(args) == 3 && args[0] == "tokens" && args[1] == "revoke":
+		var id primitive.ObjectID
+		if id, err = primitive.ObjectIDFromHex(args[2]); err == nil {
+			err = models.RevokeAPIToken(ctx, db, id)
+		}
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return 1
+	}
+	return 0
+}
+
+func listRoles(ctx context.Context, db *mongo.Database, vault *models.IdentityVault) error {
+	staff, err := models.StaffUsers(ctx, db, vault)
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "EMAIL\tROLE")
+	for _, u := range staff {
+		fmt.Fprintf(tw, "%s\t%s\n", u.Email, u.Role)
+	}
+	return tw.Flush()
+}
+
+func createToken(ctx context.Context, db *mongo.Database, name string, scopeList string, ttlArg []string) error {
+	scopes, err := models.ParseScopes(scopeList)
+	if err != nil {
+		return err
+	}
+	ttl := models.DefaultAPITokenTTL
+	if len(ttlArg) == 1 {
+		if ttl, err = time.ParseDuration(ttlArg[0]); err != nil || ttl <= 0 {
+			return fmt.Errorf("invalid TTL `%s`", ttlArg[0])
+		}
+	}
+	plain, token, err := models.CreateAPIToken(ctx, db, name, scopes, ttl, nil)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Created token %s, valid until %s. It will not be shown again:\n", token.ID.Hex(), token.ExpiresOn.Format(time.RFC3339))
+	fmt.Println(plain)
+	return nil
+}
+
+func listTokens(ctx context.Context, db *mongo.Database) error {
+	tokens, err := models.ListAPITokens(ctx, db)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tNAME\tSCOPES\tEXPIRES\tLAST USED\tSTATE")
+	for _, t := range tokens {
+		scopes := make([]string, len(t.Scopes))
+		for i, s := range t.Scopes {
+			scopes[i] = string(s)
+		}
+		lastUsed := "never"
+		if t.LastUsedOn != nil {
+			lastUsed = t.LastUsedOn.Format(time.RFC3339)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", t.ID.Hex(), t.Name, strings.Join(scopes, ","), t.ExpiresOn.Format(time.RFC3339), lastUsed, t.State(now))
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,47 @@
+package export
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// binaryWriter writes little-endian values, remembering the first error so callers can check once at the end
+type binaryWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (b *binaryWriter) write(v interface{}) {
+	if b.err != nil {
+		return
+	}
+	b.err = binary.Write(b.w, binary.LittleEndian, v)
+	if b.err == nil {
+		b.n += int64(binary.Size(v))
+	}
+}
+
+func (b *binaryWriter) bytes(p []byte) {
+	if b.err != nil {
+		return
+	}
+	var n int
+	n, b.err = b.w.Write(p)
+	b.n += int64(n)
+}
+
+func (b *binaryWriter) str(s string) {
+	b.bytes([]byte(s))
+}
+
+// fixed writes s into a field of exactly n bytes, truncating it or filling the rest with pad
+func (b *binaryWriter) fixed(s string, n int, pad byte) {
+	s = truncate(s, n)
+	p := make([]byte, n)
+	copy(p, s)
+	for i := len(s); i < n; i++ {
+		p[i] = pad
+	}
+	b.bytes(p)
+}
@@ -0,0 +1,223 @@
+package export
+
+import (
+	"time"
+
+	"github.com/superc03/carp/models"
+)
+
+// Codebook documents every variable of every export layout along with the study it comes from
+type Codebook struct {
+	Study        *models.Study     `json:"study"`
+	ExportedOn   time.Time         `json:"exported_on"`
+	Filter       string            `json:"filter,omitempty"`
+	Participants int               `json:"participants"`
+	Articles     []CodebookArticle `json:"articles"`
+	Layouts      []CodebookLayout  `json:"layouts"`
+}
+
+// CodebookArticle describes an article participants rated
+type CodebookArticle struct {
+	ID          string          `json:"id"`
+	Title       string          `json:"title"`
+	PictureCode string          `json:"picture_code"`
+	Veracity    models.Veracity `json:"veracity,omitempty"`
+	Source      string          `json:"source,omitempty"`
+	Topic       string          `json:"topic,omitempty"`
+	Lean        models.Lean     `json:"lean,omitempty"`
+	Variable    string          `json:"variable"`
+}
+
+// CodebookLayout is a set of columns shared by one or more export files
+type CodebookLayout struct {
+	Name        string             `json:"name"`
+	Description string             `json:"description"`
+	Files       []string           `json:"files"`
+	Variables   []CodebookVariable `json:"variables"`
+}
+
+// CodebookVariable describes a single column
+type CodebookVariable struct {
+	Name      string          `json:"name"`
+	Label     string          `json:"label"`
+	Type      string          `json:"type"`
+	Measure   string          `json:"measure"`
+	Values    []CodebookValue `json:"values,omitempty"`
+	Missing   string          `json:"missing,omitempty"`
+	ArticleID string          `json:"article_id,omitempty"`
+}
+
+// CodebookValue is an allowed value and its meaning
+type CodebookValue struct {
+	Value interface{} `json:"value"`
+	Label string      `json:"label"`
+}
+
+// Export layouts described by the codebook
+const (
+	LayoutWide     = "Wide CSV"
+	LayoutLabelled = "Labelled wide"
+	LayoutLong     = "Long"
+)
+
+// Codebook variable types
+const (
+	TypeString   = "string"
+	TypeInteger  = "integer"
+	TypeNumber   = "number"
+	TypeBoolean  = "boolean"
+	TypeDateTime = "datetime"
+)
+
+// NewCodebook documents the exports of a dataset
+func NewCodebook(d *models.Dataset) *Codebook {
+	c := &Codebook{
+		Study:        d.Study,
+		ExportedOn:   d.ExportedOn,
+		Filter:       d.Filter.String(),
+		Participants: len(d.Participants),
+		Articles:     make([]CodebookArticle, len(d.Articles)),
+	}
+	byVariable := map[string]*CodebookArticle{}
+	for i, a := range d.Articles {
+		c.Articles[i] = CodebookArticle{
+			ID:          a.ID.Hex(),
+			Title:       a.Title,
+			PictureCode: a.PictureCode,
+			Veracity:    a.Veracity,
+			Source:      a.Source,
+			Topic:       a.Topic,
+			Lean:        a.Lean,
+			Variable:    ArticleVariable(a),
+		}
+		byVariable[ArticleVariable(a)] = &c.Articles[i]
+	}
+	scale := make([]CodebookValue, len(d.Study.Scale.Anchors))
+	for i, a := range d.Study.Scale.Anchors {
+		scale[i] = CodebookValue{Value: a.Value, Label: a.Label}
+	}
+	rating := func(article *CodebookArticle, name string) CodebookVariable {
+		return CodebookVariable{
+			Name:      name,
+			Label:     article.Title,
+			Type:      TypeInteger,
+			Measure:   MeasureOrdinal.String(),
+			Values:    scale,
+			Missing:   "empty when the participant has not rated the article",
+			ArticleID: article.ID,
+		}
+	}
+
+	wide := CodebookLayout{
+		Name:        LayoutWide,
+		Description: "One row per participant with a column per article, headed by the article's ID.",
+		Files:       []string{"statistics.csv"},
+	}
+	imagePresent := CodebookVariable{
+		Name:    "imagePresent",
+		Label:   "Whether the participant saw pictures next to the headlines",
+		Type:    TypeBoolean,
+		Measure: MeasureNominal.String(),
+	}
+	for _, cond := range d.Study.Conditions {
+		imagePresent.Values = append(imagePresent.Values, CodebookValue{Value: cond.ShowsImage(), Label: cond.Name + " condition"})
+	}
+	wide.Variables = append(wide.Variables, imagePresent)
+	for i := range c.Articles {
+		wide.Variables = append(wide.Variables, rating(&c.Articles[i], c.Articles[i].ID))
+	}
+	excluded := CodebookVariable{
+		Name:    "excluded",
+		Label:   "Whether an admin excluded the participant from analysis",
+		Type:    TypeBoolean,
+		Measure: MeasureNominal.String(),
+		Values:  []CodebookValue{{Value: false, Label: "Included"}, {Value: true, Label: "Excluded"}},
+	}
+	if d.Filter.IncludeExcluded {
+		wide.Variables = append(wide.Variables, excluded)
+	}
+	table := WideTable(d)
+	for _, name := range wideCSVColumns {
+		for _, v := range table.Variables {
+			if v.Name == name {
+				wide.Variables = append(wide.Variables, tableVariable(v))
+			}
+		}
+	}
+
+	labelled := CodebookLayout{
+		Name:        LayoutLabelled,
+		Description: "One row per participant with a column per article, carrying variable and value labels.",
+		Files:       []string{"responses.sav", "responses.dta", "responses.xlsx (Responses sheet)"},
+	}
+	for _, v := range table.Variables {
+		if article, ok := byVariable[v.Name]; ok {
+			labelled.Variables = append(labelled.Variables, rating(article, v.Name))
+			continue
+		}
+		labelled.Variables = append(labelled.Variables, tableVariable(v))
+	}
+
+	conditions := make([]CodebookValue, len(d.Study.Conditions))
+	for i, cond := range d.Study.Conditions {
+		conditions[i] = CodebookValue{Value: cond.Code, Label: cond.Name}
+	}
+	articleIDs := make([]CodebookValue, len(c.Articles))
+	for i, a := range c.Articles {
+		articleIDs[i] = CodebookValue{Value: a.ID, Label: a.Title}
+	}
+	long := CodebookLayout{
+		Name:        LayoutLong,
+		Description: "One row per participant and rated article.",
+		Files:       []string{"responses_long.csv", "responses_long.jsonl"},
+		Variables: []CodebookVariable{
+			{Name: "pseudonym", Label: "Participant pseudonym", Type: TypeString, Measure: MeasureNominal.String()},
+			{Name: "condition", Label: "Experimental condition", Type: TypeString, Measure: MeasureNominal.String(), Values: conditions},
+			{Name: "article_id", Label: "ID of the rated article", Type: TypeString, Measure: MeasureNominal.String(), Values: articleIDs},
+			{Name: "article_title", Label: "Headline of the rated article", Type: TypeString, Measure: MeasureNominal.String()},
+			{Name: "dimension", Label: "What the rating measures", Type: TypeString, Measure: MeasureNominal.String(),
+				Values: []CodebookValue{{Value: d.Study.Dimension, Label: "Rating of the article's " + d.Study.Dimension}}},
+			{Name: "value", Label: "Rating", Type: TypeInteger, Measure: MeasureOrdinal.String(), Values: scale},
+			{Name: "order_index", Label: "Position of the article in the participant's survey, starting at 1", Type: TypeInteger,
+				Measure: MeasureOrdinal.String(), Missing: "empty for ratings given before positions were recorded"},
+			{Name: "shown_on", Label: "When the article was first shown (UTC, RFC 3339)", Type: TypeDateTime,
+				Measure: MeasureScale.String(), Missing: "empty for ratings given before display times were recorded"},
+			{Name: "rated_on", Label: "When the rating was submitted (UTC, RFC 3339)", Type: TypeDateTime,
+				Measure: MeasureScale.String(), Missing: "empty for ratings given before rating times were recorded"},
+			{Name: "article_veracity", Label: "Whether the rated headline is true", Type: TypeString, Measure: MeasureNominal.String(),
+				Values:  []CodebookValue{{Value: models.VeracityTrue, Label: "True headline"}, {Value: models.VeracityFalse, Label: "False headline"}},
+				Missing: "empty for articles that have not been labelled"},
+		},
+	}
+
+	if d.Filter.IncludeExcluded {
+		long.Variables = append(long.Variables, excluded)
+	}
+
+	c.Layouts = []CodebookLayout{wide, labelled, long}
+	return c
+}
+
+// tableVariable documents a variable of WideTable
+func tableVariable(v Variable) CodebookVariable {
+	cv := CodebookVariable{Name: v.Name, Label: v.Label, Type: TypeInteger, Measure: v.Measure.String(), Missing: v.Missing}
+	if !v.Numeric() {
+		cv.Type = TypeString
+	} else if v.Decimals > 0 {
+		cv.Type = TypeNumber
+	}
+	for _, vl := range v.ValueLabels {
+		cv.Values = append(cv.Values, CodebookValue{Value: vl.Value, Label: vl.Label})
+	}
+	return cv
+}
+
+// Layout returns the layout with the given name, or nil
+func (c *Codebook) Layout(name string) *CodebookLayout {
+	for i := range c.Layouts {
+		if c.Layouts[i].Name == name {
+			return &c.Layouts[i]
+		}
+	}
+	return nil
+}
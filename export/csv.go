@@ -0,0 +1,108 @@
+package export
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/superc03/carp/models"
+)
+
+// wideCSVColumns are the WideTable variables `/statistics.csv` carries after the ratings, in order. Each is left out
+// whenever WideTable leaves it out.
+var wideCSVColumns = []string{
+	"discernment", "d_prime", "criterion",
+	"duration_seconds", "fast_items", "rating_sd", "checks_failed", "shared_devices", "quality_flags", "flagged",
+}
+
+// WideCSV lays out the dataset as `/statistics.csv`: whether the participant saw images, a column per article headed
+// by its ID and `excluded` when the filter includes excluded participants. Participants' discernment follows once
+// articles are labelled true and false, then their quality indicators and flags. New columns are only ever
+// appended, so scripts reading the export by position keep working.
+func WideCSV(d *models.Dataset) ([]string, [][]string) {
+	table := WideTable(d)
+	index := make(map[string]int, len(table.Variables))
+	for i, v := range table.Variables {
+		index[v.Name] = i
+	}
+	header := []string{"imagePresent"}
+	for _, a := range d.Articles {
+		header = append(header, a.ID.Hex())
+	}
+	if d.Filter.IncludeExcluded {
+		header = append(header, "excluded")
+	}
+	extra := make([]int, 0, len(wideCSVColumns))
+	for _, name := range wideCSVColumns {
+		if i, ok := index[name]; ok {
+			header = append(header, name)
+			extra = append(extra, i)
+		}
+	}
+	records := make([][]string, len(d.Participants))
+	for p, u := range d.Participants {
+		row := table.Rows[p]
+		record := make([]string, 0, len(header))
+		record = append(record, strconv.FormatBool(u.SurveyType == models.SurveyWithImage))
+		for _, a := range d.Articles {
+			record = append(record, formatCell(row[index[ArticleVariable(a)]]))
+		}
+		if d.Filter.IncludeExcluded {
+			record = append(record, strconv.FormatBool(u.Excluded))
+		}
+		for _, i := range extra {
+			record = append(record, formatCell(row[i]))
+		}
+		records[p] = record
+	}
+	return header, records
+}
+
+// formatCell formats a Table cell as a CSV field, leaving missing values empty
+func formatCell(cell interface{}) string {
+	switch v := cell.(type) {
+	case string:
+		return v
+	case int:
+		return strconv.Itoa(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return ""
+}
+
+// LongRecord formats a long format row as CSV fields in the order of models.LongColumns, followed by `excluded` when
+// it is set
+func LongRecord(row models.LongRow) []string {
+	record := []string{
+		row.Pseudonym,
+		row.Condition,
+		row.ArticleID,
+		row.ArticleTitle,
+		row.Dimension,
+		strconv.Itoa(row.Value),
+		FormatInt(row.OrderIndex),
+		FormatTime(row.ShownOn),
+		FormatTime(row.RatedOn),
+		string(row.ArticleVeracity),
+	}
+	if row.Excluded != nil {
+		record = append(record, strconv.FormatBool(*row.Excluded))
+	}
+	return record
+}
+
+// FormatInt formats an optional number, leaving missing values empty
+func FormatInt(v *int) string {
+	if v == nil {
+		return ""
+	}
+	return strconv.Itoa(*v)
+}
+
+// FormatTime formats an optional time as an RFC 3339 UTC timestamp, leaving missing values empty
+func FormatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,69 @@
+package export
+
+import "testing"
+
+func TestWideCSV(t *testing.T) {
+	tests := []struct {
+		name            string
+		includeExcluded bool
+	}{
+		{"included only", false},
+		{"with excluded", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := testDataset(tt.includeExcluded)
+			header, records := WideCSV(d)
+
+			layout := NewCodebook(d).Layout(LayoutWide)
+			if len(layout.Variables) != len(header) {
+				t.Fatalf("header %v has %d columns, the codebook documents %d", header, len(header), len(layout.Variables))
+			}
+			columns := map[string]int{}
+			for i, v := range layout.Variables {
+				if header[i] != v.Name {
+					t.Errorf("column %d is %q, the codebook documents %q", i, header[i], v.Name)
+				}
+				columns[header[i]] = i
+			}
+			if len(records) != len(d.Participants) {
+				t.Fatalf("%d records for %d participants", len(records), len(d.Participants))
+			}
+			for p, record := range records {
+				if len(record) != len(header) {
+					t.Fatalf("record %d has %d fields for %d columns", p, len(record), len(header))
+				}
+			}
+
+			// Only the first two participants rated both a true and a false article
+			for _, name := range []string{"discernment", "d_prime", "criterion"} {
+				i, ok := columns[name]
+				if !ok {
+					t.Errorf("column %s is missing", name)
+					continue
+				}
+				for p, want := range []bool{true, true, false} {
+					if got := records[p][i] != ""; got != want {
+						t.Errorf("participant %d has %s %q", p, name, records[p][i])
+					}
+				}
+			}
+
+			// The first participant raised no quality flag, the second straight-lined
+			for _, name := range []string{"duration_seconds", "fast_items", "rating_sd", "shared_devices", "quality_flags", "flagged"} {
+				if _, ok := columns[name]; !ok {
+					t.Errorf("column %s is missing", name)
+				}
+			}
+			if _, ok := columns["checks_failed"]; ok {
+				t.Error("column checks_failed is present without attention checks")
+			}
+			flags, flagged := columns["quality_flags"], columns["flagged"]
+			for p, want := range [][2]string{{"", "0"}, {"straight_lining", "1"}} {
+				if got := [2]string{records[p][flags], records[p][flagged]}; got != want {
+					t.Errorf("participant %d has quality flags %q, want %q", p, got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,305 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/superc03/carp/models"
+)
+
+// File is an additional file stored alongside the data package, such as a rendered codebook
+type File struct {
+	Name string
+	Data []byte
+}
+
+// tableField is a Table Schema field descriptor
+type tableField struct {
+	Name        string                 `json:"name"`
+	Title       string                 `json:"title,omitempty"`
+	Description string                 `json:"description,omitempty"`
+	Type        string                 `json:"type"`
+	Constraints map[string]interface{} `json:"constraints,omitempty"`
+}
+
+type tableForeignKey struct {
+	Fields    string `json:"fields"`
+	Reference struct {
+		Resource string `json:"resource"`
+		Fields   string `json:"fields"`
+	} `json:"reference"`
+}
+
+type tableSchema struct {
+	Fields        []tableField      `json:"fields"`
+	PrimaryKey    []string          `json:"primaryKey,omitempty"`
+	ForeignKeys   []tableForeignKey `json:"foreignKeys,omitempty"`
+	MissingValues []string          `json:"missingValues"`
+}
+
+type dataResource struct {
+	Profile   string      `json:"profile"`
+	Name      string      `json:"name"`
+	Path      string      `json:"path"`
+	Title     string      `json:"title"`
+	Format    string      `json:"format"`
+	Mediatype string      `json:"mediatype"`
+	Encoding  string      `json:"encoding"`
+	Bytes     int         `json:"bytes"`
+	Hash      string      `json:"hash"`
+	Schema    tableSchema `json:"schema"`
+	rows      [][]string
+}
+
+type dataPackage struct {
+	Profile      string              `json:"profile"`
+	Name         string              `json:"name"`
+	Title        string              `json:"title"`
+	Description  string              `json:"description"`
+	Created      string              `json:"created"`
+	Contributors []map[string]string `json:"contributors,omitempty"`
+	Keywords     []string            `json:"keywords"`
+	Carp         map[string]string   `json:"carp"`
+	Resources    []*dataResource     `json:"resources"`
+}
+
+var packageNameInvalid = regexp.MustCompile(`[^a-z0-9._-]+`)
+
+// WriteDataPackage writes the dataset as a zipped Frictionless tabular data package: participants, articles and
+// responses in long and wide layout as CSV resources with Table Schemas, `datapackage.json`, the extra files and a
+// `checksums.sha256` manifest covering everything else in the archive
+func WriteDataPackage(w io.Writer, d *models.Dataset, extras ...File) error {
+	codebook := NewCodebook(d)
+	pkg := &dataPackage{
+		Profile:     "tabular-data-package",
+		Name:        strings.Trim(packageNameInvalid.ReplaceAllString(strings.NewReplacer("'", "", "’", "").Replace(strings.ToLower(d.Study.Title)), "-"), "-"),
+		Title:       d.Study.Title,
+		Description: d.Study.Description,
+		Created:     d.ExportedOn.UTC().Format(time.RFC3339),
+		Keywords:    []string{d.Study.Dimension, "survey", "likert"},
+		Carp: map[string]string{
+			"study":  d.Study.ID,
+			"filter": d.Filter.String(),
+		},
+	}
+	if pkg.Name == "" {
+		pkg.Name = "carp-study"
+	}
+	if d.Study.Investigator != "" {
+		pkg.Contributors = []map[string]string{{"title": d.Study.Investigator, "role": "author"}}
+	}
+	pkg.Resources = []*dataResource{
+		participantsResource(d),
+		articlesResource(d),
+		longResource(d, codebook.Layout(LayoutLong)),
+		wideResource(d, codebook.Layout(LayoutLabelled)),
+	}
+
+	files := make([]File, 0, len(pkg.Resources)+len(extras)+1)
+	for _, res := range pkg.Resources {
+		buf := &bytes.Buffer{}
+		cw := csv.NewWriter(buf)
+		header := make([]string, len(res.Schema.Fields))
+		for i, f := range res.Schema.Fields {
+			header[i] = f.Name
+		}
+		if err := cw.Write(header); err != nil {
+			return err
+		}
+		if err := cw.WriteAll(res.rows); err != nil {
+			return err
+		}
+		sum := sha256.Sum256(buf.Bytes())
+		res.Bytes = buf.Len()
+		res.Hash = "sha256:" + hex.EncodeToString(sum[:])
+		files = append(files, File{Name: res.Path, Data: buf.Bytes()})
+	}
+	descriptor, err := json.MarshalIndent(pkg, "", "  ")
+	if err != nil {
+		return err
+	}
+	files = append(files, File{Name: "datapackage.json", Data: descriptor})
+	files = append(files, extras...)
+
+	manifest := &strings.Builder{}
+	for _, f := range files {
+		sum := sha256.Sum256(f.Data)
+		fmt.Fprintf(manifest, "%s  %s\n", hex.EncodeToString(sum[:]), f.Name)
+	}
+	files = append(files, File{Name: "checksums.sha256", Data: []byte(manifest.String())})
+
+	zw := zip.NewWriter(w)
+	for _, f := range files {
+		fw, err := zw.CreateHeader(&zip.FileHeader{Name: f.Name, Method: zip.Deflate, Modified: d.ExportedOn})
+		if err != nil {
+			return err
+		}
+		if _, err = fw.Write(f.Data); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+func newResource(name string, title string, fields []tableField) *dataResource {
+	return &dataResource{
+		Profile:   "tabular-data-resource",
+		Name:      name,
+		Path:      "data/" + name + ".csv",
+		Title:     title,
+		Format:    "csv",
+		Mediatype: "text/csv",
+		Encoding:  "utf-8",
+		Schema:    tableSchema{Fields: fields, MissingValues: []string{""}},
+		rows:      make([][]string, 0),
+	}
+}
+
+func foreignKey(field string, resource string) tableForeignKey {
+	fk := tableForeignKey{Fields: field}
+	fk.Reference.Resource = resource
+	fk.Reference.Fields = field
+	return fk
+}
+
+func conditionCodes(d *models.Dataset) []interface{} {
+	codes := make([]interface{}, len(d.Study.Conditions))
+	for i, c := range d.Study.Conditions {
+		codes[i] = c.Code
+	}
+	return codes
+}
+
+func participantsResource(d *models.Dataset) *dataResource {
+	required := map[string]interface{}{"required": true}
+	res := newResource("participants", "Participants", []tableField{
+		{Name: "pseudonym", Title: "Participant pseudonym", Type: "string", Constraints: map[string]interface{}{"required": true, "unique": true}},
+		{Name: "condition", Title: "Experimental condition", Type: "string", Constraints: map[string]interface{}{"required": true, "enum": conditionCodes(d)}},
+		{Name: "status", Title: "How far the participant got through the survey", Type: "string",
+			Constraints: map[string]interface{}{"required": true, "enum": []string{models.StatusNotStarted, models.StatusStarted, models.StatusCompleted}}},
+		{Name: "responses", Title: "Number of rated articles", Type: "integer", Constraints: map[string]interface{}{"required": true, "minimum": 0}},
+		{Name: "created_on", Title: "When the participant first signed in", Type: "datetime", Constraints: required},
+		{Name: "started_on", Title: "When the first rating was submitted", Type: "datetime"},
+		{Name: "completed_on", Title: "When the last rating was submitted", Type: "datetime"},
+	})
+	if d.Filter.IncludeExcluded {
+		reasons := make([]string, len(models.ExclusionReasons))
+		for i, r := range models.ExclusionReasons {
+			reasons[i] = string(r)
+		}
+		res.Schema.Fields = append(res.Schema.Fields,
+			tableField{Name: "excluded", Title: "Whether an admin excluded the participant from analysis", Type: "boolean", Constraints: required},
+			tableField{Name: "exclusion_reason", Title: "Why the participant was excluded", Type: "string",
+				Constraints: map[string]interface{}{"enum": reasons}},
+		)
+	}
+	res.Schema.PrimaryKey = []string{"pseudonym"}
+	for _, u := range d.Participants {
+		created := u.CreatedOn
+		record := []string{
+			u.Pseudonym,
+			models.ConditionCode(u.SurveyType),
+			u.Status(d.SurveyLength()),
+			strconv.Itoa(len(u.Data)),
+			FormatTime(&created),
+			FormatTime(u.StartedOn),
+			FormatTime(u.CompletedOn),
+		}
+		if d.Filter.IncludeExcluded {
+			record = append(record, strconv.FormatBool(u.Excluded), u.ExclusionCode())
+		}
+		res.rows = append(res.rows, record)
+	}
+	return res
+}
+
+func articlesResource(d *models.Dataset) *dataResource {
+	res := newResource("articles", "Articles", []tableField{
+		{Name: "article_id", Title: "Article ID", Type: "string", Constraints: map[string]interface{}{"required": true, "unique": true}},
+		{Name: "variable", Title: "Name of the article's column in the wide responses", Type: "string", Constraints: map[string]interface{}{"required": true}},
+		{Name: "title", Title: "Headline shown to participants", Type: "string", Constraints: map[string]interface{}{"required": true}},
+		{Name: "picture_code", Title: "Google Drive ID of the picture shown in image conditions", Type: "string"},
+		{Name: "veracity", Title: "Whether the headline is true", Type: "string",
+			Constraints: map[string]interface{}{"enum": []models.Veracity{models.VeracityTrue, models.VeracityFalse}}},
+		{Name: "source", Title: "Outlet the article was published by", Type: "string"},
+		{Name: "topic", Title: "What the article is about", Type: "string"},
+		{Name: "lean", Title: "Political lean of the article", Type: "string", Constraints: map[string]interface{}{"enum": models.Leans}},
+	})
+	res.Schema.PrimaryKey = []string{"article_id"}
+	for _, a := range d.Articles {
+		res.rows = append(res.rows, []string{
+			a.ID.Hex(), ArticleVariable(a), a.Title, a.PictureCode, string(a.Veracity), a.Source, a.Topic, string(a.Lean),
+		})
+	}
+	return res
+}
+
+func longResource(d *models.Dataset, layout *CodebookLayout) *dataResource {
+	res := newResource("responses", "Responses, one row per participant and rated article", codebookFields(layout))
+	res.Schema.PrimaryKey = []string{"pseudonym", "article_id"}
+	res.Schema.ForeignKeys = []tableForeignKey{foreignKey("pseudonym", "participants"), foreignKey("article_id", "articles")}
+	for _, row := range d.LongRows() {
+		res.rows = append(res.rows, LongRecord(row))
+	}
+	return res
+}
+
+func wideResource(d *models.Dataset, layout *CodebookLayout) *dataResource {
+	res := newResource("responses_wide", "Responses, one row per participant with a column per article", codebookFields(layout))
+	res.Schema.PrimaryKey = []string{"pseudonym"}
+	res.Schema.ForeignKeys = []tableForeignKey{foreignKey("pseudonym", "participants")}
+	for _, row := range WideTable(d).Rows {
+		record := make([]string, len(row))
+		for i, cell := range row {
+			record[i] = formatCell(cell)
+		}
+		res.rows = append(res.rows, record)
+	}
+	return res
+}
+
+// codebookFields converts a codebook layout into Table Schema fields, turning allowed values into constraints
+func codebookFields(layout *CodebookLayout) []tableField {
+	fields := make([]tableField, len(layout.Variables))
+	for i, v := range layout.Variables {
+		f := tableField{Name: v.Name, Title: v.Label, Description: v.Missing, Type: v.Type}
+		if v.Missing == "" {
+			f.Constraints = map[string]interface{}{"required": true}
+		}
+		if len(v.Values) > 0 {
+			if f.Constraints == nil {
+				f.Constraints = map[string]interface{}{}
+			}
+			if v.Type == TypeInteger {
+				values := make([]int, 0, len(v.Values))
+				for _, cv := range v.Values {
+					if n, ok := cv.Value.(int); ok {
+						values = append(values, n)
+					}
+				}
+				sort.Ints(values)
+				f.Constraints["minimum"] = values[0]
+				f.Constraints["maximum"] = values[len(values)-1]
+			} else {
+				enum := make([]interface{}, len(v.Values))
+				for j, cv := range v.Values {
+					enum[j] = cv.Value
+				}
+				f.Constraints["enum"] = enum
+			}
+		}
+		fields[i] = f
+	}
+	return fields
+}
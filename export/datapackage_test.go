@@ -0,0 +1,115 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/superc03/carp/analysis"
+	"github.com/superc03/carp/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// testDataset has one participant raising no quality flag, one straight-lining and one who has not rated anything
+func testDataset(includeExcluded bool) *models.Dataset {
+	study := models.DefaultStudy
+	articles := []models.Article{
+		{ID: primitive.NewObjectID(), Title: "First headline", Veracity: models.VeracityTrue},
+		{ID: primitive.NewObjectID(), Title: "Second headline", Veracity: models.VeracityFalse},
+		{ID: primitive.NewObjectID(), Title: "Third headline"},
+	}
+	created := time.Date(2022, 3, 1, 9, 0, 0, 0, time.UTC)
+	rows := [][]int32{{1, 3, 5}, {3, 3, 3}, nil}
+	participants := make([]models.User, len(rows))
+	for i, row := range rows {
+		data := bson.M{}
+		for j, v := range row {
+			data[articles[j].ID.Hex()] = v
+		}
+		participants[i] = models.User{
+			Pseudonym:  []string{"amber-otter", "brisk-heron", "calm-lynx"}[i],
+			Role:       models.RoleParticipant,
+			SurveyType: study.Conditions[i%2].SurveyType,
+			Data:       data,
+			CreatedOn:  created,
+		}
+	}
+	return &models.Dataset{
+		Study:        &study,
+		Articles:     articles,
+		Participants: participants,
+		Filter:       models.ParticipantFilter{IncludeExcluded: includeExcluded},
+		ExportedOn:   time.Date(2022, 3, 14, 15, 9, 26, 0, time.UTC),
+	}
+}
+
+func TestWriteDataPackageRequiredFields(t *testing.T) {
+	tests := []struct {
+		name            string
+		includeExcluded bool
+	}{
+		{"included only", false},
+		{"with excluded", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := testDataset(tt.includeExcluded)
+			if q := analysis.AssessQuality(d)[0]; q.Flagged() {
+				t.Fatalf("the first participant raised %v, want no quality flag", q.Flags)
+			}
+			var buf bytes.Buffer
+			if err := WriteDataPackage(&buf, d); err != nil {
+				t.Fatal(err)
+			}
+			zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			files := map[string][]byte{}
+			for _, f := range zr.File {
+				rc, err := f.Open()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if files[f.Name], err = ioutil.ReadAll(rc); err != nil {
+					t.Fatal(err)
+				}
+				rc.Close()
+			}
+			var pkg dataPackage
+			if err = json.Unmarshal(files["datapackage.json"], &pkg); err != nil {
+				t.Fatal(err)
+			}
+			if len(pkg.Resources) != 4 {
+				t.Fatalf("package has %d resources, want 4", len(pkg.Resources))
+			}
+			for _, res := range pkg.Resources {
+				records, err := csv.NewReader(bytes.NewReader(files[res.Path])).ReadAll()
+				if err != nil {
+					t.Fatalf("%s: %v", res.Path, err)
+				}
+				if len(records) == 0 || len(records[0]) != len(res.Schema.Fields) {
+					t.Fatalf("%s has a header of %v for %d fields", res.Path, records, len(res.Schema.Fields))
+				}
+				for i, f := range res.Schema.Fields {
+					if records[0][i] != f.Name {
+						t.Errorf("%s column %d is %q, want %q", res.Path, i, records[0][i], f.Name)
+					}
+					if required, _ := f.Constraints["required"].(bool); !required {
+						continue
+					}
+					for r, record := range records[1:] {
+						if record[i] == "" {
+							t.Errorf("%s row %d leaves required field %s empty", res.Path, r+1, f.Name)
+						}
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,207 @@
+package export
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+)
+
+// Stata 14+ (format 118) constants, see `help dta` in Stata
+const (
+	dtaMaxStringWidth = 2045
+	dtaMaxName        = 32
+	dtaMaxLabel       = 80
+	dtaNameField      = 129
+	dtaFormatField    = 57
+	dtaLabelField     = 321
+	dtaTypeDouble     = 65526
+)
+
+// dtaMissing is Stata's `.` missing value for doubles
+var dtaMissing = math.Float64frombits(0x7fe0000000000000)
+
+// WriteDTA writes the table as a Stata 14+ dataset with UTF-8 text, variable and value labels. Stata has no notion
+// of measurement levels, they are kept as a `measure` characteristic of each variable.
+func WriteDTA(w io.Writer, t *Table) error {
+	sets := labelSets(t.Variables)
+	labelNames := make([]string, len(t.Variables))
+	for _, set := range sets {
+		for _, i := range set.vars {
+			labelNames[i] = set.name
+		}
+	}
+	for _, v := range t.Variables {
+		if v.Width > dtaMaxStringWidth {
+			return fmt.Errorf("variable %s is wider than %d bytes", v.Name, dtaMaxStringWidth)
+		}
+		if len(v.Name) > dtaMaxName {
+			return fmt.Errorf("variable name %s is longer than %d characters", v.Name, dtaMaxName)
+		}
+	}
+
+	// Stata needs the offset of every section up front, so the file is assembled in memory and the map patched in
+	buf := &bytes.Buffer{}
+	b := &binaryWriter{w: buf}
+	offsets := make([]uint64, 14)
+	mark := func(i int) {
+		offsets[i] = uint64(b.n)
+	}
+
+	b.str("<stata_dta><header><release>118</release><byteorder>LSF</byteorder>")
+	b.str("<K>")
+	b.write(uint16(len(t.Variables)))
+	b.str("</K><N>")
+	b.write(uint64(len(t.Rows)))
+	b.str("</N><label>")
+	label := truncate(truncateRunes(t.Label, dtaMaxLabel), 4*dtaMaxLabel)
+	b.write(uint16(len(label)))
+	b.str(label)
+	b.str("</label><timestamp>")
+	timestamp := t.Created.Format("02 Jan 2006 15:04")
+	b.write(uint8(len(timestamp)))
+	b.str(timestamp)
+	b.str("</timestamp></header>")
+
+	mark(1)
+	b.str("<map>")
+	mapStart := b.n
+	b.write(offsets)
+	b.str("</map>")
+
+	mark(2)
+	b.str("<variable_types>")
+	for _, v := range t.Variables {
+		if v.Numeric() {
+			b.write(uint16(dtaTypeDouble))
+		} else {
+			b.write(uint16(v.Width))
+		}
+	}
+	b.str("</variable_types>")
+
+	mark(3)
+	b.str("<varnames>")
+	for _, v := range t.Variables {
+		b.fixed(v.Name, dtaNameField, 0)
+	}
+	b.str("</varnames>")
+
+	mark(4)
+	b.str("<sortlist>")
+	b.write(make([]uint16, len(t.Variables)+1))
+	b.str("</sortlist>")
+
+	mark(5)
+	b.str("<formats>")
+	for _, v := range t.Variables {
+		if v.Numeric() && v.Decimals > 0 {
+			b.fixed("%9."+strconv.Itoa(v.Decimals)+"f", dtaFormatField, 0)
+		} else if v.Numeric() {
+			b.fixed("%9.0g", dtaFormatField, 0)
+		} else {
+			b.fixed("%-"+strconv.Itoa(v.Width)+"s", dtaFormatField, 0)
+		}
+	}
+	b.str("</formats>")
+
+	mark(6)
+	b.str("<value_label_names>")
+	for i := range t.Variables {
+		b.fixed(labelNames[i], dtaNameField, 0)
+	}
+	b.str("</value_label_names>")
+
+	mark(7)
+	b.str("<variable_labels>")
+	for _, v := range t.Variables {
+		b.fixed(truncateRunes(v.Label, dtaMaxLabel), dtaLabelField, 0)
+	}
+	b.str("</variable_labels>")
+
+	mark(8)
+	b.str("<characteristics>")
+	for _, v := range t.Variables {
+		contents := v.Measure.String() + "\x00"
+		b.str("<ch>")
+		b.write(uint32(2*dtaNameField + len(contents)))
+		b.fixed(v.Name, dtaNameField, 0)
+		b.fixed("measure", dtaNameField, 0)
+		b.str(contents)
+		b.str("</ch>")
+	}
+	b.str("</characteristics>")
+
+	mark(9)
+	b.str("<data>")
+	for _, row := range t.Rows {
+		for i, v := range t.Variables {
+			if !v.Numeric() {
+				s, _ := row[i].(string)
+				b.fixed(s, v.Width, 0)
+				continue
+			}
+			value, ok, err := number(row[i])
+			if err != nil {
+				return err
+			}
+			if !ok {
+				value = dtaMissing
+			}
+			b.write(value)
+		}
+	}
+	b.str("</data>")
+
+	mark(10)
+	b.str("<strls></strls>")
+
+	mark(11)
+	b.str("<value_labels>")
+	for _, set := range sets {
+		table := dtaValueLabelTable(set.labels)
+		b.str("<lbl>")
+		b.write(int32(len(table)))
+		b.fixed(set.name, dtaNameField, 0)
+		b.fixed("", 3, 0)
+		b.bytes(table)
+		b.str("</lbl>")
+	}
+	b.str("</value_labels>")
+
+	mark(12)
+	b.str("</stata_dta>")
+	mark(13)
+	if b.err != nil {
+		return b.err
+	}
+
+	file := buf.Bytes()
+	for i, offset := range offsets {
+		binary.LittleEndian.PutUint64(file[int(mapStart)+8*i:], offset)
+	}
+	_, err := w.Write(file)
+	return err
+}
+
+func dtaValueLabelTable(labels []ValueLabel) []byte {
+	txt := &bytes.Buffer{}
+	offsets := make([]int32, len(labels))
+	values := make([]int32, len(labels))
+	for i, vl := range labels {
+		offsets[i] = int32(txt.Len())
+		values[i] = int32(vl.Value)
+		txt.WriteString(truncate(vl.Label, 32000))
+		txt.WriteByte(0)
+	}
+	table := &bytes.Buffer{}
+	b := &binaryWriter{w: table}
+	b.write(int32(len(labels)))
+	b.write(int32(txt.Len()))
+	b.write(offsets)
+	b.write(values)
+	b.bytes(txt.Bytes())
+	return table.Bytes()
+}
@@ -0,0 +1,285 @@
+package export
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+type dtaFile struct {
+	variables  int
+	rows       int
+	label      string
+	timestamp  string
+	types      []uint16
+	names      []string
+	formats    []string
+	labelNames []string
+	labels     []string
+	measures   map[string]string
+	data       [][]interface{}
+	valueLabel map[string]map[int32]string
+}
+
+// dtaSections are the tags the map's offsets point at, in order, after the start of the file
+var dtaSections = []string{
+	"<map>", "<variable_types>", "<varnames>", "<sortlist>", "<formats>", "<value_label_names>", "<variable_labels>",
+	"<characteristics>", "<data>", "<strls>", "<value_labels>", "</stata_dta>",
+}
+
+// readDTA parses a format 118 dataset as WriteDTA writes it, checking every tag and the offsets in the map
+func readDTA(t *testing.T, file []byte) *dtaFile {
+	t.Helper()
+	r := bytes.NewReader(file)
+	read := func(v interface{}) {
+		if err := binary.Read(r, binary.LittleEndian, v); err != nil {
+			t.Fatalf("unable to read %T at %d: %v", v, len(file)-r.Len(), err)
+		}
+	}
+	text := func(n int) string {
+		p := make([]byte, n)
+		read(p)
+		return string(p)
+	}
+	field := func(n int) string {
+		return strings.TrimRight(text(n), "\x00")
+	}
+	tag := func(want string) {
+		if got := text(len(want)); got != want {
+			t.Fatalf("read %q at %d, want %q", got, len(file)-r.Len()-len(want), want)
+		}
+	}
+
+	f := &dtaFile{measures: map[string]string{}, valueLabel: map[string]map[int32]string{}}
+	tag("<stata_dta><header><release>118</release><byteorder>LSF</byteorder><K>")
+	var k uint16
+	read(&k)
+	tag("</K><N>")
+	var n uint64
+	read(&n)
+	f.variables, f.rows = int(k), int(n)
+	tag("</N><label>")
+	var labelLength uint16
+	read(&labelLength)
+	f.label = text(int(labelLength))
+	tag("</label><timestamp>")
+	var timestampLength uint8
+	read(&timestampLength)
+	f.timestamp = text(int(timestampLength))
+	tag("</timestamp></header>")
+
+	// The map is read first, every offset is checked once its section is reached
+	mapAt := len(file) - r.Len()
+	tag("<map>")
+	offsets := make([]uint64, 14)
+	read(offsets)
+	tag("</map>")
+	if offsets[0] != 0 || offsets[13] != uint64(len(file)) {
+		t.Errorf("map starts at %d and ends at %d, want 0 and %d", offsets[0], offsets[13], len(file))
+	}
+	for i, section := range dtaSections {
+		at := len(file) - r.Len()
+		if section == "<map>" {
+			at = mapAt
+		}
+		if offsets[i+1] != uint64(at) {
+			t.Errorf("map places %s at %d, want %d", section, offsets[i+1], at)
+		}
+		switch section {
+		case "<variable_types>":
+			tag(section)
+			f.types = make([]uint16, f.variables)
+			read(f.types)
+			tag("</variable_types>")
+		case "<varnames>":
+			tag(section)
+			for i := 0; i < f.variables; i++ {
+				f.names = append(f.names, field(dtaNameField))
+			}
+			tag("</varnames>")
+		case "<sortlist>":
+			tag(section)
+			sortlist := make([]uint16, f.variables+1)
+			read(sortlist)
+			tag("</sortlist>")
+		case "<formats>":
+			tag(section)
+			for i := 0; i < f.variables; i++ {
+				f.formats = append(f.formats, field(dtaFormatField))
+			}
+			tag("</formats>")
+		case "<value_label_names>":
+			tag(section)
+			for i := 0; i < f.variables; i++ {
+				f.labelNames = append(f.labelNames, field(dtaNameField))
+			}
+			tag("</value_label_names>")
+		case "<variable_labels>":
+			tag(section)
+			for i := 0; i < f.variables; i++ {
+				f.labels = append(f.labels, field(dtaLabelField))
+			}
+			tag("</variable_labels>")
+		case "<characteristics>":
+			tag(section)
+			for i := 0; i < f.variables; i++ {
+				tag("<ch>")
+				var length uint32
+				read(&length)
+				variable, name := field(dtaNameField), field(dtaNameField)
+				contents := field(int(length) - 2*dtaNameField)
+				if name == "measure" {
+					f.measures[variable] = contents
+				}
+				tag("</ch>")
+			}
+			tag("</characteristics>")
+		case "<data>":
+			tag(section)
+			for c := 0; c < f.rows; c++ {
+				row := make([]interface{}, f.variables)
+				for i, typ := range f.types {
+					if typ == dtaTypeDouble {
+						var value float64
+						read(&value)
+						row[i] = value
+					} else {
+						row[i] = field(int(typ))
+					}
+				}
+				f.data = append(f.data, row)
+			}
+			tag("</data>")
+		case "<strls>":
+			tag("<strls></strls>")
+		case "<value_labels>":
+			tag(section)
+			for _, name := range f.labelNames {
+				if name == "" || f.valueLabel[name] != nil {
+					continue
+				}
+				tag("<lbl>")
+				var length, count, textLength int32
+				read(&length)
+				if got := field(dtaNameField); got != name {
+					t.Fatalf("value labels are named %q, want %q", got, name)
+				}
+				text(3)
+				read(&count)
+				read(&textLength)
+				if want := 8 + 8*count + textLength; length != want {
+					t.Errorf("value label table %s is %d bytes long, want %d", name, length, want)
+				}
+				offsets, values := make([]int32, count), make([]int32, count)
+				read(offsets)
+				read(values)
+				txt := text(int(textLength))
+				f.valueLabel[name] = map[int32]string{}
+				for i, offset := range offsets {
+					f.valueLabel[name][values[i]] = strings.SplitN(txt[offset:], "\x00", 2)[0]
+				}
+				tag("</lbl>")
+			}
+			tag("</value_labels>")
+		case "</stata_dta>":
+			tag(section)
+		}
+	}
+	if r.Len() != 0 {
+		t.Errorf("%d bytes follow the dataset", r.Len())
+	}
+	return f
+}
+
+func TestWriteDTA(t *testing.T) {
+	for _, tt := range testTables {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := WriteDTA(&buf, tt.table); err != nil {
+				t.Fatal(err)
+			}
+			f := readDTA(t, buf.Bytes())
+
+			if f.variables != len(tt.table.Variables) || f.rows != len(tt.table.Rows) {
+				t.Errorf("%d variables and %d rows, want %d and %d", f.variables, f.rows, len(tt.table.Variables), len(tt.table.Rows))
+			}
+			if f.label != tt.table.Label {
+				t.Errorf("label is %q, want %q", f.label, tt.table.Label)
+			}
+			if want := tt.table.Created.Format("02 Jan 2006 15:04"); f.timestamp != want {
+				t.Errorf("timestamp is %q, want %q", f.timestamp, want)
+			}
+			for i, want := range tt.table.Variables {
+				if f.names[i] != want.Name || f.labels[i] != want.Label {
+					t.Errorf("variable %d is %q labelled %q, want %q labelled %q", i, f.names[i], f.labels[i], want.Name, want.Label)
+				}
+				wantType, wantFormat := uint16(dtaTypeDouble), "%9.0g"
+				if !want.Numeric() {
+					wantType, wantFormat = uint16(want.Width), "%-"+strconv.Itoa(want.Width)+"s"
+				} else if want.Decimals > 0 {
+					wantFormat = "%9." + strconv.Itoa(want.Decimals) + "f"
+				}
+				if f.types[i] != wantType || f.formats[i] != wantFormat {
+					t.Errorf("variable %s has type %d and format %q, want %d and %q", want.Name, f.types[i], f.formats[i], wantType, wantFormat)
+				}
+				if f.measures[want.Name] != want.Measure.String() {
+					t.Errorf("variable %s is %q, want %q", want.Name, f.measures[want.Name], want.Measure)
+				}
+				wantSet := ""
+				if len(want.ValueLabels) > 0 {
+					wantSet = want.LabelSet
+					if wantSet == "" {
+						wantSet = want.Name
+					}
+				}
+				if f.labelNames[i] != wantSet {
+					t.Errorf("variable %s uses value labels %q, want %q", want.Name, f.labelNames[i], wantSet)
+				}
+				labels := f.valueLabel[wantSet]
+				if len(labels) != len(want.ValueLabels) {
+					t.Errorf("variable %s has value labels %v, want %v", want.Name, labels, want.ValueLabels)
+				}
+				for _, vl := range want.ValueLabels {
+					if labels[int32(vl.Value)] != vl.Label {
+						t.Errorf("variable %s labels %d %q, want %q", want.Name, vl.Value, labels[int32(vl.Value)], vl.Label)
+					}
+				}
+			}
+
+			for c, row := range tt.table.Rows {
+				for i, cell := range row {
+					want := cell
+					switch v := cell.(type) {
+					case nil:
+						want = dtaMissing
+					case int:
+						want = float64(v)
+					}
+					if f.data[c][i] != want {
+						t.Errorf("row %d variable %s is %v, want %v", c, tt.table.Variables[i].Name, f.data[c][i], want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestWriteDTALimits(t *testing.T) {
+	tests := []struct {
+		name     string
+		variable Variable
+	}{
+		{"wide string", Variable{Name: "text", Width: dtaMaxStringWidth + 1}},
+		{"long name", Variable{Name: strings.Repeat("n", dtaMaxName+1)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := WriteDTA(&bytes.Buffer{}, &Table{Variables: []Variable{tt.variable}})
+			if err == nil {
+				t.Error("WriteDTA accepted the variable")
+			}
+		})
+	}
+}
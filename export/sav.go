@@ -0,0 +1,207 @@
+package export
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+)
+
+// SPSS system file constants, see the PSPP documentation of the format
+const (
+	savMaxStringWidth    = 255
+	savMaxVarLabel       = 255
+	savMaxValueLabel     = 120
+	savMaxLongName       = 64
+	savFormatF           = 5
+	savFormatA           = 1
+	savAlignLeft         = 0
+	savAlignRight        = 1
+	savEncodingUTF8      = 65001
+	savLittleEndian      = 2
+	savFloatIEEE         = 1
+	savRecordVariable    = 2
+	savRecordValueLabels = 3
+	savRecordLabelVars   = 4
+	savRecordExtension   = 7
+	savRecordEnd         = 999
+)
+
+var savReservedNames = map[string]bool{
+	"ALL": true, "AND": true, "BY": true, "EQ": true, "GE": true, "GT": true, "LE": true,
+	"LT": true, "NE": true, "NOT": true, "OR": true, "TO": true, "WITH": true,
+}
+
+// savSysmis is the system missing value, -DBL_MAX
+var savSysmis = -math.MaxFloat64
+
+// WriteSAV writes the table as an uncompressed SPSS system file with UTF-8 text, variable and value labels and
+// measurement levels
+func WriteSAV(w io.Writer, t *Table) error {
+	for _, v := range t.Variables {
+		if v.Width > savMaxStringWidth {
+			return fmt.Errorf("variable %s is wider than %d bytes", v.Name, savMaxStringWidth)
+		}
+		if len(v.Name) > savMaxLongName {
+			return fmt.Errorf("variable name %s is longer than %d bytes", v.Name, savMaxLongName)
+		}
+	}
+	buf := bufio.NewWriter(w)
+	b := &binaryWriter{w: buf}
+	shortNames := savShortNames(t.Variables)
+
+	segments := 0
+	for _, v := range t.Variables {
+		segments += savSegments(v)
+	}
+
+	// File header
+	b.str("$FL2")
+	b.fixed("@(#) SPSS DATA FILE carp", 60, ' ')
+	b.write(int32(2))
+	b.write(int32(segments))
+	b.write(int32(0)) // uncompressed
+	b.write(int32(0)) // no weight variable
+	b.write(int32(len(t.Rows)))
+	b.write(float64(100))
+	b.fixed(t.Created.Format("02 Jan 06"), 9, ' ')
+	b.fixed(t.Created.Format("15:04:05"), 8, ' ')
+	b.fixed(t.Label, 64, ' ')
+	b.fixed("", 3, 0)
+
+	// Variables, strings wider than 8 bytes take a continuation record per further 8 bytes
+	for i, v := range t.Variables {
+		format := int32(savFormatF<<16 | 8<<8 | v.Decimals)
+		if !v.Numeric() {
+			format = int32(savFormatA<<16 | v.Width<<8)
+		}
+		label := truncate(v.Label, savMaxVarLabel)
+		b.write(int32(savRecordVariable))
+		b.write(int32(v.Width))
+		if label != "" {
+			b.write(int32(1))
+		} else {
+			b.write(int32(0))
+		}
+		b.write(int32(0)) // no user missing values
+		b.write(format)
+		b.write(format)
+		b.fixed(shortNames[i], 8, ' ')
+		if label != "" {
+			b.write(int32(len(label)))
+			b.fixed(label, (len(label)+3)/4*4, ' ')
+		}
+		for s := 1; s < savSegments(v); s++ {
+			b.write(int32(savRecordVariable))
+			b.write(int32(-1))
+			b.write([4]int32{})
+			b.fixed("", 8, ' ')
+		}
+	}
+
+	// Value labels, each set followed by the dictionary indexes of the variables it applies to
+	indexes := make([]int32, len(t.Variables))
+	index := 1
+	for i, v := range t.Variables {
+		indexes[i] = int32(index)
+		index += savSegments(v)
+	}
+	for _, set := range labelSets(t.Variables) {
+		b.write(int32(savRecordValueLabels))
+		b.write(int32(len(set.labels)))
+		for _, vl := range set.labels {
+			label := truncate(vl.Label, savMaxValueLabel)
+			b.write(float64(vl.Value))
+			b.write(uint8(len(label)))
+			b.fixed(label, (len(label)+1+7)/8*8-1, ' ')
+		}
+		b.write(int32(savRecordLabelVars))
+		b.write(int32(len(set.vars)))
+		for _, i := range set.vars {
+			b.write(indexes[i])
+		}
+	}
+
+	// Machine integer info
+	b.write([]int32{savRecordExtension, 3, 4, 8})
+	b.write([]int32{1, 0, 0, -1, savFloatIEEE, 1, savLittleEndian, savEncodingUTF8})
+	// Machine floating point info
+	b.write([]int32{savRecordExtension, 4, 8, 3})
+	b.write([]float64{savSysmis, math.MaxFloat64, math.Nextafter(-math.MaxFloat64, 0)})
+	// Measurement level, display width and alignment
+	b.write([]int32{savRecordExtension, 11, 4, int32(3 * len(t.Variables))})
+	for _, v := range t.Variables {
+		if v.Numeric() {
+			b.write([]int32{int32(v.Measure), 8, savAlignRight})
+		} else {
+			width := v.Width
+			if width > 40 {
+				width = 40
+			}
+			b.write([]int32{int32(v.Measure), int32(width), savAlignLeft})
+		}
+	}
+	// Long variable names
+	pairs := make([]string, len(t.Variables))
+	for i, v := range t.Variables {
+		pairs[i] = shortNames[i] + "=" + v.Name
+	}
+	longNames := strings.Join(pairs, "\t")
+	b.write([]int32{savRecordExtension, 13, 1, int32(len(longNames))})
+	b.str(longNames)
+	// Character encoding
+	b.write([]int32{savRecordExtension, 20, 1, int32(len("UTF-8"))})
+	b.str("UTF-8")
+
+	b.write([]int32{savRecordEnd, 0})
+
+	for _, row := range t.Rows {
+		for i, v := range t.Variables {
+			if !v.Numeric() {
+				s, _ := row[i].(string)
+				b.fixed(s, savSegments(v)*8, ' ')
+				continue
+			}
+			value, ok, err := number(row[i])
+			if err != nil {
+				return err
+			}
+			if !ok {
+				value = savSysmis
+			}
+			b.write(value)
+		}
+	}
+	if b.err != nil {
+		return b.err
+	}
+	return buf.Flush()
+}
+
+func savSegments(v Variable) int {
+	if v.Numeric() {
+		return 1
+	}
+	return (v.Width + 7) / 8
+}
+
+// savShortNames picks the unique eight byte names SPSS stores next to each variable's long name
+func savShortNames(vars []Variable) []string {
+	names := make([]string, len(vars))
+	used := map[string]bool{}
+	for i, v := range vars {
+		name := strings.ToUpper(v.Name)
+		if len(name) > 8 || used[name] || savReservedNames[name] {
+			for n := i + 1; ; n++ {
+				name = fmt.Sprintf("V%d", n)
+				if !used[name] {
+					break
+				}
+			}
+		}
+		used[name] = true
+		names[i] = name
+	}
+	return names
+}
@@ -0,0 +1,291 @@
+package export
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testScale = []ValueLabel{{Value: 1, Label: "1 - Least believable"}, {Value: 5, Label: "5 - Most believable"}}
+
+// testTables are read back by the SPSS and Stata tests, covering long names, strings spanning several segments,
+// shared value labels and missing cells
+var testTables = []struct {
+	name  string
+	table *Table
+}{
+	{
+		name: "labelled",
+		table: &Table{
+			Label:   "Believability ratings",
+			Created: time.Date(2022, 3, 14, 15, 9, 26, 0, time.UTC),
+			Variables: []Variable{
+				{Name: "pseudonym", Label: "Participant pseudonym", Width: 20, Measure: MeasureNominal},
+				{Name: "condition", Label: "Condition", Measure: MeasureNominal, ValueLabels: []ValueLabel{
+					{Value: 1, Label: "No image"}, {Value: 2, Label: "With image"},
+				}},
+				{Name: "a_first", Label: "First headline", Measure: MeasureOrdinal, LabelSet: "scale", ValueLabels: testScale},
+				{Name: "a_second", Label: "Second headline", Measure: MeasureOrdinal, LabelSet: "scale", ValueLabels: testScale},
+				{Name: "discernment", Label: "Mean true minus mean false", Decimals: 2, Measure: MeasureScale},
+			},
+			Rows: [][]interface{}{
+				{"amber-otter", 1, 5, 2, 1.5},
+				{"brisk-heron-falls", 2, 3, nil, nil},
+				{"", 2, nil, nil, -0.25},
+			},
+		},
+	},
+	{
+		name: "empty",
+		table: &Table{
+			Label:     "",
+			Created:   time.Date(2021, 12, 1, 8, 0, 0, 0, time.UTC),
+			Variables: []Variable{{Name: "with", Measure: MeasureScale}, {Name: "WITH", Width: 3, Measure: MeasureNominal}},
+		},
+	},
+}
+
+type savVariable struct {
+	shortName string
+	width     int
+	label     string
+	format    int32
+}
+
+type savFile struct {
+	product     string
+	caseSize    int
+	cases       int
+	date, time  string
+	label       string
+	variables   []savVariable
+	valueLabels map[int]map[float64]string
+	measures    []int32
+	longNames   map[string]string
+	encoding    string
+	rows        [][]interface{}
+}
+
+// readSAV parses the parts of an uncompressed system file WriteSAV writes
+func readSAV(t *testing.T, file []byte) *savFile {
+	t.Helper()
+	r := bytes.NewReader(file)
+	read := func(v interface{}) {
+		if err := binary.Read(r, binary.LittleEndian, v); err != nil {
+			t.Fatalf("unable to read %T at %d: %v", v, len(file)-r.Len(), err)
+		}
+	}
+	text := func(n int) string {
+		p := make([]byte, n)
+		read(p)
+		return string(p)
+	}
+	f := &savFile{valueLabels: map[int]map[float64]string{}, longNames: map[string]string{}}
+	if magic := text(4); magic != "$FL2" {
+		t.Fatalf("magic is %q", magic)
+	}
+	f.product = strings.TrimRight(text(60), " ")
+	var header struct{ Layout, CaseSize, Compression, Weight, Cases int32 }
+	read(&header)
+	if header.Layout != 2 || header.Compression != 0 || header.Weight != 0 {
+		t.Errorf("header is %+v", header)
+	}
+	f.caseSize, f.cases = int(header.CaseSize), int(header.Cases)
+	var bias float64
+	read(&bias)
+	if bias != 100 {
+		t.Errorf("bias is %g", bias)
+	}
+	f.date, f.time = text(9), text(8)
+	f.label = strings.TrimRight(text(64), " ")
+	text(3)
+
+	for {
+		var record int32
+		read(&record)
+		switch record {
+		case savRecordVariable:
+			var v struct{ Type, HasLabel, Missing, Print, Write int32 }
+			read(&v)
+			name := strings.TrimRight(text(8), " ")
+			label := ""
+			if v.HasLabel == 1 {
+				var n int32
+				read(&n)
+				label = text(int(n+3) / 4 * 4)[:n]
+			}
+			if v.Type == -1 {
+				continue
+			}
+			f.variables = append(f.variables, savVariable{shortName: name, width: int(v.Type), label: label, format: v.Print})
+		case savRecordValueLabels:
+			var n int32
+			read(&n)
+			labels := map[float64]string{}
+			for i := 0; i < int(n); i++ {
+				var value float64
+				var length uint8
+				read(&value)
+				read(&length)
+				labels[value] = text((int(length)+1+7)/8*8 - 1)[:length]
+			}
+			var vars int32
+			if read(&record); record != savRecordLabelVars {
+				t.Fatalf("value labels are followed by record %d", record)
+			}
+			read(&vars)
+			for i := 0; i < int(vars); i++ {
+				var index int32
+				read(&index)
+				f.valueLabels[int(index)] = labels
+			}
+		case savRecordExtension:
+			var ext struct{ Subtype, Size, Count int32 }
+			read(&ext)
+			data := text(int(ext.Size * ext.Count))
+			switch ext.Subtype {
+			case 11:
+				f.measures = make([]int32, ext.Count)
+				if err := binary.Read(strings.NewReader(data), binary.LittleEndian, f.measures); err != nil {
+					t.Fatal(err)
+				}
+			case 13:
+				for _, pair := range strings.Split(data, "\t") {
+					if kv := strings.SplitN(pair, "=", 2); len(kv) == 2 {
+						f.longNames[kv[0]] = kv[1]
+					}
+				}
+			case 20:
+				f.encoding = data
+			}
+		case savRecordEnd:
+			var filler int32
+			read(&filler)
+			for c := 0; c < f.cases; c++ {
+				row := make([]interface{}, len(f.variables))
+				for i, v := range f.variables {
+					if v.width > 0 {
+						row[i] = strings.TrimRight(text((v.width+7)/8*8), " ")
+						continue
+					}
+					var value float64
+					read(&value)
+					row[i] = value
+				}
+				f.rows = append(f.rows, row)
+			}
+			if r.Len() != 0 {
+				t.Errorf("%d bytes follow the data", r.Len())
+			}
+			return f
+		default:
+			t.Fatalf("unexpected record %d", record)
+		}
+	}
+}
+
+func TestWriteSAV(t *testing.T) {
+	for _, tt := range testTables {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := WriteSAV(&buf, tt.table); err != nil {
+				t.Fatal(err)
+			}
+			f := readSAV(t, buf.Bytes())
+
+			segments := 0
+			for _, v := range tt.table.Variables {
+				segments += savSegments(v)
+			}
+			if f.caseSize != segments || f.cases != len(tt.table.Rows) {
+				t.Errorf("case size %d and %d cases, want %d and %d", f.caseSize, f.cases, segments, len(tt.table.Rows))
+			}
+			if !strings.HasPrefix(f.product, "@(#) SPSS DATA FILE") {
+				t.Errorf("product is %q", f.product)
+			}
+			if f.date != tt.table.Created.Format("02 Jan 06") || f.time != tt.table.Created.Format("15:04:05") {
+				t.Errorf("created %q %q", f.date, f.time)
+			}
+			if f.label != tt.table.Label {
+				t.Errorf("label is %q, want %q", f.label, tt.table.Label)
+			}
+			if f.encoding != "UTF-8" {
+				t.Errorf("encoding is %q", f.encoding)
+			}
+			if len(f.variables) != len(tt.table.Variables) || len(f.measures) != 3*len(tt.table.Variables) {
+				t.Fatalf("read %d variables and %d measures", len(f.variables), len(f.measures))
+			}
+
+			index := 1
+			shortNames := map[string]bool{}
+			for i, want := range tt.table.Variables {
+				got := f.variables[i]
+				if shortNames[got.shortName] || len(got.shortName) > 8 || savReservedNames[got.shortName] {
+					t.Errorf("short name %q is not a unique eight byte name", got.shortName)
+				}
+				shortNames[got.shortName] = true
+				if name := f.longNames[got.shortName]; name != want.Name {
+					t.Errorf("variable %d is named %q, want %q", i, name, want.Name)
+				}
+				if got.width != want.Width || got.label != want.Label {
+					t.Errorf("variable %s has width %d and label %q", want.Name, got.width, got.label)
+				}
+				wantFormat := int32(savFormatF<<16 | 8<<8 | want.Decimals)
+				if !want.Numeric() {
+					wantFormat = int32(savFormatA<<16 | want.Width<<8)
+				}
+				if got.format != wantFormat {
+					t.Errorf("variable %s has format %#x, want %#x", want.Name, got.format, wantFormat)
+				}
+				if Measure(f.measures[3*i]) != want.Measure {
+					t.Errorf("variable %s is %s, want %s", want.Name, Measure(f.measures[3*i]), want.Measure)
+				}
+				labels := f.valueLabels[index]
+				if len(labels) != len(want.ValueLabels) {
+					t.Errorf("variable %s has value labels %v, want %v", want.Name, labels, want.ValueLabels)
+				}
+				for _, vl := range want.ValueLabels {
+					if labels[float64(vl.Value)] != vl.Label {
+						t.Errorf("variable %s labels %d %q, want %q", want.Name, vl.Value, labels[float64(vl.Value)], vl.Label)
+					}
+				}
+				index += savSegments(want)
+			}
+
+			for c, row := range tt.table.Rows {
+				for i, cell := range row {
+					want := cell
+					switch v := cell.(type) {
+					case nil:
+						want = savSysmis
+					case int:
+						want = float64(v)
+					}
+					if f.rows[c][i] != want {
+						t.Errorf("row %d variable %s is %v, want %v", c, tt.table.Variables[i].Name, f.rows[c][i], want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestWriteSAVLimits(t *testing.T) {
+	tests := []struct {
+		name     string
+		variable Variable
+	}{
+		{"wide string", Variable{Name: "text", Width: savMaxStringWidth + 1}},
+		{"long name", Variable{Name: strings.Repeat("n", savMaxLongName+1)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := WriteSAV(&bytes.Buffer{}, &Table{Variables: []Variable{tt.variable}})
+			if err == nil {
+				t.Error("WriteSAV accepted the variable")
+			}
+		})
+	}
+}
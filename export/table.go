@@ -0,0 +1,272 @@
+// Package export writes study data in the file formats collaborators analyse it with
+package export
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/superc03/carp/analysis"
+	"github.com/superc03/carp/models"
+)
+
+// Measure is a variable's level of measurement as statistics packages understand it
+type Measure int
+
+const (
+	MeasureNominal Measure = 1
+	MeasureOrdinal Measure = 2
+	MeasureScale   Measure = 3
+)
+
+func (m Measure) String() string {
+	switch m {
+	case MeasureNominal:
+		return "nominal"
+	case MeasureOrdinal:
+		return "ordinal"
+	}
+	return "scale"
+}
+
+// ValueLabel names a single value of a variable, such as a scale anchor
+type ValueLabel struct {
+	Value int
+	Label string
+}
+
+// Variable is a column of a Table. Width is zero for numeric variables and the length in bytes of string variables,
+// Decimals the number of decimal places numeric variables are displayed with. Variables sharing a LabelSet name share
+// their value labels. Missing explains when cells are empty.
+type Variable struct {
+	Name        string
+	Label       string
+	Width       int
+	Decimals    int
+	Measure     Measure
+	LabelSet    string
+	ValueLabels []ValueLabel
+	Missing     string
+}
+
+// Numeric reports whether the variable holds numbers rather than text
+func (v Variable) Numeric() bool {
+	return v.Width == 0
+}
+
+// Table is a labelled rectangular dataset. Cells of numeric variables hold an int, a float64 or nil when missing,
+// cells of string variables hold a string.
+type Table struct {
+	Label     string
+	Created   time.Time
+	Variables []Variable
+	Rows      [][]interface{}
+}
+
+// WideTable lays out the dataset like `/statistics.csv`: one row per participant, with their condition and a column
+// per article holding its rating. Once articles are labelled true and false, each participant's discernment follows.
+// The participant's quality indicators and flags come last, followed by whether they are excluded when the filter
+// includes excluded participants.
+func WideTable(d *models.Dataset) *Table {
+	conditionLabels := make([]ValueLabel, len(d.Study.Conditions))
+	for i, c := range d.Study.Conditions {
+		conditionLabels[i] = ValueLabel{Value: c.SurveyType, Label: c.Name}
+	}
+	scaleLabels := make([]ValueLabel, len(d.Study.Scale.Anchors))
+	for i, a := range d.Study.Scale.Anchors {
+		scaleLabels[i] = ValueLabel{Value: a.Value, Label: a.Label}
+	}
+
+	pseudonymWidth := 1
+	for _, u := range d.Participants {
+		if len(u.Pseudonym) > pseudonymWidth {
+			pseudonymWidth = len(u.Pseudonym)
+		}
+	}
+	t := &Table{
+		Label:   d.Study.Title,
+		Created: d.ExportedOn,
+		Variables: []Variable{
+			{Name: "pseudonym", Label: "Participant pseudonym", Width: pseudonymWidth, Measure: MeasureNominal},
+			{Name: "condition", Label: "Experimental condition", Measure: MeasureNominal, LabelSet: "condition", ValueLabels: conditionLabels},
+		},
+		Rows: make([][]interface{}, 0, len(d.Participants)),
+	}
+	for _, a := range d.Articles {
+		t.Variables = append(t.Variables, Variable{
+			Name:        ArticleVariable(a),
+			Label:       a.Title,
+			Measure:     MeasureOrdinal,
+			LabelSet:    "scale",
+			ValueLabels: scaleLabels,
+			Missing:     "empty when the participant has not rated the article",
+		})
+	}
+	var discernments map[string]analysis.Discernment
+	if analysis.HasVeracity(d) {
+		discernments = analysis.Discernments(d)
+		missing := "empty unless the participant rated at least one true and one false article"
+		t.Variables = append(t.Variables,
+			Variable{Name: "discernment", Label: "Mean rating of true minus false articles", Decimals: 3, Measure: MeasureScale, Missing: missing},
+			Variable{Name: "d_prime", Label: "Sensitivity d' telling true from false articles", Decimals: 3, Measure: MeasureScale, Missing: missing},
+			Variable{Name: "criterion", Label: "Response bias c, negative when inclined to believe", Decimals: 3, Measure: MeasureScale, Missing: missing},
+		)
+	}
+	thresholds := d.Study.Quality.WithDefaults()
+	quality := analysis.AssessQuality(d)
+	flagsWidth := 1
+	for _, q := range quality {
+		if n := len(strings.Join(q.Flags, " ")); n > flagsWidth {
+			flagsWidth = n
+		}
+	}
+	t.Variables = append(t.Variables,
+		Variable{Name: "duration_seconds", Label: "Seconds from the first article shown to the last rating", Decimals: 1,
+			Measure: MeasureScale, Missing: "empty unless the participant finished and display times were recorded"},
+		Variable{Name: "fast_items", Label: fmt.Sprintf("Articles rated within %g seconds of being shown", thresholds.FastItemSeconds),
+			Measure: MeasureScale},
+		Variable{Name: "rating_sd", Label: "Standard deviation of the participant's ratings", Decimals: 3, Measure: MeasureScale,
+			Missing: fmt.Sprintf("empty for participants with fewer than %d ratings", thresholds.MinRatings)},
+	)
+	if len(d.Checks) > 0 {
+		t.Variables = append(t.Variables, Variable{Name: "checks_failed", Label: "Attention checks answered wrongly", Measure: MeasureScale})
+	}
+	noYes := []ValueLabel{{Value: 0, Label: "No"}, {Value: 1, Label: "Yes"}}
+	t.Variables = append(t.Variables,
+		Variable{Name: "shared_devices", Label: "Other participants who rated from the same device", Measure: MeasureScale},
+		Variable{Name: "quality_flags", Label: "Quality flags raised, separated by spaces", Width: flagsWidth, Measure: MeasureNominal,
+			Missing: "empty when no flag is raised"},
+		Variable{Name: "flagged", Label: "Any quality flag raised", Measure: MeasureNominal, LabelSet: "no_yes", ValueLabels: noYes},
+	)
+	if d.Filter.IncludeExcluded {
+		reasonWidth := 1
+		for _, u := range d.Participants {
+			if n := len(u.ExclusionCode()); n > reasonWidth {
+				reasonWidth = n
+			}
+		}
+		t.Variables = append(t.Variables,
+			Variable{Name: "excluded", Label: "Excluded from analysis by an admin", Measure: MeasureNominal, LabelSet: "no_yes", ValueLabels: noYes},
+			Variable{Name: "exclusion_reason", Label: "Why the participant was excluded", Width: reasonWidth, Measure: MeasureNominal,
+				Missing: "empty for included participants"},
+		)
+	}
+	for i, u := range d.Participants {
+		row := make([]interface{}, 0, len(t.Variables))
+		row = append(row, u.Pseudonym, u.SurveyType)
+		for _, a := range d.Articles {
+			if value, ok := u.Rating(a.ID.Hex()); ok {
+				row = append(row, value)
+			} else {
+				row = append(row, nil)
+			}
+		}
+		if discernments != nil {
+			if m, ok := discernments[u.Pseudonym]; ok {
+				row = append(row, m.Discernment, m.DPrime, m.Criterion)
+			} else {
+				row = append(row, nil, nil, nil)
+			}
+		}
+		q := quality[i]
+		row = append(row, optionalNumber(q.Duration), q.FastItems, optionalNumber(q.SD))
+		if len(d.Checks) > 0 {
+			row = append(row, q.ChecksFailed)
+		}
+		flagged := 0
+		if q.Flagged() {
+			flagged = 1
+		}
+		row = append(row, q.SharedDevices, strings.Join(q.Flags, " "), flagged)
+		if d.Filter.IncludeExcluded {
+			excluded := 0
+			if u.Excluded {
+				excluded = 1
+			}
+			row = append(row, excluded, u.ExclusionCode())
+		}
+		t.Rows = append(t.Rows, row)
+	}
+	return t
+}
+
+// ArticleVariable names an article's rating variable. Article IDs may start with a digit, which neither SPSS nor
+// Stata accept, so they are prefixed.
+func ArticleVariable(a models.Article) string {
+	return "a_" + a.ID.Hex()
+}
+
+// labelSet is a set of value labels and the indexes of the variables using it
+type labelSet struct {
+	name   string
+	labels []ValueLabel
+	vars   []int
+}
+
+// labelSets groups numeric variables by LabelSet, falling back to one set per variable named after it
+func labelSets(vars []Variable) []*labelSet {
+	sets := make([]*labelSet, 0)
+	byName := map[string]*labelSet{}
+	for i, v := range vars {
+		if len(v.ValueLabels) == 0 || !v.Numeric() {
+			continue
+		}
+		name := v.LabelSet
+		if name == "" {
+			name = v.Name
+		}
+		set, ok := byName[name]
+		if !ok {
+			set = &labelSet{name: name, labels: v.ValueLabels}
+			byName[name] = set
+			sets = append(sets, set)
+		}
+		set.vars = append(set.vars, i)
+	}
+	return sets
+}
+
+// optionalNumber turns a missing number into a nil cell
+func optionalNumber(v *float64) interface{} {
+	if v == nil {
+		return nil
+	}
+	return *v
+}
+
+// number converts a numeric cell into a float64, reporting false for missing values
+func number(cell interface{}) (float64, bool, error) {
+	switch v := cell.(type) {
+	case nil:
+		return 0, false, nil
+	case int:
+		return float64(v), true, nil
+	case float64:
+		return v, true, nil
+	}
+	return 0, false, fmt.Errorf("unsupported numeric cell %T", cell)
+}
+
+// truncate shortens s to at most n bytes without splitting a UTF-8 sequence
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// truncateRunes shortens s to at most n characters
+func truncateRunes(s string, n int) string {
+	i := 0
+	for pos := range s {
+		if i == n {
+			return s[:pos]
+		}
+		i++
+	}
+	return s
+}
@@ -0,0 +1,100 @@
+package export
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/superc03/carp/models"
+)
+
+// WriteWorkbook writes the dataset as an Excel workbook with responses, articles, participants and codebook sheets.
+// Responses hold the same coded values as the SPSS and Stata exports and are headed by article titles rather than
+// IDs, the articles and codebook sheets map them back.
+func WriteWorkbook(w io.Writer, d *models.Dataset) error {
+	x := NewXLSX(w)
+	table := WideTable(d)
+
+	headers := []string{"Pseudonym", "Condition"}
+	for _, a := range d.Articles {
+		headers = append(headers, a.Title)
+	}
+	for _, v := range table.Variables[len(headers):] {
+		headers = append(headers, v.Label)
+	}
+	sheet, err := x.Sheet("Responses", headers...)
+	if err != nil {
+		return err
+	}
+	for _, row := range table.Rows {
+		if err = sheet.Row(row...); err != nil {
+			return err
+		}
+	}
+
+	headers = []string{"Article ID", "Title", "Picture Code", "Veracity", "Source", "Topic", "Lean", "Responses Column"}
+	for _, c := range d.Study.Conditions {
+		headers = append(headers, c.Name+" Presentation", c.Name+" Responses")
+	}
+	if sheet, err = x.Sheet("Articles", headers...); err != nil {
+		return err
+	}
+	for i, a := range d.Articles {
+		row := []interface{}{a.ID.Hex(), a.Title, a.PictureCode, string(a.Veracity), a.Source, a.Topic, string(a.Lean), xlsxColumn(i + 2)}
+		for _, c := range d.Study.Conditions {
+			presentation := "Headline only"
+			if c.ShowsImage() {
+				presentation = "Headline and picture"
+			}
+			responses := 0
+			for _, u := range d.Participants {
+				if _, ok := u.Rating(a.ID.Hex()); ok && u.SurveyType == c.SurveyType {
+					responses++
+				}
+			}
+			row = append(row, presentation, responses)
+		}
+		if err = sheet.Row(row...); err != nil {
+			return err
+		}
+	}
+
+	headers = []string{"Pseudonym", "Condition", "Status", "Responses", "Signed In", "Started", "Completed"}
+	if d.Filter.IncludeExcluded {
+		headers = append(headers, "Excluded", "Exclusion Reason")
+	}
+	sheet, err = x.Sheet("Participants", headers...)
+	if err != nil {
+		return err
+	}
+	for _, u := range d.Participants {
+		row := []interface{}{u.Pseudonym, models.ConditionName(u.SurveyType), u.Status(d.SurveyLength()), len(u.Data),
+			u.CreatedOn, u.StartedOn, u.CompletedOn}
+		if d.Filter.IncludeExcluded {
+			excluded := "No"
+			if u.Excluded {
+				excluded = "Yes"
+			}
+			row = append(row, excluded, u.ExclusionCode())
+		}
+		if err = sheet.Row(row...); err != nil {
+			return err
+		}
+	}
+
+	sheet, err = x.Sheet("Codebook", "Responses Column", "Variable", "Label", "Type", "Measure", "Values", "Missing", "Article ID")
+	if err != nil {
+		return err
+	}
+	for i, v := range NewCodebook(d).Layout(LayoutLabelled).Variables {
+		values := make([]string, len(v.Values))
+		for j, cv := range v.Values {
+			values[j] = fmt.Sprint(cv.Value) + " = " + cv.Label
+		}
+		err = sheet.Row(xlsxColumn(i), v.Name, v.Label, v.Type, v.Measure, strings.Join(values, "; "), v.Missing, v.ArticleID)
+		if err != nil {
+			return err
+		}
+	}
+	return x.Close()
+}
@@ -0,0 +1,239 @@
+package export
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cell styles defined in xlsxStyles
+const (
+	xlsxStyleDefault = 0
+	xlsxStyleHeader  = 1
+	xlsxStyleDate    = 2
+)
+
+const xlsxStyles = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<numFmts count="1"><numFmt numFmtId="164" formatCode="yyyy-mm-dd hh:mm:ss"/></numFmts>
+<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>
+<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>
+<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>
+<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>
+<cellXfs count="3"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/><xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/><xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/></cellXfs>
+</styleSheet>`
+
+// xlsxEpoch is day zero of Excel's date serial numbers, accounting for its 1900 leap year bug
+var xlsxEpoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+// XLSX streams an Office Open XML workbook. Sheets are written one after the other, each must be complete before
+// the next is started, and cells are stored inline so nothing has to be held in memory.
+type XLSX struct {
+	zw     *zip.Writer
+	sheets []string
+	sheet  *Sheet
+}
+
+// Sheet is the worksheet currently being written to
+type Sheet struct {
+	w   *bufio.Writer
+	row int
+	err error
+}
+
+// NewXLSX starts a workbook written to w
+func NewXLSX(w io.Writer) *XLSX {
+	return &XLSX{zw: zip.NewWriter(w)}
+}
+
+// Sheet finishes the current sheet and starts a new one. Its first row is written bold with the given headers and
+// stays visible while scrolling.
+func (x *XLSX) Sheet(name string, headers ...string) (*Sheet, error) {
+	if err := x.finishSheet(); err != nil {
+		return nil, err
+	}
+	if name == "" || len(name) > 31 || strings.ContainsAny(name, `[]:*?/\`) {
+		return nil, fmt.Errorf("invalid sheet name `%s`", name)
+	}
+	x.sheets = append(x.sheets, name)
+	f, err := x.zw.Create(fmt.Sprintf("xl/worksheets/sheet%d.xml", len(x.sheets)))
+	if err != nil {
+		return nil, err
+	}
+	x.sheet = &Sheet{w: bufio.NewWriter(f)}
+	x.sheet.write(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` +
+		`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+		`<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>` +
+		`<sheetData>`)
+	cells := make([]interface{}, len(headers))
+	for i, h := range headers {
+		cells[i] = h
+	}
+	x.sheet.row++
+	x.sheet.cells(cells, xlsxStyleHeader)
+	return x.sheet, x.sheet.err
+}
+
+// Row appends a row. Cells may be strings, ints, float64s, bools, times or nil for an empty cell.
+func (s *Sheet) Row(cells ...interface{}) error {
+	s.row++
+	s.cells(cells, xlsxStyleDefault)
+	return s.err
+}
+
+func (s *Sheet) cells(cells []interface{}, style int) {
+	s.write(`<row r="` + strconv.Itoa(s.row) + `">`)
+	for i, cell := range cells {
+		if t, ok := cell.(*time.Time); ok {
+			if t == nil {
+				continue
+			}
+			cell = *t
+		}
+		ref := xlsxColumn(i) + strconv.Itoa(s.row)
+		attrs := `<c r="` + ref + `"`
+		if style != xlsxStyleDefault {
+			attrs += ` s="` + strconv.Itoa(style) + `"`
+		}
+		switch v := cell.(type) {
+		case nil:
+			continue
+		case string:
+			s.write(attrs + ` t="inlineStr"><is><t xml:space="preserve">`)
+			s.escape(v)
+			s.write(`</t></is></c>`)
+		case int:
+			s.write(attrs + `><v>` + strconv.Itoa(v) + `</v></c>`)
+		case float64:
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				continue
+			}
+			s.write(attrs + `><v>` + strconv.FormatFloat(v, 'g', -1, 64) + `</v></c>`)
+		case bool:
+			b := "0"
+			if v {
+				b = "1"
+			}
+			s.write(attrs + ` t="b"><v>` + b + `</v></c>`)
+		case time.Time:
+			serial := v.UTC().Sub(xlsxEpoch).Hours() / 24
+			if style == xlsxStyleDefault {
+				attrs += ` s="` + strconv.Itoa(xlsxStyleDate) + `"`
+			}
+			s.write(attrs + `><v>` + strconv.FormatFloat(serial, 'f', -1, 64) + `</v></c>`)
+		default:
+			if s.err == nil {
+				s.err = fmt.Errorf("unsupported cell %T", cell)
+			}
+		}
+	}
+	s.write(`</row>`)
+}
+
+func (s *Sheet) write(str string) {
+	if s.err == nil {
+		_, s.err = s.w.WriteString(str)
+	}
+}
+
+func (s *Sheet) escape(str string) {
+	if s.err == nil {
+		s.err = xml.EscapeText(s.w, []byte(xlsxClean(str)))
+	}
+}
+
+// xlsxClean drops control characters XML 1.0 cannot represent
+func xlsxClean(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 && r != '\t' && r != '\n' && r != '\r' {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+func (x *XLSX) finishSheet() error {
+	if x.sheet == nil {
+		return nil
+	}
+	s := x.sheet
+	x.sheet = nil
+	s.write(`</sheetData></worksheet>`)
+	if s.err != nil {
+		return s.err
+	}
+	return s.w.Flush()
+}
+
+// Close finishes the last sheet and writes the workbook parts referencing every sheet
+func (x *XLSX) Close() error {
+	if err := x.finishSheet(); err != nil {
+		return err
+	}
+	if len(x.sheets) == 0 {
+		return errors.New("a workbook needs at least one sheet")
+	}
+	var (
+		types    strings.Builder
+		workbook strings.Builder
+		rels     strings.Builder
+	)
+	types.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` +
+		`<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>`)
+	workbook.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` +
+		`<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>`)
+	rels.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` +
+		`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`)
+	for i, name := range x.sheets {
+		n := strconv.Itoa(i + 1)
+		types.WriteString(`<Override PartName="/xl/worksheets/sheet` + n + `.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`)
+		workbook.WriteString(`<sheet name="`)
+		xml.EscapeText(&workbook, []byte(name))
+		workbook.WriteString(`" sheetId="` + n + `" r:id="rId` + n + `"/>`)
+		rels.WriteString(`<Relationship Id="rId` + n + `" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet` + n + `.xml"/>`)
+	}
+	types.WriteString(`</Types>`)
+	workbook.WriteString(`</sheets></workbook>`)
+	rels.WriteString(`<Relationship Id="rId` + strconv.Itoa(len(x.sheets)+1) + `" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/></Relationships>`)
+
+	parts := []struct{ name, content string }{
+		{"[Content_Types].xml", types.String()},
+		{"_rels/.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` +
+			`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+			`</Relationships>`},
+		{"xl/workbook.xml", workbook.String()},
+		{"xl/_rels/workbook.xml.rels", rels.String()},
+		{"xl/styles.xml", xlsxStyles},
+	}
+	for _, p := range parts {
+		f, err := x.zw.Create(p.name)
+		if err != nil {
+			return err
+		}
+		if _, err = io.WriteString(f, p.content); err != nil {
+			return err
+		}
+	}
+	return x.zw.Close()
+}
+
+// xlsxColumn converts a zero based column index into a column name such as `A` or `AB`
+func xlsxColumn(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
@@ -0,0 +1,244 @@
+package handlers
+
+import (
+	"context"
+	"embed"
+	"html/template"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/superc03/carp/models"
+	"github.com/superc03/carp/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/zap"
+)
+
+type Admin struct {
+	l         *zap.Logger
+	db        *mongo.Database
+	vault     *models.IdentityVault
+	sess      *utils.SessionStore
+	templates *embed.FS
+	stepUpTTL time.Duration
+	loc       *time.Location
+	events    *utils.Broadcaster
+}
+
+func NewAdmin(
+	l *zap.Logger,
+	db *mongo.Database,
+	vault *models.IdentityVault,
+	sess *utils.SessionStore,
+	templates *embed.FS,
+	stepUpTTL time.Duration,
+	loc *time.Location,
+	events *utils.Broadcaster,
+) *Admin {
+	return &Admin{
+		l, db, vault, sess, templates, stepUpTTL, loc, events,
+	}
+}
+
+// RequirePermission only lets users whose role grants the permission through. It must run after UserMiddleware.
+func RequirePermission(perm models.Permission) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, ok := r.Context().Value(userFromContext{}).(models.User)
+			if !ok || !user.Role.Can(perm) {
+				http.Error(w, "You Do Not Have Access to This Page", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// HomePage is the study dashboard: enrollment, the completion funnel per condition and responses per article,
+// along with links to the admin tools the user's role grants
+func (a *Admin) HomePage(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(userFromContext{}).(models.User)
+	mongoContext, mongoCancel := context.WithTimeout(r.Context(), time.Second*15)
+	defer mongoCancel()
+
+	progress, err := models.LoadProgress(mongoContext, a.db, a.loc)
+	if err != nil {
+		a.l.Error("Unable to load study progress", zap.Error(err))
+		http.Error(w, "An Unknown Error Has Occured, Please Try Again Later", http.StatusInternalServerError)
+		return
+	}
+	maxResponses := 0
+	for _, a := range progress.Articles {
+		if a.Responses > maxResponses {
+			maxResponses = a.Responses
+		}
+	}
+
+	csrfToken, err := utils.CSRFToken(r, w, a.sess)
+	if err != nil {
+		a.l.Error("Unable to issue CSRF token", zap.Error(err))
+		http.Error(w, "An Unknown Error Has Occured, Please Try Again Later", http.StatusInternalServerError)
+		return
+	}
+	t := template.Must(template.New("admin-page").Funcs(template.FuncMap{
+		"percent": models.Percent,
+	}).ParseFS(*a.templates, "templates/admin.html"))
+	err = t.ExecuteTemplate(w, "admin.html", struct {
+		CSRFToken        string
+		Role             models.Role
+		Progress         *models.Progress
+		MedianCompletion string
+		MaxResponses     int
+		CanExport        bool
+		CanManage        bool
+		CanManageTokens  bool
+		CanManageRoles   bool
+	}{
+		CSRFToken:        csrfToken,
+		Role:             user.Role,
+		Progress:         progress,
+		MedianCompletion: progress.MedianCompletion.Round(time.Second).String(),
+		MaxResponses:     maxResponses,
+		CanExport:        user.Role.Can(models.PermExportData),
+		CanManage:        user.Role.Can(models.PermManageSessions),
+		CanManageTokens:  user.Role.Can(models.PermManageStudy),
+		CanManageRoles:   user.Role.Can(models.PermManageRoles),
+	})
+	if err != nil {
+		a.l.Error("Unable to render dashboard", zap.Error(err))
+		http.Error(w, "An Unknown Error Has Occured, Please Try Again Later", http.StatusInternalServerError)
+		return
+	}
+}
+
+// RolesPage lists the research team and lets a superadmin grant roles by email
+func (a *Admin) RolesPage(w http.ResponseWriter, r *http.Request) {
+	a.renderRolesPage(w, r, "")
+}
+
+func (a *Admin) renderRolesPage(w http.ResponseWriter, r *http.Request, message string) {
+	mongoContext, mongoCancel := context.WithTimeout(r.Context(), time.Second*5)
+	defer mongoCancel()
+	staff, err := models.StaffUsers(mongoContext, a.db, a.vault)
+	if err != nil {
+		a.l.Error("Unable to list staff users", zap.Error(err))
+		http.Error(w, "An Unknown Error Has Occured, Please Try Again Later", http.StatusInternalServerError)
+		return
+	}
+	csrfToken, err := utils.CSRFToken(r, w, a.sess)
+	if err != nil {
+		a.l.Error("Unable to issue CSRF token", zap.Error(err))
+		http.Error(w, "An Unknown Error Has Occured, Please Try Again Later", http.StatusInternalServerError)
+		return
+	}
+	t := template.Must(template.New("roles-page").ParseFS(*a.templates, "templates/roles.html"))
+	err = t.ExecuteTemplate(w, "roles.html", struct {
+		CSRFToken string
+		Message   string
+		Staff     []models.StaffMember
+		Roles     []models.Role
+	}{CSRFToken: csrfToken, Message: message, Staff: staff, Roles: models.Roles})
+	if err != nil {
+		http.Error(w, "An Unknown Error Has Occured, Please Try Again Later", http.StatusInternalServerError)
+		return
+	}
+}
+
+// GrantRole assigns the submitted role to the submitted email. Granting `participant` revokes all staff access.
+func (a *Admin) GrantRole(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(userFromContext{}).(models.User)
+	mongoContext, mongoCancel := context.WithTimeout(r.Context(), time.Second*5)
+	defer mongoCancel()
+	role, err := models.ParseRole(r.FormValue("role"))
+	if err != nil {
+		a.renderRolesPage(w, r, err.Error())
+		return
+	}
+	email := r.FormValue("email")
+	if err = models.SetRoleByEmail(mongoContext, a.db, a.vault, email, role); err != nil {
+		a.l.Warn("Unable to change user role", zap.Error(err))
+		a.renderRolesPage(w, r, err.Error())
+		return
+	}
+	a.l.Info("Role changed by admin", zap.String("Admin", user.ID.Hex()), zap.String("Email", email), zap.String("Role", string(role)))
+	http.Redirect(w, r, "/admin/roles", http.StatusFound)
+}
+
+// SessionsPage lists the active sessions of the user with the given email so an admin can revoke them
+func (a *Admin) SessionsPage(w http.ResponseWriter, r *http.Request) {
+	mongoContext, mongoCancel := context.WithTimeout(r.Context(), time.Second*5)
+	defer mongoCancel()
+	email := r.URL.Query().Get("email")
+	var (
+		target   *models.User
+		sessions []models.Session
+	)
+	if email != "" {
+		found := models.User{}
+		userID, err := a.vault.Lookup(mongoContext, email)
+		if err == nil {
+			err = a.db.Collection("users").FindOne(mongoContext, bson.M{"_id": userID}).Decode(&found)
+		}
+		if err != nil && err != mongo.ErrNoDocuments {
+			a.l.Error("Unable to search for user in database", zap.Error(err))
+			http.Error(w, "An Unknown Error Has Occured, Please Try Again Later", http.StatusInternalServerError)
+			return
+		}
+		if err == nil {
+			target = &found
+			sessions, err = a.sess.ActiveSessions(mongoContext, found.ID)
+			if err != nil {
+				a.l.Error("Unable to list user sessions", zap.Error(err))
+				http.Error(w, "An Unknown Error Has Occured, Please Try Again Later", http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+	csrfToken, err := utils.CSRFToken(r, w, a.sess)
+	if err != nil {
+		a.l.Error("Unable to issue CSRF token", zap.Error(err))
+		http.Error(w, "An Unknown Error Has Occured, Please Try Again Later", http.StatusInternalServerError)
+		return
+	}
+	t := template.Must(template.New("sessions-page").ParseFS(*a.templates, "templates/sessions.html"))
+	err = t.ExecuteTemplate(w, "sessions.html", struct {
+		CSRFToken string
+		Email     string
+		Target    *models.User
+		Sessions  []models.Session
+	}{CSRFToken: csrfToken, Email: email, Target: target, Sessions: sessions})
+	if err != nil {
+		http.Error(w, "An Unknown Error Has Occured, Please Try Again Later", http.StatusInternalServerError)
+		return
+	}
+}
+
+// RevokeSessions ends either a single session (`session` form value) or every session of a user (`user` form value)
+func (a *Admin) RevokeSessions(w http.ResponseWriter, r *http.Request) {
+	mongoContext, mongoCancel := context.WithTimeout(r.Context(), time.Second*5)
+	defer mongoCancel()
+	user := r.Context().Value(userFromContext{}).(models.User)
+	if sessionID := r.FormValue("session"); sessionID != "" {
+		err := a.sess.Revoke(mongoContext, sessionID)
+		if err != nil && err != utils.ErrSessionNotFound {
+			a.l.Error("Unable to revoke session", zap.Error(err))
+			http.Error(w, "An Unknown Error Has Occured, Please Try Again Later", http.StatusInternalServerError)
+			return
+		}
+	} else {
+		userID, err := primitive.ObjectIDFromHex(r.FormValue("user"))
+		if err != nil {
+			http.Error(w, "An Unknown Error Has Occured, Please Try Again Later", http.StatusBadRequest)
+			return
+		}
+		if err = a.sess.RevokeUser(mongoContext, userID); err != nil {
+			a.l.Error("Unable to revoke user sessions", zap.Error(err))
+			http.Error(w, "An Unknown Error Has Occured, Please Try Again Later", http.StatusInternalServerError)
+			return
+		}
+	}
+	a.l.Info("Sessions revoked by admin", zap.String("Admin", user.ID.Hex()), zap.String("Session", r.FormValue("session")), zap.String("User", r.FormValue("user")))
+	http.Redirect(w, r, "/admin/sessions?email="+url.QueryEscape(r.FormValue("email")), http.StatusFound)
+}
@@ -0,0 +1,586 @@
+package handlers
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/superc03/carp/analysis"
+	"github.com/superc03/carp/models"
+	"github.com/superc03/carp/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+)
+
+// analysisFuncs format statistics for the analysis pages
+var analysisFuncs = template.FuncMap{
+	"num": func(v float64) string {
+		// Values that round to zero print without a minus sign
+		if math.Abs(v) < 0.005 {
+			v = 0
+		}
+		return fmt.Sprintf("%.2f", v)
+	},
+	// pvalue prints tiny p-values as a bound rather than rounding them to zero
+	"pvalue": func(p float64) string {
+		if p < 0.001 {
+			return "< .001"
+		}
+		return fmt.Sprintf("%.3f", p)
+	},
+	"significant": func(p float64) bool {
+		return p < 1-analysis.Confidence
+	},
+}
+
+// loadDataset reads the participant filter from q and loads the matching dataset, answering the
+// request itself and returning nil when that fails
+func (a *Admin) loadDataset(w http.ResponseWriter, r *http.Request, q url.Values) *models.Dataset {
+	filter, err := models.ParseParticipantFilter(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil
+	}
+	mongoContext, mongoCancel := context.WithTimeout(r.Context(), time.Second*30)
+	defer mongoCancel()
+	dataset, err := models.LoadDataset(mongoContext, a.db, filter)
+	if err != nil {
+		a.l.Error("Unable to load dataset for analysis", zap.Error(err))
+		http.Error(w, "An Unknown Error Has Occured, Please Try Again Later", http.StatusInternalServerError)
+		return nil
+	}
+	return dataset
+}
+
+// AnalysisPage compares ratings between the conditions per article and overall. It takes the export filters along
+// with `correction`, `model=mixed` adds a mixed model over all ratings, `bayes=1` Bayesian estimates with a region of
+// practical equivalence of ±`rope` and `format=json` returns the report itself. Bootstrap intervals are always
+// included, drawn from `seed` or a fresh seed the report records.
+func (a *Admin) AnalysisPage(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	correction, err := analysis.ParseCorrection(q.Get("correction"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	seed := time.Now().UnixNano() % 1000000000
+	if v := q.Get("seed"); v != "" {
+		if seed, err = strconv.ParseInt(v, 10, 64); err != nil {
+			http.Error(w, "seed must be a whole number", http.StatusBadRequest)
+			return
+		}
+	}
+	rope := analysis.DefaultROPE
+	if v := q.Get("rope"); v != "" {
+		if rope, err = strconv.ParseFloat(v, 64); err != nil || rope <= 0 || math.IsInf(rope, 0) {
+			http.Error(w, "rope must be a positive number", http.StatusBadRequest)
+			return
+		}
+	}
+	dataset := a.loadDataset(w, r, q)
+	if dataset == nil {
+		return
+	}
+	filter := dataset.Filter
+	report, err := analysis.Analyze(dataset, correction)
+	if err == analysis.ErrTooFewConditions {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	} else if err != nil {
+		a.l.Error("Unable to analyze responses", zap.Error(err))
+		http.Error(w, "An Unknown Error Has Occured, Please Try Again Later", http.StatusInternalServerError)
+		return
+	}
+	mixed := q.Get("model") == "mixed"
+	if mixed {
+		if err = report.FitMixedModel(dataset); err != nil {
+			report.MixedError = err.Error()
+		}
+	}
+	report.Bootstrap(seed)
+	bayes := q.Get("bayes") == "1"
+	if bayes {
+		report.EstimateBayes(seed, rope)
+	}
+
+	if q.Get("format") == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err = enc.Encode(report); err != nil {
+			a.l.Error("Unable to write analysis report", zap.Error(err))
+		}
+		return
+	}
+
+	// The JSON report repeats the page's random draws by reusing its seed
+	jsonQuery := url.Values{"format": {"json"}, "correction": {string(correction)}, "seed": {strconv.FormatInt(seed, 10)}}
+	filter.Encode(jsonQuery)
+	if mixed {
+		jsonQuery.Set("model", "mixed")
+	}
+	if bayes {
+		jsonQuery.Set("bayes", "1")
+		jsonQuery.Set("rope", strconv.FormatFloat(rope, 'f', -1, 64))
+	}
+	chartQuery := url.Values{"correction": {string(correction)}}
+	filter.Encode(chartQuery)
+	reportQuery := url.Values{"correction": {string(correction)}, "seed": {strconv.FormatInt(seed, 10)}}
+	filter.Encode(reportQuery)
+	t := template.Must(template.New("analysis-page").Funcs(analysisFuncs).ParseFS(*a.templates, "templates/analysis.html"))
+	err = t.ExecuteTemplate(w, "analysis.html", struct {
+		Report            *analysis.Report
+		Status            string
+		From              string
+		To                string
+		IncludeExcluded   bool
+		Corrections       []analysis.Correction
+		Mixed             bool
+		Bayes             bool
+		Seed              string
+		ROPE              string
+		JSONURL           string
+		DistributionURL   string
+		ForestURL         string
+		ReportURL         string
+		ConfidencePercent int
+		Alpha             string
+	}{
+		Report:            report,
+		Status:            filter.Status,
+		From:              q.Get("from"),
+		To:                q.Get("to"),
+		IncludeExcluded:   filter.IncludeExcluded,
+		Corrections:       analysis.Corrections,
+		Mixed:             mixed,
+		Bayes:             bayes,
+		Seed:              q.Get("seed"),
+		ROPE:              strconv.FormatFloat(rope, 'f', -1, 64),
+		JSONURL:           "/admin/analysis?" + jsonQuery.Encode(),
+		DistributionURL:   "/admin/analysis/charts/distribution.svg?" + chartQuery.Encode(),
+		ForestURL:         "/admin/analysis/charts/forest.svg?" + chartQuery.Encode(),
+		ReportURL:         "/admin/analysis/report.pdf?" + reportQuery.Encode(),
+		ConfidencePercent: int(math.Round(analysis.Confidence * 100)),
+		Alpha:             fmt.Sprintf("%.2f", 1-analysis.Confidence),
+	})
+	if err != nil {
+		a.l.Error("Unable to render analysis page", zap.Error(err))
+		http.Error(w, "An Unknown Error Has Occured, Please Try Again Later", http.StatusInternalServerError)
+		return
+	}
+}
+
+// ItemsPage analyses how well the articles work as a scale, over all participants and per condition. It takes the
+// export filters, `format=json` and `format=csv` download the report.
+func (a *Admin) ItemsPage(w http.ResponseWriter, r *http.Request) {
+	dataset := a.loadDataset(w, r, r.URL.Query())
+	if dataset == nil {
+		return
+	}
+	items := analysis.AnalyzeItems(dataset)
+	var err error
+	switch r.URL.Query().Get("format") {
+	case "json":
+		attachment(w, "application/json", "item_analysis.json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(items)
+	case "csv":
+		attachment(w, "text/csv", "item_analysis.csv")
+		err = writeItemsCSV(w, items)
+	default:
+		download := func(format string) string {
+			q := url.Values{"format": {format}}
+			dataset.Filter.Encode(q)
+			return "/admin/analysis/items?" + q.Encode()
+		}
+		t := template.Must(template.New("items-page").Funcs(analysisFuncs).Funcs(template.FuncMap{
+			"percent": func(v float64) string {
+				return fmt.Sprintf("%.0f%%", v*100)
+			},
+		}).ParseFS(*a.templates, "templates/items.html"))
+		err = t.ExecuteTemplate(w, "items.html", struct {
+			Items           []analysis.ItemAnalysis
+			Status          string
+			From            string
+			To              string
+			IncludeExcluded bool
+			JSONURL         string
+			CSVURL          string
+			FloorCeiling    string
+			LowItemTotal    string
+		}{
+			Items:           items,
+			Status:          dataset.Filter.Status,
+			From:            r.URL.Query().Get("from"),
+			To:              r.URL.Query().Get("to"),
+			IncludeExcluded: dataset.Filter.IncludeExcluded,
+			JSONURL:         download("json"),
+			CSVURL:          download("csv"),
+			FloorCeiling:    fmt.Sprintf("%.0f%%", analysis.FloorCeilingShare*100),
+			LowItemTotal:    fmt.Sprintf("%.2f", analysis.LowItemTotal),
+		})
+	}
+	if err != nil {
+		a.l.Error("Unable to write item analysis", zap.Error(err))
+	}
+}
+
+// writeItemsCSV writes one row per group and article, repeating the group's reliability on each row
+func writeItemsCSV(w io.Writer, items []analysis.ItemAnalysis) error {
+	optional := func(v *float64) string {
+		if v == nil {
+			return ""
+		}
+		return strconv.FormatFloat(*v, 'f', -1, 64)
+	}
+	number := func(v float64) string {
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	csvWriter := csv.NewWriter(w)
+	err := csvWriter.Write([]string{
+		"condition", "complete_cases", "alpha", "omega", "article_id", "title", "veracity", "mean", "variance",
+		"item_total", "alpha_if_deleted", "loading", "floor", "ceiling", "floor_flag", "ceiling_flag", "low_item_total",
+	})
+	if err != nil {
+		return err
+	}
+	for _, ia := range items {
+		for _, s := range ia.Items {
+			err = csvWriter.Write([]string{
+				ia.Condition, strconv.Itoa(ia.CompleteCases), optional(ia.Alpha), optional(ia.Omega),
+				s.ArticleID, s.Title, string(s.Veracity), number(s.Mean), number(s.Variance),
+				optional(s.ItemTotal), optional(s.AlphaIfDeleted), optional(s.Loading), number(s.Floor), number(s.Ceiling),
+				strconv.FormatBool(s.FloorFlag), strconv.FormatBool(s.CeilingFlag), strconv.FormatBool(s.LowItemTotal),
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	csvWriter.Flush()
+	return csvWriter.Error()
+}
+
+// IRTPage calibrates the articles with a graded response model. It takes the export filters, `format=json` downloads
+// the whole model and `format=csv` participants' latent scores.
+func (a *Admin) IRTPage(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(userFromContext{}).(models.User)
+	q := r.URL.Query()
+	dataset := a.loadDataset(w, r, q)
+	if dataset == nil {
+		return
+	}
+	model, err := analysis.FitGradedResponse(dataset)
+	if err == analysis.ErrTooFewRatings {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	} else if err != nil {
+		a.l.Error("Unable to fit graded response model", zap.Error(err))
+		http.Error(w, "An Unknown Error Has Occured, Please Try Again Later", http.StatusInternalServerError)
+		return
+	}
+	switch q.Get("format") {
+	case "json":
+		attachment(w, "application/json", "irt.json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(model)
+	case "csv":
+		attachment(w, "text/csv", "irt_scores.csv")
+		err = writeScoresCSV(w, model.Scores)
+	default:
+		canCalibrate := user.Role.Can(models.PermManageStudy)
+		csrfToken := ""
+		if canCalibrate {
+			csrfToken, err = utils.CSRFToken(r, w, a.sess)
+			if err != nil {
+				a.l.Error("Unable to issue CSRF token", zap.Error(err))
+				http.Error(w, "An Unknown Error Has Occured, Please Try Again Later", http.StatusInternalServerError)
+				return
+			}
+		}
+		download := func(format string) string {
+			q := url.Values{"format": {format}}
+			dataset.Filter.Encode(q)
+			return "/admin/analysis/irt?" + q.Encode()
+		}
+		stored := make([]*models.Calibration, len(dataset.Articles))
+		for i, article := range dataset.Articles {
+			stored[i] = article.Calibration
+		}
+		t := template.Must(template.New("irt-page").Funcs(analysisFuncs).ParseFS(*a.templates, "templates/irt.html"))
+		err = t.ExecuteTemplate(w, "irt.html", struct {
+			Model           *analysis.GradedResponse
+			Scores          []analysis.Descriptives
+			Stored          []*models.Calibration
+			Saved           string
+			CanCalibrate    bool
+			CSRFToken       string
+			Status          string
+			From            string
+			To              string
+			IncludeExcluded bool
+			JSONURL         string
+			CSVURL          string
+		}{
+			Model:           model,
+			Scores:          model.ScoreDescriptives(),
+			Stored:          stored,
+			Saved:           q.Get("saved"),
+			CanCalibrate:    canCalibrate,
+			CSRFToken:       csrfToken,
+			Status:          dataset.Filter.Status,
+			From:            q.Get("from"),
+			To:              q.Get("to"),
+			IncludeExcluded: dataset.Filter.IncludeExcluded,
+			JSONURL:         download("json"),
+			CSVURL:          download("csv"),
+		})
+	}
+	if err != nil {
+		a.l.Error("Unable to write graded response model", zap.Error(err))
+	}
+}
+
+// CalibrateArticles refits the graded response model with the submitted filters and stores every article's parameters
+// on it, replacing earlier calibrations
+func (a *Admin) CalibrateArticles(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(userFromContext{}).(models.User)
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "An Unknown Error Has Occured, Please Try Again Later", http.StatusBadRequest)
+		return
+	}
+	dataset := a.loadDataset(w, r, r.PostForm)
+	if dataset == nil {
+		return
+	}
+	model, err := analysis.FitGradedResponse(dataset)
+	if err == analysis.ErrTooFewRatings {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	} else if err != nil {
+		a.l.Error("Unable to fit graded response model", zap.Error(err))
+		http.Error(w, "An Unknown Error Has Occured, Please Try Again Later", http.StatusInternalServerError)
+		return
+	}
+	calibrations := make(map[primitive.ObjectID]models.Calibration, len(dataset.Articles))
+	for i, article := range dataset.Articles {
+		calibrations[article.ID] = model.Items[i].Calibration(dataset.Study.Scale, dataset.ExportedOn)
+	}
+	mongoContext, mongoCancel := context.WithTimeout(r.Context(), time.Second*15)
+	defer mongoCancel()
+	if err := models.SaveCalibrations(mongoContext, a.db, calibrations); err != nil {
+		a.l.Error("Unable to save article calibrations", zap.Error(err))
+		http.Error(w, "An Unknown Error Has Occured, Please Try Again Later", http.StatusInternalServerError)
+		return
+	}
+	a.l.Info("Articles calibrated by admin", zap.String("Admin", user.ID.Hex()), zap.Int("Articles", len(calibrations)))
+	q := url.Values{"saved": {strconv.Itoa(len(calibrations))}}
+	dataset.Filter.Encode(q)
+	http.Redirect(w, r, "/admin/analysis/irt?"+q.Encode(), http.StatusFound)
+}
+
+// writeScoresCSV writes one row of latent scores per participant
+func writeScoresCSV(w io.Writer, scores []analysis.LatentScore) error {
+	csvWriter := csv.NewWriter(w)
+	if err := csvWriter.Write([]string{"pseudonym", "condition", "ratings", "theta", "se"}); err != nil {
+		return err
+	}
+	for _, s := range scores {
+		err := csvWriter.Write([]string{
+			s.Pseudonym, s.Condition, strconv.Itoa(s.Ratings),
+			strconv.FormatFloat(s.Theta, 'f', -1, 64), strconv.FormatFloat(s.SE, 'f', -1, 64),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	csvWriter.Flush()
+	return csvWriter.Error()
+}
+
+// QualityPage lists every participant's quality indicators and the flags they raised. It takes the export filters,
+// `format=json` downloads the reports and `format=csv` the same as a table.
+func (a *Admin) QualityPage(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(userFromContext{}).(models.User)
+	q := r.URL.Query()
+	dataset := a.loadDataset(w, r, q)
+	if dataset == nil {
+		return
+	}
+	reports := analysis.AssessQuality(dataset)
+	var err error
+	switch q.Get("format") {
+	case "json":
+		attachment(w, "application/json", "quality.json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(reports)
+	case "csv":
+		attachment(w, "text/csv", "quality.csv")
+		err = writeQualityCSV(w, reports)
+	default:
+		canEdit := user.Role.Can(models.PermManageStudy)
+		csrfToken := ""
+		if canEdit {
+			csrfToken, err = utils.CSRFToken(r, w, a.sess)
+			if err != nil {
+				a.l.Error("Unable to issue CSRF token", zap.Error(err))
+				http.Error(w, "An Unknown Error Has Occured, Please Try Again Later", http.StatusInternalServerError)
+				return
+			}
+		}
+		type flagCount struct {
+			Flag  string
+			Count int
+		}
+		counts := make([]flagCount, len(analysis.QualityFlags))
+		flagged := 0
+		for i, flag := range analysis.QualityFlags {
+			counts[i].Flag = flag
+			for _, report := range reports {
+				if report.Has(flag) {
+					counts[i].Count++
+				}
+			}
+		}
+		for _, report := range reports {
+			if report.Flagged() {
+				flagged++
+			}
+		}
+		download := func(format string) string {
+			q := url.Values{"format": {format}}
+			dataset.Filter.Encode(q)
+			return "/admin/analysis/quality?" + q.Encode()
+		}
+		t := template.Must(template.New("quality-page").Funcs(analysisFuncs).ParseFS(*a.templates, "templates/quality.html"))
+		err = t.ExecuteTemplate(w, "quality.html", struct {
+			Reports         []analysis.QualityReport
+			Counts          []flagCount
+			Flagged         int
+			Checks          int
+			Thresholds      models.Quality
+			Saved           bool
+			CanEdit         bool
+			CSRFToken       string
+			Status          string
+			From            string
+			To              string
+			IncludeExcluded bool
+			JSONURL         string
+			CSVURL          string
+		}{
+			Reports:         reports,
+			Counts:          counts,
+			Flagged:         flagged,
+			Checks:          len(dataset.Checks),
+			Thresholds:      dataset.Study.Quality.WithDefaults(),
+			Saved:           q.Get("saved") != "",
+			CanEdit:         canEdit,
+			CSRFToken:       csrfToken,
+			Status:          dataset.Filter.Status,
+			From:            q.Get("from"),
+			To:              q.Get("to"),
+			IncludeExcluded: dataset.Filter.IncludeExcluded,
+			JSONURL:         download("json"),
+			CSVURL:          download("csv"),
+		})
+	}
+	if err != nil {
+		a.l.Error("Unable to write quality report", zap.Error(err))
+	}
+}
+
+// SaveQualityThresholds stores the submitted quality thresholds on the study
+func (a *Admin) SaveQualityThresholds(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(userFromContext{}).(models.User)
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "An Unknown Error Has Occured, Please Try Again Later", http.StatusBadRequest)
+		return
+	}
+	var quality models.Quality
+	floats := map[string]*float64{
+		"speeder_share":     &quality.SpeederShare,
+		"fast_item_seconds": &quality.FastItemSeconds,
+		"fast_item_share":   &quality.FastItemShare,
+		"min_sd":            &quality.MinSD,
+	}
+	for name, field := range floats {
+		v, err := strconv.ParseFloat(r.PostForm.Get(name), 64)
+		if err != nil || v <= 0 || math.IsInf(v, 0) {
+			http.Error(w, fmt.Sprintf("%s must be a positive number", name), http.StatusBadRequest)
+			return
+		}
+		*field = v
+	}
+	ints := map[string]*int{
+		"min_ratings":   &quality.MinRatings,
+		"failed_checks": &quality.FailedChecks,
+	}
+	for name, field := range ints {
+		v, err := strconv.Atoi(r.PostForm.Get(name))
+		if err != nil || v <= 0 {
+			http.Error(w, fmt.Sprintf("%s must be a positive whole number", name), http.StatusBadRequest)
+			return
+		}
+		*field = v
+	}
+	if quality.SpeederShare > 1 || quality.FastItemShare > 1 {
+		http.Error(w, "speeder_share and fast_item_share must not be above 1", http.StatusBadRequest)
+		return
+	}
+	mongoContext, mongoCancel := context.WithTimeout(r.Context(), time.Second*5)
+	defer mongoCancel()
+	if err := models.SaveQuality(mongoContext, a.db, quality); err != nil {
+		a.l.Error("Unable to save quality thresholds", zap.Error(err))
+		http.Error(w, "An Unknown Error Has Occured, Please Try Again Later", http.StatusInternalServerError)
+		return
+	}
+	a.l.Info("Quality thresholds changed by admin", zap.String("Admin", user.ID.Hex()))
+	q := url.Values{"saved": {"1"}}
+	filter, err := models.ParseParticipantFilter(r.PostForm)
+	if err == nil {
+		filter.Encode(q)
+	}
+	http.Redirect(w, r, "/admin/analysis/quality?"+q.Encode(), http.StatusFound)
+}
+
+// writeQualityCSV writes one row of quality indicators per participant, leaving indicators that could not be computed
+// empty
+func writeQualityCSV(w io.Writer, reports []analysis.QualityReport) error {
+	csvWriter := csv.NewWriter(w)
+	header := []string{"pseudonym", "condition", "ratings", "duration_seconds", "timed_items", "fast_items", "rating_sd",
+		"checks_answered", "checks_failed", "shared_devices", "flags"}
+	if err := csvWriter.Write(header); err != nil {
+		return err
+	}
+	optional := func(v *float64) string {
+		if v == nil {
+			return ""
+		}
+		return strconv.FormatFloat(*v, 'f', -1, 64)
+	}
+	for _, q := range reports {
+		err := csvWriter.Write([]string{
+			q.Pseudonym, q.Condition, strconv.Itoa(q.Ratings), optional(q.Duration), strconv.Itoa(q.TimedItems),
+			strconv.Itoa(q.FastItems), optional(q.SD), strconv.Itoa(q.ChecksAnswered), strconv.Itoa(q.ChecksFailed),
+			strconv.Itoa(q.SharedDevices), strings.Join(q.Flags, " "),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	csvWriter.Flush()
+	return csvWriter.Error()
+}
@@ -0,0 +1,587 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/superc03/carp/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+const (
+	apiDefaultPerPage = 100
+	apiMaxPerPage     = 1000
+)
+
+type API struct {
+	l  *zap.Logger
+	db *mongo.Database
+}
+
+func NewAPI(
+	l *zap.Logger,
+	db *mongo.Database,
+) *API {
+	return &API{
+		l, db,
+	}
+}
+
+type apiTokenFromContext struct{}
+
+// Register adds every documented API operation to the router, wrapped in token authentication and a check for the
+// operation's scope
+func (a *API) Register(router *mux.Router) {
+	router.HandleFunc("/openapi.json", a.OpenAPI).Methods(http.MethodGet)
+	authed := router.NewRoute().Subrouter()
+	authed.Use(a.TokenMiddleware)
+	for _, op := range apiOperations {
+		handler, scope := op.Handler, op.Scope
+		authed.HandleFunc(op.Path, func(w http.ResponseWriter, r *http.Request) {
+			token := r.Context().Value(apiTokenFromContext{}).(models.APIToken)
+			if !token.Has(scope) {
+				a.writeError(w, http.StatusForbidden, "this API token lacks the `"+string(scope)+"` scope")
+				return
+			}
+			handler(a, w, r)
+		}).Methods(op.Method)
+	}
+}
+
+// TokenMiddleware authenticates requests with an `Authorization: Bearer carp_...` API token and logs every request
+// made with a valid token
+func (a *API) TokenMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		plain := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		mongoContext, mongoCancel := context.WithTimeout(r.Context(), time.Second*5)
+		defer mongoCancel()
+		token, err := models.FindAPIToken(mongoContext, a.db, plain)
+		if err == mongo.ErrNoDocuments {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="carp"`)
+			a.writeError(w, http.StatusUnauthorized, "a valid API token is required")
+			return
+		} else if err != nil {
+			a.l.Error("Unable to look up API token", zap.Error(err))
+			a.writeError(w, http.StatusInternalServerError, "an unknown error has occured")
+			return
+		}
+		ctx := context.WithValue(r.Context(), apiTokenFromContext{}, *token)
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		// The request context may already be cancelled once the response is written
+		logContext, logCancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer logCancel()
+		err = models.RecordAPITokenUse(logContext, a.db, models.APITokenUse{
+			TokenID:    token.ID,
+			Method:     r.Method,
+			Path:       r.URL.RequestURI(),
+			Status:     rec.status,
+			RemoteAddr: r.RemoteAddr,
+			UsedOn:     time.Now(),
+		})
+		if err != nil {
+			a.l.Error("Unable to record API token use", zap.Error(err))
+		}
+	})
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	s.status = status
+	s.ResponseWriter.WriteHeader(status)
+}
+
+type apiError struct {
+	Error string `json:"error"`
+}
+
+type apiPage struct {
+	Data    interface{} `json:"data"`
+	Page    int         `json:"page"`
+	PerPage int         `json:"per_page"`
+	Total   int         `json:"total"`
+	Next    string      `json:"next,omitempty"`
+}
+
+type apiArticle struct {
+	ID             string              `json:"id"`
+	Title          string              `json:"title"`
+	PictureCode    string              `json:"picture_code"`
+	Veracity       models.Veracity     `json:"veracity" enum:",true,false"`
+	Source         string              `json:"source"`
+	Topic          string              `json:"topic"`
+	Lean           models.Lean         `json:"lean" enum:",left,center,right,neutral"`
+	AttentionCheck *int                `json:"attention_check"`
+	Calibration    *models.Calibration `json:"calibration"`
+}
+
+func newAPIArticle(a models.Article) apiArticle {
+	return apiArticle{
+		ID:             a.ID.Hex(),
+		Title:          a.Title,
+		PictureCode:    a.PictureCode,
+		Veracity:       a.Veracity,
+		Source:         a.Source,
+		Topic:          a.Topic,
+		Lean:           a.Lean,
+		AttentionCheck: a.AttentionCheck,
+		Calibration:    a.Calibration,
+	}
+}
+
+type apiParticipant struct {
+	Pseudonym   string     `json:"pseudonym"`
+	Condition   string     `json:"condition"`
+	Status      string     `json:"status"`
+	Responses   int        `json:"responses"`
+	CreatedOn   time.Time  `json:"created_on"`
+	StartedOn   *time.Time `json:"started_on"`
+	CompletedOn *time.Time `json:"completed_on"`
+	Excluded    bool       `json:"excluded"`
+}
+
+type apiArticleInput struct {
+	Title          string `json:"title"`
+	PictureCode    string `json:"picture_code"`
+	Veracity       string `json:"veracity" enum:",true,false"`
+	Source         string `json:"source"`
+	Topic          string `json:"topic"`
+	Lean           string `json:"lean" enum:",left,center,right,neutral"`
+	AttentionCheck *int   `json:"attention_check"`
+}
+
+type apiParticipantInput struct {
+	Condition string `json:"condition"`
+}
+
+type apiResponse struct {
+	Participant string `json:"participant"`
+	Condition   string `json:"condition"`
+	ArticleID   string `json:"article_id"`
+	Value       int    `json:"value"`
+}
+
+// Studies lists the study carp is collecting data for
+func (a *API) Studies(w http.ResponseWriter, r *http.Request) {
+	page, perPage, err := parsePagination(r.URL.Query())
+	if err != nil {
+		a.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	mongoContext, mongoCancel := context.WithTimeout(r.Context(), time.Second*5)
+	defer mongoCancel()
+	study, err := models.LoadStudy(mongoContext, a.db)
+	if err != nil {
+		a.l.Error("Unable to load study", zap.Error(err))
+		a.writeError(w, http.StatusInternalServerError, "an unknown error has occured")
+		return
+	}
+	items := []models.Study{}
+	if page == 1 {
+		items = append(items, *study)
+	}
+	a.writePage(w, r, apiPage{Data: items, Page: page, PerPage: perPage, Total: 1}, nil)
+}
+
+// Articles lists the articles participants rate
+func (a *API) Articles(w http.ResponseWriter, r *http.Request) {
+	page, perPage, err := parsePagination(r.URL.Query())
+	if err != nil {
+		a.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	mongoContext, mongoCancel := context.WithTimeout(r.Context(), time.Second*15)
+	defer mongoCancel()
+	total, err := a.db.Collection("articles").CountDocuments(mongoContext, bson.D{})
+	if err != nil {
+		a.l.Error("Unable to count articles", zap.Error(err))
+		a.writeError(w, http.StatusInternalServerError, "an unknown error has occured")
+		return
+	}
+	opts := options.Find().SetSort(bson.M{"_id": 1}).SetSkip(pageSkip(page, perPage)).SetLimit(int64(perPage))
+	cursor, err := a.db.Collection("articles").Find(mongoContext, bson.D{}, opts)
+	if err != nil {
+		a.l.Error("Unable to Accumulate all Article Codes", zap.Error(err))
+		a.writeError(w, http.StatusInternalServerError, "an unknown error has occured")
+		return
+	}
+	articles := make([]models.Article, 0)
+	if err = cursor.All(mongoContext, &articles); err != nil {
+		a.l.Error("Unable to Accumulate all Article Codes", zap.Error(err))
+		a.writeError(w, http.StatusInternalServerError, "an unknown error has occured")
+		return
+	}
+	items := make([]apiArticle, len(articles))
+	for i, v := range articles {
+		items[i] = newAPIArticle(v)
+	}
+	a.writePage(w, r, apiPage{Data: items, Page: page, PerPage: perPage, Total: int(total)}, nil)
+}
+
+// Participants lists pseudonymized participants, filtered by condition, completion status and sign-in date. Excluded
+// participants are only listed with `excluded=include`.
+func (a *API) Participants(w http.ResponseWriter, r *http.Request) {
+	filter, err := models.ParseParticipantFilter(r.URL.Query())
+	if err != nil {
+		a.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	page, perPage, err := parsePagination(r.URL.Query())
+	if err != nil {
+		a.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	mongoContext, mongoCancel := context.WithTimeout(r.Context(), time.Second*15)
+	defer mongoCancel()
+	articleCount, err := a.db.Collection("articles").CountDocuments(mongoContext, bson.D{})
+	if err != nil {
+		a.l.Error("Unable to count articles", zap.Error(err))
+		a.writeError(w, http.StatusInternalServerError, "an unknown error has occured")
+		return
+	}
+	users, total, err := models.FindParticipantsPage(mongoContext, a.db, filter, pageSkip(page, perPage), int64(perPage))
+	if err != nil {
+		a.l.Error("Unable to Accumulate all Users", zap.Error(err))
+		a.writeError(w, http.StatusInternalServerError, "an unknown error has occured")
+		return
+	}
+	items := make([]apiParticipant, len(users))
+	for i, u := range users {
+		items[i] = apiParticipant{
+			Pseudonym:   u.Pseudonym,
+			Condition:   models.ConditionCode(u.SurveyType),
+			Status:      u.Status(int(articleCount)),
+			Responses:   len(u.Data),
+			CreatedOn:   u.CreatedOn,
+			StartedOn:   u.StartedOn,
+			CompletedOn: u.CompletedOn,
+			Excluded:    u.Excluded,
+		}
+	}
+	a.writePage(w, r, apiPage{Data: items, Page: page, PerPage: perPage, Total: int(total)}, &filter)
+}
+
+// Responses lists one rating per participant and article, filtered like Participants and optionally by `article`
+func (a *API) Responses(w http.ResponseWriter, r *http.Request) {
+	filter, err := models.ParseParticipantFilter(r.URL.Query())
+	if err != nil {
+		a.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	page, perPage, err := parsePagination(r.URL.Query())
+	if err != nil {
+		a.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	mongoContext, mongoCancel := context.WithTimeout(r.Context(), time.Second*15)
+	defer mongoCancel()
+	articleIDs, err := a.articleIDs(mongoContext)
+	if err != nil {
+		a.l.Error("Unable to Accumulate all Article Codes", zap.Error(err))
+		a.writeError(w, http.StatusInternalServerError, "an unknown error has occured")
+		return
+	}
+	if onlyArticle := r.URL.Query().Get("article"); onlyArticle != "" {
+		only := []primitive.ObjectID{}
+		for _, id := range articleIDs {
+			if id.Hex() == onlyArticle {
+				only = append(only, id)
+			}
+		}
+		articleIDs = only
+	}
+	ratings, total, err := models.FindRatingsPage(mongoContext, a.db, filter, articleIDs, pageSkip(page, perPage), int64(perPage))
+	if err != nil {
+		a.l.Error("Unable to Accumulate all Users", zap.Error(err))
+		a.writeError(w, http.StatusInternalServerError, "an unknown error has occured")
+		return
+	}
+	items := make([]apiResponse, len(ratings))
+	for i, v := range ratings {
+		items[i] = apiResponse{
+			Participant: v.Pseudonym,
+			Condition:   models.ConditionCode(v.SurveyType),
+			ArticleID:   v.ArticleID,
+			Value:       v.Value,
+		}
+	}
+	a.writePage(w, r, apiPage{Data: items, Page: page, PerPage: perPage, Total: int(total)}, &filter)
+}
+
+// CreateArticle adds an article to the survey
+func (a *API) CreateArticle(w http.ResponseWriter, r *http.Request) {
+	article, ok := a.readArticle(w, r)
+	if !ok {
+		return
+	}
+	mongoContext, mongoCancel := context.WithTimeout(r.Context(), time.Second*5)
+	defer mongoCancel()
+	res, err := a.db.Collection("articles").InsertOne(mongoContext, article)
+	if err != nil {
+		a.l.Error("Unable to insert article", zap.Error(err))
+		a.writeError(w, http.StatusInternalServerError, "an unknown error has occured")
+		return
+	}
+	article.ID = res.InsertedID.(primitive.ObjectID)
+	a.writeJSON(w, http.StatusCreated, newAPIArticle(article))
+}
+
+// UpdateArticle replaces an article's title, picture and metadata, keeping its calibration
+func (a *API) UpdateArticle(w http.ResponseWriter, r *http.Request) {
+	id, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		a.writeError(w, http.StatusNotFound, "no such article")
+		return
+	}
+	article, ok := a.readArticle(w, r)
+	if !ok {
+		return
+	}
+	mongoContext, mongoCancel := context.WithTimeout(r.Context(), time.Second*5)
+	defer mongoCancel()
+	// The calibration is estimated from ratings rather than edited, so it is left as it is
+	err = a.db.Collection("articles").FindOneAndUpdate(mongoContext, bson.M{"_id": id}, bson.M{"$set": bson.M{
+		"title":           article.Title,
+		"picture_code":    article.PictureCode,
+		"veracity":        article.Veracity,
+		"source":          article.Source,
+		"topic":           article.Topic,
+		"lean":            article.Lean,
+		"attention_check": article.AttentionCheck,
+	}}, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&article)
+	if err == mongo.ErrNoDocuments {
+		a.writeError(w, http.StatusNotFound, "no such article")
+		return
+	} else if err != nil {
+		a.l.Error("Unable to update article", zap.Error(err))
+		a.writeError(w, http.StatusInternalServerError, "an unknown error has occured")
+		return
+	}
+	a.writeJSON(w, http.StatusOK, newAPIArticle(article))
+}
+
+// DeleteArticle removes an article nobody has rated yet. Rated articles are kept so existing data stays complete.
+func (a *API) DeleteArticle(w http.ResponseWriter, r *http.Request) {
+	id, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		a.writeError(w, http.StatusNotFound, "no such article")
+		return
+	}
+	mongoContext, mongoCancel := context.WithTimeout(r.Context(), time.Second*5)
+	defer mongoCancel()
+	rated, err := a.db.Collection("users").CountDocuments(mongoContext, bson.M{"survey_data." + id.Hex(): bson.M{"$exists": true}})
+	if err != nil {
+		a.l.Error("Unable to count article responses", zap.Error(err))
+		a.writeError(w, http.StatusInternalServerError, "an unknown error has occured")
+		return
+	}
+	if rated > 0 {
+		a.writeError(w, http.StatusConflict, "this article has already been rated and cannot be deleted")
+		return
+	}
+	res, err := a.db.Collection("articles").DeleteOne(mongoContext, bson.M{"_id": id})
+	if err != nil {
+		a.l.Error("Unable to delete article", zap.Error(err))
+		a.writeError(w, http.StatusInternalServerError, "an unknown error has occured")
+		return
+	}
+	if res.DeletedCount == 0 {
+		a.writeError(w, http.StatusNotFound, "no such article")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// UpdateParticipant moves a participant who has not rated anything yet into another condition
+func (a *API) UpdateParticipant(w http.ResponseWriter, r *http.Request) {
+	input := apiParticipantInput{}
+	if !a.readJSON(w, r, &input) {
+		return
+	}
+	surveyType, err := models.ParseCondition(input.Condition)
+	if err != nil {
+		a.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	mongoContext, mongoCancel := context.WithTimeout(r.Context(), time.Second*5)
+	defer mongoCancel()
+	user := models.User{}
+	err = a.db.Collection("users").FindOne(mongoContext, bson.M{"pseudonym": mux.Vars(r)["pseudonym"], "role": models.RoleParticipant}).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		a.writeError(w, http.StatusNotFound, "no such participant")
+		return
+	} else if err != nil {
+		a.l.Error("Unable to search for user in database", zap.Error(err))
+		a.writeError(w, http.StatusInternalServerError, "an unknown error has occured")
+		return
+	}
+	// Only reassign while nothing is rated, filtering on it again so a concurrent rating cannot slip in between
+	res, err := a.db.Collection("users").UpdateOne(mongoContext,
+		bson.M{"_id": user.ID, "$or": bson.A{
+			bson.M{"survey_data": bson.M{"$exists": false}},
+			bson.M{"survey_data": bson.M{}},
+		}},
+		bson.M{"$set": bson.M{"survey_type": surveyType, "updated_on": time.Now()}},
+	)
+	if err != nil {
+		a.l.Error("Unable to update participant", zap.Error(err))
+		a.writeError(w, http.StatusInternalServerError, "an unknown error has occured")
+		return
+	}
+	if res.MatchedCount == 0 {
+		a.writeError(w, http.StatusConflict, "this participant has already rated articles and cannot change condition")
+		return
+	}
+	user.SurveyType = surveyType
+	a.writeJSON(w, http.StatusOK, apiParticipant{
+		Pseudonym:   user.Pseudonym,
+		Condition:   models.ConditionCode(user.SurveyType),
+		Status:      models.StatusNotStarted,
+		CreatedOn:   user.CreatedOn,
+		StartedOn:   user.StartedOn,
+		CompletedOn: user.CompletedOn,
+	})
+}
+
+// readArticle decodes and validates an article from the request body, answering with 400 and returning false if it
+// is not valid
+func (a *API) readArticle(w http.ResponseWriter, r *http.Request) (models.Article, bool) {
+	input := apiArticleInput{}
+	if !a.readJSON(w, r, &input) {
+		return models.Article{}, false
+	}
+	article := models.Article{
+		Title:       strings.TrimSpace(input.Title),
+		PictureCode: strings.TrimSpace(input.PictureCode),
+		Source:      strings.TrimSpace(input.Source),
+		Topic:       strings.TrimSpace(input.Topic),
+	}
+	if article.Title == "" {
+		a.writeError(w, http.StatusBadRequest, "`title` is required")
+		return article, false
+	}
+	var err error
+	if article.Veracity, err = models.ParseVeracity(strings.TrimSpace(input.Veracity)); err != nil {
+		a.writeError(w, http.StatusBadRequest, err.Error())
+		return article, false
+	}
+	if article.Lean, err = models.ParseLean(strings.TrimSpace(input.Lean)); err != nil {
+		a.writeError(w, http.StatusBadRequest, err.Error())
+		return article, false
+	}
+	if input.AttentionCheck != nil {
+		mongoContext, mongoCancel := context.WithTimeout(r.Context(), time.Second*5)
+		defer mongoCancel()
+		study, err := models.LoadStudy(mongoContext, a.db)
+		if err != nil {
+			a.l.Error("Unable to load study", zap.Error(err))
+			a.writeError(w, http.StatusInternalServerError, "an unknown error has occured")
+			return article, false
+		}
+		if *input.AttentionCheck < study.Scale.Min || *input.AttentionCheck > study.Scale.Max {
+			a.writeError(w, http.StatusBadRequest, fmt.Sprintf("`attention_check` must be between %d and %d",
+				study.Scale.Min, study.Scale.Max))
+			return article, false
+		}
+		article.AttentionCheck = input.AttentionCheck
+	}
+	return article, true
+}
+
+// readJSON decodes the request body into v, answering with 400 and returning false if it is not valid
+func (a *API) readJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		a.writeError(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		return false
+	}
+	return true
+}
+
+func (a *API) articleIDs(ctx context.Context) ([]primitive.ObjectID, error) {
+	values, err := a.db.Collection("articles").Distinct(ctx, "_id", bson.D{})
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]primitive.ObjectID, 0, len(values))
+	for _, v := range values {
+		if id, ok := v.(primitive.ObjectID); ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// writePage writes one page of results, which the database query already skipped to and limited, and links to the
+// next page while there are more
+func (a *API) writePage(w http.ResponseWriter, r *http.Request, result apiPage, filter *models.ParticipantFilter) {
+	if result.Page*result.PerPage < result.Total {
+		q := url.Values{}
+		if filter != nil {
+			filter.Encode(q)
+		}
+		if v := r.URL.Query().Get("article"); v != "" {
+			q.Set("article", v)
+		}
+		q.Set("page", strconv.Itoa(result.Page+1))
+		q.Set("per_page", strconv.Itoa(result.PerPage))
+		result.Next = r.URL.Path + "?" + q.Encode()
+	}
+	a.writeJSON(w, http.StatusOK, result)
+}
+
+func (a *API) writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		a.l.Error("Unable to encode API response", zap.Error(err))
+	}
+}
+
+func (a *API) writeError(w http.ResponseWriter, status int, message string) {
+	a.writeJSON(w, status, apiError{Error: message})
+}
+
+func parsePagination(q url.Values) (int, int, error) {
+	page, perPage := 1, apiDefaultPerPage
+	var err error
+	if v := q.Get("page"); v != "" {
+		if page, err = strconv.Atoi(v); err != nil || page < 1 {
+			return 0, 0, errBadQuery("page")
+		}
+	}
+	if v := q.Get("per_page"); v != "" {
+		if perPage, err = strconv.Atoi(v); err != nil || perPage < 1 || perPage > apiMaxPerPage {
+			return 0, 0, errBadQuery("per_page")
+		}
+	}
+	return page, perPage, nil
+}
+
+// pageSkip is how many results come before the given page
+func pageSkip(page, perPage int) int64 {
+	return int64(page-1) * int64(perPage)
+}
+
+type errBadQuery string
+
+func (e errBadQuery) Error() string {
+	return "invalid `" + string(e) + "` parameter"
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/superc03/carp/analysis"
+	"github.com/superc03/carp/chart"
+	"github.com/superc03/carp/models"
+	"go.uber.org/zap"
+)
+
+// EnrollmentChart draws how many participants signed in over time as SVG
+func (a *Admin) EnrollmentChart(w http.ResponseWriter, r *http.Request) {
+	mongoContext, mongoCancel := context.WithTimeout(r.Context(), time.Second*15)
+	defer mongoCancel()
+	progress, err := models.LoadProgress(mongoContext, a.db, a.loc)
+	if err != nil {
+		a.l.Error("Unable to load study progress", zap.Error(err))
+		http.Error(w, "An Unknown Error Has Occured, Please Try Again Later", http.StatusInternalServerError)
+		return
+	}
+	a.writeChart(w, r, "enrollment", chart.Enrollment(progress.Enrollment))
+}
+
+// AnalysisChart draws the `distribution` of ratings per condition or the `forest` plot of condition effects per
+// article as SVG. It takes the export filters along with `correction`, which decides which articles are highlighted.
+func (a *Admin) AnalysisChart(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	name := mux.Vars(r)["chart"]
+	if name != "distribution" && name != "forest" {
+		http.NotFound(w, r)
+		return
+	}
+	correction, err := analysis.ParseCorrection(q.Get("correction"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	dataset := a.loadDataset(w, r, q)
+	if dataset == nil {
+		return
+	}
+	if name == "distribution" {
+		a.writeChart(w, r, name, chart.RatingDistribution(dataset))
+		return
+	}
+	report, err := analysis.Analyze(dataset, correction)
+	if err == analysis.ErrTooFewConditions {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	} else if err != nil {
+		a.l.Error("Unable to analyze responses", zap.Error(err))
+		http.Error(w, "An Unknown Error Has Occured, Please Try Again Later", http.StatusInternalServerError)
+		return
+	}
+	a.writeChart(w, r, name, chart.ForestPlot(report))
+}
+
+// writeChart sends a chart as SVG, as a download named after it with `download=1`
+func (a *Admin) writeChart(w http.ResponseWriter, r *http.Request, name string, c *chart.Canvas) {
+	if r.URL.Query().Get("download") == "1" {
+		attachment(w, "image/svg+xml", name+".svg")
+	} else {
+		w.Header().Set("Content-Type", "image/svg+xml")
+	}
+	if err := c.WriteSVG(w); err != nil {
+		a.l.Error("Unable to write chart", zap.String("Chart", name), zap.Error(err))
+	}
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// eventStreamLifetime ends each stream before the server's write timeout; browsers reconnect on their own
+	eventStreamLifetime = 50 * time.Second
+	eventStreamRetry    = 1000
+	eventStreamPing     = 15 * time.Second
+)
+
+// EventStream pushes rating and completion events to the dashboard as Server-Sent Events
+func (a *Admin) EventStream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming is not Supported", http.StatusInternalServerError)
+		return
+	}
+	events, unsubscribe := a.events.Subscribe()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	fmt.Fprintf(w, "retry: %d\n\n", eventStreamRetry)
+	flusher.Flush()
+
+	lifetime := time.NewTimer(eventStreamLifetime)
+	defer lifetime.Stop()
+	ping := time.NewTicker(eventStreamPing)
+	defer ping.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-lifetime.C:
+			return
+		case <-ping.C:
+			fmt.Fprint(w, ": ping\n\n")
+		case e := <-events:
+			data, err := json.Marshal(e)
+			if err != nil {
+				a.l.Error("Unable to encode live event", zap.Error(err))
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data)
+		}
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"context"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/superc03/carp/models"
+	"github.com/superc03/carp/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/zap"
+)
+
+// ExclusionsPage lists every participant who has been excluded along with the history of decisions about them, and
+// lets a study owner exclude or reinstate participants. `pseudonym` fills in the participant to exclude.
+func (a *Admin) ExclusionsPage(w http.ResponseWriter, r *http.Request) {
+	a.renderExclusionsPage(w, r, "")
+}
+
+func (a *Admin) renderExclusionsPage(w http.ResponseWriter, r *http.Request, message string) {
+	user := r.Context().Value(userFromContext{}).(models.User)
+	mongoContext, mongoCancel := context.WithTimeout(r.Context(), time.Second*5)
+	defer mongoCancel()
+	participants, err := models.ExclusionHistory(mongoContext, a.db)
+	if err != nil {
+		a.l.Error("Unable to list excluded participants", zap.Error(err))
+		http.Error(w, "An Unknown Error Has Occured, Please Try Again Later", http.StatusInternalServerError)
+		return
+	}
+	deciders := make([]primitive.ObjectID, 0)
+	for _, p := range participants {
+		for _, e := range p.Exclusions {
+			deciders = append(deciders, e.By)
+		}
+	}
+	emails, err := a.vault.Emails(mongoContext, deciders)
+	if err != nil {
+		a.l.Error("Unable to look up admin emails", zap.Error(err))
+		http.Error(w, "An Unknown Error Has Occured, Please Try Again Later", http.StatusInternalServerError)
+		return
+	}
+	admins := make(map[string]string, len(emails))
+	for id, email := range emails {
+		admins[id.Hex()] = email
+	}
+	excluded := 0
+	for _, p := range participants {
+		if p.Excluded {
+			excluded++
+		}
+	}
+	canEdit := user.Role.Can(models.PermManageStudy)
+	csrfToken := ""
+	if canEdit {
+		csrfToken, err = utils.CSRFToken(r, w, a.sess)
+		if err != nil {
+			a.l.Error("Unable to issue CSRF token", zap.Error(err))
+			http.Error(w, "An Unknown Error Has Occured, Please Try Again Later", http.StatusInternalServerError)
+			return
+		}
+	}
+	t := template.Must(template.New("exclusions-page").ParseFS(*a.templates, "templates/exclusions.html"))
+	err = t.ExecuteTemplate(w, "exclusions.html", struct {
+		CSRFToken    string
+		Message      string
+		CanEdit      bool
+		Pseudonym    string
+		Reasons      []models.ExclusionReason
+		Participants []models.User
+		Excluded     int
+		Admins       map[string]string
+	}{
+		CSRFToken:    csrfToken,
+		Message:      message,
+		CanEdit:      canEdit,
+		Pseudonym:    r.FormValue("pseudonym"),
+		Reasons:      models.ExclusionReasons,
+		Participants: participants,
+		Excluded:     excluded,
+		Admins:       admins,
+	})
+	if err != nil {
+		a.l.Error("Unable to render exclusions page", zap.Error(err))
+		http.Error(w, "An Unknown Error Has Occured, Please Try Again Later", http.StatusInternalServerError)
+		return
+	}
+}
+
+// ExcludeParticipant excludes the submitted participant with a reason and note, or reinstates them when `action` is
+// `reinstate`. Either way the decision is added to the participant's history and the audit log.
+func (a *Admin) ExcludeParticipant(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(userFromContext{}).(models.User)
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "An Unknown Error Has Occured, Please Try Again Later", http.StatusBadRequest)
+		return
+	}
+	pseudonym := strings.TrimSpace(r.PostForm.Get("pseudonym"))
+	if pseudonym == "" {
+		a.renderExclusionsPage(w, r, "Please enter the participant's pseudonym")
+		return
+	}
+	event := models.ExclusionEvent{
+		Excluded: r.PostForm.Get("action") != "reinstate",
+		Note:     strings.TrimSpace(r.PostForm.Get("note")),
+		By:       user.ID,
+		On:       time.Now(),
+	}
+	action := models.AuditParticipantIncluded
+	if event.Excluded {
+		reason, err := models.ParseExclusionReason(r.PostForm.Get("reason"))
+		if err != nil {
+			a.renderExclusionsPage(w, r, "Please choose why the participant is excluded")
+			return
+		}
+		if reason == models.ExclusionOther && event.Note == "" {
+			a.renderExclusionsPage(w, r, "Please describe the reason in the note")
+			return
+		}
+		event.Reason = reason
+		action = models.AuditParticipantExcluded
+	}
+
+	mongoContext, mongoCancel := context.WithTimeout(r.Context(), time.Second*5)
+	defer mongoCancel()
+	if err := models.RecordExclusion(mongoContext, a.db, pseudonym, event); err == mongo.ErrNoDocuments {
+		a.renderExclusionsPage(w, r, "There is no participant with the pseudonym "+pseudonym)
+		return
+	} else if err != nil {
+		a.l.Error("Unable to record exclusion", zap.Error(err))
+		http.Error(w, "An Unknown Error Has Occured, Please Try Again Later", http.StatusInternalServerError)
+		return
+	}
+	detail := pseudonym
+	if event.Reason != "" {
+		detail += " " + string(event.Reason)
+	}
+	a.audit(r, user, action, detail)
+	a.l.Info("Participant exclusion changed by admin", zap.String("Admin", user.ID.Hex()), zap.String("Participant", pseudonym),
+		zap.Bool("Excluded", event.Excluded))
+	http.Redirect(w, r, "/admin/exclusions", http.StatusFound)
+}
@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	htmltemplate "html/template"
+	"io"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/superc03/carp/export"
+	"github.com/superc03/carp/models"
+	"go.uber.org/zap"
+)
+
+// loadDataset reads the participant filter from the query string and loads the matching dataset, answering the
+// request itself and returning nil when that fails
+func (o *Other) loadDataset(w http.ResponseWriter, r *http.Request) *models.Dataset {
+	filter, err := models.ParseParticipantFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil
+	}
+	mongoContext, mongoCancel := context.WithTimeout(r.Context(), time.Second*30)
+	defer mongoCancel()
+	dataset, err := models.LoadDataset(mongoContext, o.db, filter)
+	if err != nil {
+		o.l.Error("Unable to load dataset for export", zap.Error(err))
+		http.Error(w, "An Unknown Error Has Occured, Please Try Again Later", http.StatusInternalServerError)
+		return nil
+	}
+	return dataset
+}
+
+func attachment(w http.ResponseWriter, contentType string, filename string) {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+}
+
+// LongExport writes one row per participant and rated article, as CSV or, with `format=jsonl`, JSON Lines
+func (o *Other) LongExport(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "csv" && format != "jsonl" {
+		http.Error(w, "Unknown export format, use csv or jsonl", http.StatusBadRequest)
+		return
+	}
+	dataset := o.loadDataset(w, r)
+	if dataset == nil {
+		return
+	}
+	rows := dataset.LongRows()
+
+	if format == "jsonl" {
+		attachment(w, "application/x-ndjson", "responses_long.jsonl")
+		enc := json.NewEncoder(w)
+		for _, row := range rows {
+			if err := enc.Encode(row); err != nil {
+				o.l.Error("Unable to write long export", zap.Error(err))
+				return
+			}
+		}
+		return
+	}
+
+	attachment(w, "text/csv", "responses_long.csv")
+	csvWriter := csv.NewWriter(w)
+	columns := models.LongColumns
+	if dataset.Filter.IncludeExcluded {
+		columns = append(columns[:len(columns):len(columns)], "excluded")
+	}
+	if err := csvWriter.Write(columns); err != nil {
+		o.l.Error("Unable to write long export", zap.Error(err))
+		return
+	}
+	for _, row := range rows {
+		if err := csvWriter.Write(export.LongRecord(row)); err != nil {
+			o.l.Error("Unable to write long export", zap.Error(err))
+			return
+		}
+	}
+	csvWriter.Flush()
+}
+
+// LabelledExport writes the wide layout as an SPSS (`format=sav`) or Stata (`format=dta`) file, carrying article
+// titles as variable labels and the scale anchors as value labels
+func (o *Other) LabelledExport(w http.ResponseWriter, r *http.Request) {
+	dataset := o.loadDataset(w, r)
+	if dataset == nil {
+		return
+	}
+	table := export.WideTable(dataset)
+	var err error
+	if r.URL.Query().Get("format") == "dta" {
+		attachment(w, "application/x-stata-dta", "responses.dta")
+		err = export.WriteDTA(w, table)
+	} else {
+		attachment(w, "application/x-spss-sav", "responses.sav")
+		err = export.WriteSAV(w, table)
+	}
+	if err != nil {
+		o.l.Error("Unable to write labelled export", zap.Error(err))
+	}
+}
+
+// WorkbookExport streams an Excel workbook with responses, articles, participants and codebook sheets
+func (o *Other) WorkbookExport(w http.ResponseWriter, r *http.Request) {
+	dataset := o.loadDataset(w, r)
+	if dataset == nil {
+		return
+	}
+	attachment(w, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", "responses.xlsx")
+	if err := export.WriteWorkbook(w, dataset); err != nil {
+		o.l.Error("Unable to write workbook export", zap.Error(err))
+	}
+}
+
+// CodebookExport describes every export's variables, as Markdown (`format=codebook.md`), HTML (`format=codebook.html`)
+// or JSON (`format=codebook.json`)
+func (o *Other) CodebookExport(w http.ResponseWriter, r *http.Request) {
+	dataset := o.loadDataset(w, r)
+	if dataset == nil {
+		return
+	}
+	codebook := export.NewCodebook(dataset)
+	var err error
+	switch r.URL.Query().Get("format") {
+	case "codebook.json":
+		attachment(w, "application/json", "codebook.json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(codebook)
+	case "codebook.html":
+		t := htmltemplate.Must(htmltemplate.New("codebook-page").ParseFS(*o.templates, "templates/codebook.html"))
+		err = t.ExecuteTemplate(w, "codebook.html", codebook)
+	default:
+		attachment(w, "text/markdown; charset=utf-8", "codebook.md")
+		err = o.writeCodebookMarkdown(w, codebook)
+	}
+	if err != nil {
+		o.l.Error("Unable to write codebook", zap.Error(err))
+	}
+}
+
+// DataPackageExport writes a zipped Frictionless Data Package holding the participants, articles and responses with
+// a Table Schema for each, the codebook and checksums of every file
+func (o *Other) DataPackageExport(w http.ResponseWriter, r *http.Request) {
+	dataset := o.loadDataset(w, r)
+	if dataset == nil {
+		return
+	}
+	codebook := export.NewCodebook(dataset)
+	markdown := &bytes.Buffer{}
+	if err := o.writeCodebookMarkdown(markdown, codebook); err != nil {
+		o.l.Error("Unable to write codebook", zap.Error(err))
+		http.Error(w, "An Unknown Error Has Occured, Please Try Again Later", http.StatusInternalServerError)
+		return
+	}
+	codebookJSON, err := json.MarshalIndent(codebook, "", "  ")
+	if err != nil {
+		o.l.Error("Unable to write codebook", zap.Error(err))
+		http.Error(w, "An Unknown Error Has Occured, Please Try Again Later", http.StatusInternalServerError)
+		return
+	}
+	attachment(w, "application/zip", "carp_datapackage_"+dataset.ExportedOn.UTC().Format("20060102")+".zip")
+	err = export.WriteDataPackage(w, dataset,
+		export.File{Name: "codebook.md", Data: markdown.Bytes()},
+		export.File{Name: "codebook.json", Data: codebookJSON},
+	)
+	if err != nil {
+		o.l.Error("Unable to write data package", zap.Error(err))
+	}
+}
+
+func (o *Other) writeCodebookMarkdown(w io.Writer, codebook *export.Codebook) error {
+	t := template.Must(template.New("codebook-markdown").Funcs(template.FuncMap{
+		// cell keeps text inside a single Markdown table cell
+		"cell": func(s string) string {
+			return strings.NewReplacer("|", `\|`, "\n", " ", "\r", "").Replace(s)
+		},
+	}).ParseFS(*o.templates, "templates/codebook.md"))
+	return t.ExecuteTemplate(w, "codebook.md", codebook)
+}
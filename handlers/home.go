@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"context"
+	crand "crypto/rand"
 	"embed"
 	"encoding/base64"
 	"encoding/json"
@@ -13,8 +14,8 @@ import (
 	"net/http"
 	"time"
 
-	"github.com/gorilla/sessions"
 	"github.com/superc03/carp/models"
+	"github.com/superc03/carp/utils"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -26,15 +27,17 @@ import (
 type Home struct {
 	l         *zap.Logger
 	db        *mongo.Database
+	vault     *models.IdentityVault
 	conf      *oauth2.Config
-	sess      *sessions.CookieStore
+	sess      *utils.SessionStore
 	templates *embed.FS
 }
 
 func NewHome(
 	l *zap.Logger,
 	db *mongo.Database,
-	sess *sessions.CookieStore,
+	vault *models.IdentityVault,
+	sess *utils.SessionStore,
 	templates *embed.FS,
 	googleKey string,
 	googleSecret string,
@@ -51,10 +54,25 @@ func NewHome(
 		},
 		Endpoint: google.Endpoint,
 	}
-	return &Home{l, db, conf, sess, templates}
+	return &Home{l, db, vault, conf, sess, templates}
 }
 
+// LandingPage introduces the study and links to Login. It leaves the session store alone, so visitors who never
+// sign in do not leave a session record behind.
 func (h *Home) LandingPage(w http.ResponseWriter, r *http.Request) {
+	// TODO Conditional Render 'Login with Google' or 'Continue Survey' depending on logged in status
+	t := template.Must(template.New("landing-page").ParseFS(*h.templates, "templates/home.html"))
+	err := t.ExecuteTemplate(w, "home.html", struct {
+		GoogleLoginURL string
+	}{GoogleLoginURL: "/login"})
+	if err != nil {
+		http.Error(w, "An Unknown Error Has Occured, Please Try Again Later", http.StatusInternalServerError)
+		return
+	}
+}
+
+// Login starts signing in with Google
+func (h *Home) Login(w http.ResponseWriter, r *http.Request) {
 	// Create token to protect against CSRF attacks mid-signin
 	randToken := randStateToken()
 	// Assign the "mysterious" user a session
@@ -63,18 +81,13 @@ func (h *Home) LandingPage(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "An Unknown Error Has Occured, Please Try Again Later", http.StatusInternalServerError)
 		return
 	}
-	// TODO Conditional Render 'Login with Google' or 'Continue Survey' depending on logged in status
 	newSession.Values["state"] = randToken
-	newSession.Save(r, w)
-	loginURL := h.conf.AuthCodeURL(randToken)
-	t := template.Must(template.New("landing-page").ParseFS(*h.templates, "templates/home.html"))
-	err = t.ExecuteTemplate(w, "home.html", struct {
-		GoogleLoginURL string
-	}{GoogleLoginURL: loginURL})
-	if err != nil {
+	if err = newSession.Save(r, w); err != nil {
+		h.l.Error("Unable to save sign in state", zap.Error(err))
 		http.Error(w, "An Unknown Error Has Occured, Please Try Again Later", http.StatusInternalServerError)
 		return
 	}
+	http.Redirect(w, r, h.conf.AuthCodeURL(randToken), http.StatusFound)
 }
 
 func (h *Home) GoogleAuth(w http.ResponseWriter, r *http.Request) {
@@ -112,13 +125,13 @@ func (h *Home) GoogleAuth(w http.ResponseWriter, r *http.Request) {
 	// Check if User Already Exists
 	mongoContext, mongoCancel := context.WithTimeout(r.Context(), time.Second*5)
 	defer mongoCancel()
-	var userId primitive.ObjectID
+	googleEmail, _ := googleData["email"].(string)
 	user := models.User{}
-	res := h.db.Collection("users").FindOne(mongoContext, bson.M{"email": googleData["email"]})
-	if res.Err() == mongo.ErrNoDocuments {
+	userId, err := h.vault.Lookup(mongoContext, googleEmail)
+	if err == mongo.ErrNoDocuments {
 		newUser := models.User{
-			Email:      googleData["email"].(string),
-			IsAdmin:    false,
+			Pseudonym:  models.NewPseudonym(),
+			Role:       models.RoleParticipant,
 			SurveyType: imageGroup(),
 			Data:       primitive.M{},
 			CreatedOn:  time.Now(),
@@ -131,37 +144,59 @@ func (h *Home) GoogleAuth(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		userId = res.InsertedID.(primitive.ObjectID)
-	} else if res.Err() != nil {
-		if err != nil {
-			h.l.Error("Could not search for user in database", zap.Error(err))
+		if err = h.vault.Link(mongoContext, googleEmail, userId, false); err != nil {
+			h.l.Error("Could not link new user to their identity", zap.Error(err))
 			http.Error(w, "An Unknown Error Has Occured, Please Try Again Later", http.StatusInternalServerError)
 			return
 		}
+	} else if err != nil {
+		h.l.Error("Could not search for user in identity vault", zap.Error(err))
+		http.Error(w, "An Unknown Error Has Occured, Please Try Again Later", http.StatusInternalServerError)
+		return
 	} else {
-		err = res.Decode(&user)
+		err = h.db.Collection("users").FindOne(mongoContext, bson.M{"_id": userId}).Decode(&user)
 		if err != nil {
 			h.l.Error("Unable to convert user from database record to object", zap.Error(err))
 			http.Error(w, "An Unknown Error Has Occured, Please Try Again Later", http.StatusInternalServerError)
 			return
 		}
-		userId = user.ID
 	}
-	// Assign a session token
+	// Assign a new session token, the one used before signing in is revoked
+	if err = h.sess.Regenerate(r, session); err != nil {
+		h.l.Error("Unable to revoke pre-authentication session", zap.Error(err))
+		http.Error(w, "An Unknown Error Has Occured, Please Try Again Later", http.StatusInternalServerError)
+		return
+	}
 	session.Values["_id"] = userId.Hex()
-	session.Values["state"] = ""
 	err = session.Save(r, w)
 	if err != nil {
 		h.l.Error("Unable to assign session token to user", zap.Error(err))
 		http.Error(w, "An Unknown Error Has Occured, Please Try Again Later", http.StatusInternalServerError)
 		return
 	}
-	if user.IsAdmin {
-		http.Redirect(w, r, "/statistics.csv", http.StatusFound)
+	if user.Role.IsStaff() {
+		http.Redirect(w, r, "/admin", http.StatusFound)
 	} else {
 		http.Redirect(w, r, "/survey/start", http.StatusFound)
 	}
 }
 
+// Logout revokes the current session server-side and clears the cookie
+func (h *Home) Logout(w http.ResponseWriter, r *http.Request) {
+	session, err := h.sess.Get(r, "carp")
+	if err != nil {
+		http.Error(w, "An Unknown Error Has Occured, Please Try Again Later", http.StatusInternalServerError)
+		return
+	}
+	session.Options.MaxAge = -1
+	if err = session.Save(r, w); err != nil {
+		h.l.Error("Unable to revoke user session", zap.Error(err))
+		http.Error(w, "An Unknown Error Has Occured, Please Try Again Later", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
 func imageGroup() int {
 	return rand.Intn(2)
 }
@@ -181,6 +216,6 @@ func parseGoogleData(res io.ReadCloser) (map[string]interface{}, error) {
 
 func randStateToken() string {
 	b := make([]byte, 32)
-	rand.Read(b)
+	crand.Read(b)
 	return base64.StdEncoding.EncodeToString(b)
 }
@@ -0,0 +1,289 @@
+package handlers
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/superc03/carp/models"
+)
+
+// apiOperation documents and routes a single API endpoint. The OpenAPI document is generated from this table and
+// the response types, so it cannot drift from what the handlers actually serve.
+type apiOperation struct {
+	Method  string
+	Path    string
+	Summary string
+	Scope   models.Scope
+	Params  []apiParam
+	Body    interface{}
+	Item    interface{}
+	Handler func(*API, http.ResponseWriter, *http.Request)
+}
+
+type apiParam struct {
+	Name        string
+	Description string
+	Enum        []string
+	Format      string
+}
+
+var (
+	paginationParams = []apiParam{
+		{Name: "page", Description: "Page number, starting at 1", Format: "integer"},
+		{Name: "per_page", Description: "Items per page, at most 1000", Format: "integer"},
+	}
+	participantParams = []apiParam{
+		{Name: "condition", Description: "Only participants in this condition", Enum: []string{"no_image", "with_image"}},
+		{Name: "status", Description: "Only participants with this completion status", Enum: []string{models.StatusNotStarted, models.StatusStarted, models.StatusCompleted}},
+		{Name: "from", Description: "Only participants who first signed in on or after this date", Format: "date"},
+		{Name: "to", Description: "Only participants who first signed in on or before this date", Format: "date"},
+		{Name: "excluded", Description: "Include participants an admin excluded, who are left out by default", Enum: []string{"include"}},
+	}
+)
+
+var apiOperations = []apiOperation{
+	{
+		Method:  http.MethodGet,
+		Path:    "/studies",
+		Summary: "Describe the study, its rating scale and conditions",
+		Scope:   models.ScopeReadResponses,
+		Params:  paginationParams,
+		Item:    models.Study{},
+		Handler: (*API).Studies,
+	},
+	{
+		Method:  http.MethodGet,
+		Path:    "/articles",
+		Summary: "List the articles participants rate",
+		Scope:   models.ScopeReadResponses,
+		Params:  paginationParams,
+		Item:    apiArticle{},
+		Handler: (*API).Articles,
+	},
+	{
+		Method:  http.MethodPost,
+		Path:    "/articles",
+		Summary: "Add an article to the survey",
+		Scope:   models.ScopeManageArticles,
+		Body:    apiArticleInput{},
+		Item:    apiArticle{},
+		Handler: (*API).CreateArticle,
+	},
+	{
+		Method:  http.MethodPut,
+		Path:    "/articles/{id}",
+		Summary: "Change an article's title, picture and metadata",
+		Scope:   models.ScopeManageArticles,
+		Body:    apiArticleInput{},
+		Item:    apiArticle{},
+		Handler: (*API).UpdateArticle,
+	},
+	{
+		Method:  http.MethodDelete,
+		Path:    "/articles/{id}",
+		Summary: "Remove an article nobody has rated yet",
+		Scope:   models.ScopeManageArticles,
+		Handler: (*API).DeleteArticle,
+	},
+	{
+		Method:  http.MethodGet,
+		Path:    "/participants",
+		Summary: "List pseudonymized participants",
+		Scope:   models.ScopeReadResponses,
+		Params:  append(append([]apiParam{}, participantParams...), paginationParams...),
+		Item:    apiParticipant{},
+		Handler: (*API).Participants,
+	},
+	{
+		Method:  http.MethodPatch,
+		Path:    "/participants/{pseudonym}",
+		Summary: "Move a participant who has not rated anything yet into another condition",
+		Scope:   models.ScopeManageParticipants,
+		Body:    apiParticipantInput{},
+		Item:    apiParticipant{},
+		Handler: (*API).UpdateParticipant,
+	},
+	{
+		Method:  http.MethodGet,
+		Path:    "/responses",
+		Summary: "List ratings, one per participant and article",
+		Scope:   models.ScopeReadResponses,
+		Params: append(append([]apiParam{
+			{Name: "article", Description: "Only ratings of the article with this ID"},
+		}, participantParams...), paginationParams...),
+		Item:    apiResponse{},
+		Handler: (*API).Responses,
+	},
+}
+
+// OpenAPI serves the OpenAPI 3 description of the API
+func (a *API) OpenAPI(w http.ResponseWriter, r *http.Request) {
+	a.writeJSON(w, http.StatusOK, openAPIDocument())
+}
+
+func openAPIDocument() map[string]interface{} {
+	errorSchema := schemaFor(reflect.TypeOf(apiError{}))
+	paths := map[string]interface{}{}
+	for _, op := range apiOperations {
+		params := make([]interface{}, 0, len(op.Params))
+		for _, segment := range strings.Split(op.Path, "/") {
+			if strings.HasPrefix(segment, "{") {
+				params = append(params, map[string]interface{}{
+					"name":     strings.Trim(segment, "{}"),
+					"in":       "path",
+					"required": true,
+					"schema":   map[string]interface{}{"type": "string"},
+				})
+			}
+		}
+		for _, p := range op.Params {
+			schema := map[string]interface{}{"type": "string"}
+			switch {
+			case p.Format == "integer":
+				schema = map[string]interface{}{"type": "integer", "minimum": 1}
+			case p.Format != "":
+				schema["format"] = p.Format
+			}
+			if p.Enum != nil {
+				schema["enum"] = p.Enum
+			}
+			params = append(params, map[string]interface{}{
+				"name":        p.Name,
+				"in":          "query",
+				"description": p.Description,
+				"schema":      schema,
+			})
+		}
+
+		responses := map[string]interface{}{
+			"401": jsonContent("Missing or invalid API token", errorSchema),
+			"403": jsonContent("The API token lacks the required scope", errorSchema),
+		}
+		switch op.Method {
+		case http.MethodGet:
+			responses["200"] = jsonContent("A page of results", map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"data":     map[string]interface{}{"type": "array", "items": schemaFor(reflect.TypeOf(op.Item))},
+					"page":     map[string]interface{}{"type": "integer"},
+					"per_page": map[string]interface{}{"type": "integer"},
+					"total":    map[string]interface{}{"type": "integer"},
+					"next":     map[string]interface{}{"type": "string", "description": "Path of the next page, absent on the last page"},
+				},
+			})
+			responses["400"] = jsonContent("Invalid query parameters", errorSchema)
+		case http.MethodDelete:
+			responses["204"] = map[string]interface{}{"description": "Deleted"}
+		case http.MethodPost:
+			responses["201"] = jsonContent("Created", schemaFor(reflect.TypeOf(op.Item)))
+		default:
+			responses["200"] = jsonContent("Updated", schemaFor(reflect.TypeOf(op.Item)))
+		}
+		if op.Method != http.MethodGet && op.Method != http.MethodPost {
+			responses["404"] = jsonContent("No such resource", errorSchema)
+		}
+		if op.Method == http.MethodDelete || op.Method == http.MethodPatch {
+			responses["409"] = jsonContent("The resource already has ratings", errorSchema)
+		}
+
+		operation := map[string]interface{}{
+			"summary":     op.Summary,
+			"description": "Requires the `" + string(op.Scope) + "` scope.",
+			"parameters":  params,
+			"responses":   responses,
+		}
+		if op.Body != nil {
+			operation["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{"schema": schemaFor(reflect.TypeOf(op.Body))},
+				},
+			}
+			responses["400"] = jsonContent("Invalid request body", errorSchema)
+		}
+		item, ok := paths[op.Path].(map[string]interface{})
+		if !ok {
+			item = map[string]interface{}{}
+			paths[op.Path] = item
+		}
+		item[strings.ToLower(op.Method)] = operation
+	}
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":       "C.A.R.P. Results API",
+			"version":     "1",
+			"description": "Programmatic access to pseudonymized study data. Authenticate with a scoped API token issued by an admin.",
+		},
+		"servers":  []interface{}{map[string]interface{}{"url": "/api/v1"}},
+		"security": []interface{}{map[string]interface{}{"bearer": []string{}}},
+		"components": map[string]interface{}{
+			"securitySchemes": map[string]interface{}{
+				"bearer": map[string]interface{}{"type": "http", "scheme": "bearer"},
+			},
+		},
+		"paths": paths,
+	}
+}
+
+func jsonContent(description string, schema map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"description": description,
+		"content": map[string]interface{}{
+			"application/json": map[string]interface{}{"schema": schema},
+		},
+	}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schemaFor derives a JSON schema from a Go type, following its `json` struct tags
+func schemaFor(t reflect.Type) map[string]interface{} {
+	nullable := false
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+		nullable = true
+	}
+	var schema map[string]interface{}
+	switch {
+	case t == timeType:
+		schema = map[string]interface{}{"type": "string", "format": "date-time"}
+	case t.Kind() == reflect.Struct:
+		properties := map[string]interface{}{}
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name := strings.Split(f.Tag.Get("json"), ",")[0]
+			if name == "-" || f.PkgPath != "" {
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+			property := schemaFor(f.Type)
+			// Allowed values are listed in an `enum` tag, separated by commas
+			if enum := f.Tag.Get("enum"); enum != "" {
+				property["enum"] = strings.Split(enum, ",")
+			}
+			properties[name] = property
+		}
+		schema = map[string]interface{}{"type": "object", "properties": properties}
+	case t.Kind() == reflect.Slice || t.Kind() == reflect.Array:
+		schema = map[string]interface{}{"type": "array", "items": schemaFor(t.Elem())}
+	case t.Kind() == reflect.String:
+		schema = map[string]interface{}{"type": "string"}
+	case t.Kind() == reflect.Bool:
+		schema = map[string]interface{}{"type": "boolean"}
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64:
+		schema = map[string]interface{}{"type": "integer"}
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		schema = map[string]interface{}{"type": "number"}
+	default:
+		schema = map[string]interface{}{}
+	}
+	if nullable {
+		schema["nullable"] = true
+	}
+	return schema
+}
@@ -1,16 +1,12 @@
 package handlers
 
 import (
-	"context"
 	"embed"
 	"encoding/csv"
-	"fmt"
 	"html/template"
 	"net/http"
-	"time"
 
-	"github.com/superc03/carp/models"
-	"go.mongodb.org/mongo-driver/bson"
+	"github.com/superc03/carp/export"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.uber.org/zap"
 )
@@ -31,77 +27,45 @@ func NewOther(
 	}
 }
 
+// StatisticsPage exports responses, one wide row per participant with a column per article. `layout=long` switches
+// to one row per participant and article instead, `format=sav` and `format=dta` to labelled SPSS and Stata files
+// and `format=xlsx` to an Excel workbook. `format=codebook.md`, `.html` and `.json` describe the variables of each,
+// and `format=datapackage` bundles everything into a Frictionless Data Package archive. Every layout takes the
+// participant filters and leaves out excluded participants unless `excluded=include`, which adds an `excluded` column.
+// The wide layout ends with participants' discernment once articles are labelled true and false, followed by their
+// quality indicators and flags.
 func (o *Other) StatisticsPage(w http.ResponseWriter, r *http.Request) {
-	mongoContext, mongoCancel := context.WithTimeout(r.Context(), time.Second*15)
-	defer mongoCancel()
-	// Only Admin Access Allowed
-	user := r.Context().Value(userFromContext{}).(models.User)
-	if user.IsAdmin == false {
-		http.Redirect(w, r, "/", http.StatusUnauthorized)
+	if r.URL.Query().Get("layout") == "long" {
+		o.LongExport(w, r)
 		return
 	}
-
-	csvWriter := csv.NewWriter(w)
-	// Accumulate all Article Codes
-	cursor, err := o.db.Collection("articles").Find(mongoContext, bson.D{})
-	if err != nil {
-		o.l.Error("Unable to Accumulate all Article Codes", zap.Error(err))
-		http.Error(w, "An Unknown Error Has Occured, Please Try Again Later", http.StatusInternalServerError)
+	switch r.URL.Query().Get("format") {
+	case "sav", "dta":
+		o.LabelledExport(w, r)
+		return
+	case "xlsx":
+		o.WorkbookExport(w, r)
+		return
+	case "codebook.md", "codebook.html", "codebook.json":
+		o.CodebookExport(w, r)
+		return
+	case "datapackage":
+		o.DataPackageExport(w, r)
 		return
 	}
-	articleIDs := make([]string, 0, 10)
-	for cursor.Next(mongoContext) {
-		var article models.Article
-		if err = cursor.Decode(&article); err != nil {
-			o.l.Error("Unable to Accumulate all Article Codes", zap.Error(err))
-			http.Error(w, "An Unknown Error Has Occured, Please Try Again Later", http.StatusInternalServerError)
-			return
-		}
-		articleIDs = append(articleIDs, article.ID.Hex())
-	}
-	err = csvWriter.Write(append([]string{"imagePresent"}, articleIDs...))
-	if err != nil {
-		o.l.Error("Unable to Accumulate all Article Codes", zap.Error(err))
-		http.Error(w, "An Unknown Error Has Occured, Please Try Again Later", http.StatusInternalServerError)
+	dataset := o.loadDataset(w, r)
+	if dataset == nil {
 		return
 	}
-	// Anomynously Accumulate all Article Scores
-	cursor, err = o.db.Collection("users").Find(mongoContext, bson.M{"is_admin": bson.M{"$eq": false}})
-	if err != nil {
-		o.l.Error("Unable to Accumulate all Users", zap.Error(err))
-		http.Error(w, "An Unknown Error Has Occured, Please Try Again Later", http.StatusInternalServerError)
+	header, records := export.WideCSV(dataset)
+	csvWriter := csv.NewWriter(w)
+	if err := csvWriter.Write(header); err != nil {
+		o.l.Error("Unable to write statistics export", zap.Error(err))
 		return
 	}
-	for cursor.Next(mongoContext) {
-		var user models.User
-		data := make([]string, 0, 11)
-		if err = cursor.Decode(&user); err != nil {
-			o.l.Error("Unable to Accumulate all Users", zap.Error(err))
-			http.Error(w, "An Unknown Error Has Occured, Please Try Again Later", http.StatusInternalServerError)
-			return
-		}
-		if user.SurveyType == models.SurveyWithImage {
-			data = append(data, "true")
-		} else {
-			data = append(data, "false")
-		}
-		for _, v := range articleIDs {
-			score := user.Data[v]
-			if score == nil {
-				data = append(data, "")
-			} else {
-				data = append(data, fmt.Sprintf("%d", user.Data[v]))
-			}
-		}
-		err := csvWriter.Write(data)
-		if err != nil {
-			o.l.Error("Unable to Accumulate all Users", zap.Error(err))
-			http.Error(w, "An Unknown Error Has Occured, Please Try Again Later", http.StatusInternalServerError)
-			return
-		}
+	if err := csvWriter.WriteAll(records); err != nil {
+		o.l.Error("Unable to write statistics export", zap.Error(err))
 	}
-
-	csvWriter.Flush()
 }
 
 func (o *Other) WrongAccountPage(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/superc03/carp/analysis"
+	"github.com/superc03/carp/models"
+	"github.com/superc03/carp/report"
+	"go.uber.org/zap"
+)
+
+// StudyReport downloads a printable PDF report of the study for a research panel. It takes the export filters along
+// with `correction` and `seed` like the analysis page. Excluded participants are always loaded so the report can
+// count them, but the statistics and charts leave them out.
+func (a *Admin) StudyReport(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	correction, err := analysis.ParseCorrection(q.Get("correction"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	seed := time.Now().UnixNano() % 1000000000
+	if v := q.Get("seed"); v != "" {
+		if seed, err = strconv.ParseInt(v, 10, 64); err != nil {
+			http.Error(w, "seed must be a whole number", http.StatusBadRequest)
+			return
+		}
+	}
+	q.Set("excluded", "include")
+	dataset := a.loadDataset(w, r, q)
+	if dataset == nil {
+		return
+	}
+	dataset.ExportedOn = dataset.ExportedOn.In(a.loc)
+	mongoContext, mongoCancel := context.WithTimeout(r.Context(), time.Second*15)
+	defer mongoCancel()
+	progress, err := models.LoadProgress(mongoContext, a.db, a.loc)
+	if err != nil {
+		a.l.Error("Unable to load study progress", zap.Error(err))
+		http.Error(w, "An Unknown Error Has Occured, Please Try Again Later", http.StatusInternalServerError)
+		return
+	}
+
+	// The report is laid out in memory first, so a failure still answers with an error instead of half a file
+	var document bytes.Buffer
+	err = report.Write(&document, dataset, correction, seed, progress.Enrollment)
+	if err == analysis.ErrTooFewConditions {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	} else if err != nil {
+		a.l.Error("Unable to write study report", zap.Error(err))
+		http.Error(w, "An Unknown Error Has Occured, Please Try Again Later", http.StatusInternalServerError)
+		return
+	}
+	attachment(w, "application/pdf", "study_report.pdf")
+	if _, err = document.WriteTo(w); err != nil {
+		a.l.Error("Unable to send study report", zap.Error(err))
+	}
+}
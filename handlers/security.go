@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"embed"
+	"html/template"
+	"net/http"
+
+	"github.com/superc03/carp/utils"
+	"go.uber.org/zap"
+)
+
+type Security struct {
+	l         *zap.Logger
+	sess      *utils.SessionStore
+	templates *embed.FS
+}
+
+func NewSecurity(
+	l *zap.Logger,
+	sess *utils.SessionStore,
+	templates *embed.FS,
+) *Security {
+	return &Security{
+		l, sess, templates,
+	}
+}
+
+// CSRFMiddleware rejects state-changing requests which do not carry their session's CSRF token
+func (s *Security) CSRFMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !utils.ValidCSRFToken(r, s.sess) {
+			s.l.Warn("Rejected request with missing or invalid CSRF token", zap.String("Path", r.URL.Path))
+			s.CSRFErrorPage(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Security) CSRFErrorPage(w http.ResponseWriter, r *http.Request) {
+	t := template.Must(template.New("csrf-error-page").ParseFS(*s.templates, "templates/csrf_error.html"))
+	w.WriteHeader(http.StatusForbidden)
+	err := t.ExecuteTemplate(w, "csrf_error.html", nil)
+	if err != nil {
+		http.Error(w, "An Unknown Error Has Occured, Please Try Again Later", http.StatusInternalServerError)
+		return
+	}
+}
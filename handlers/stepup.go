@@ -0,0 +1,277 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/superc03/carp/models"
+	"github.com/superc03/carp/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+)
+
+const (
+	stepUpSessionKey     = "stepup_at"
+	pendingMFASessionKey = "mfa_pending"
+	recoveryCodeCount    = 10
+	// A user who fails the step-up this many times within the window is locked out until the failures age out of it
+	stepUpMaxFailures = 5
+	stepUpFailWindow  = 15 * time.Minute
+)
+
+// RequireStepUp sends staff users through a second-factor check unless they passed one within the step-up TTL.
+// It must run after UserMiddleware.
+func (a *Admin) RequireStepUp(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := r.Context().Value(userFromContext{}).(models.User)
+		if user.MFA == nil {
+			http.Redirect(w, r, "/admin/mfa?next="+url.QueryEscape(r.URL.RequestURI()), http.StatusFound)
+			return
+		}
+		session, err := a.sess.Get(r, "carp")
+		if err != nil {
+			http.Error(w, "An Unknown Error Has Occured, Please Try Again Later", http.StatusInternalServerError)
+			return
+		}
+		if at, ok := session.Values[stepUpSessionKey].(int64); ok && time.Since(time.Unix(at, 0)) < a.stepUpTTL {
+			next.ServeHTTP(w, r)
+			return
+		}
+		http.Redirect(w, r, "/admin/stepup?next="+url.QueryEscape(r.URL.RequestURI()), http.StatusFound)
+	})
+}
+
+// MFAPage starts authenticator enrollment by showing a new secret, or confirms an existing enrollment
+func (a *Admin) MFAPage(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(userFromContext{}).(models.User)
+	session, err := a.sess.Get(r, "carp")
+	if err != nil {
+		http.Error(w, "An Unknown Error Has Occured, Please Try Again Later", http.StatusInternalServerError)
+		return
+	}
+	secret := ""
+	if user.MFA == nil {
+		secret, err = utils.GenerateTOTPSecret()
+		if err != nil {
+			a.l.Error("Unable to generate TOTP secret", zap.Error(err))
+			http.Error(w, "An Unknown Error Has Occured, Please Try Again Later", http.StatusInternalServerError)
+			return
+		}
+		session.Values[pendingMFASessionKey] = secret
+		if err = session.Save(r, w); err != nil {
+			a.l.Error("Unable to save pending TOTP secret", zap.Error(err))
+			http.Error(w, "An Unknown Error Has Occured, Please Try Again Later", http.StatusInternalServerError)
+			return
+		}
+	}
+	a.renderMFAPage(w, r, user, secret, "", nil)
+}
+
+// EnrollMFA confirms the pending secret with a code from the authenticator app and issues recovery codes
+func (a *Admin) EnrollMFA(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(userFromContext{}).(models.User)
+	mongoContext, mongoCancel := context.WithTimeout(r.Context(), time.Second*5)
+	defer mongoCancel()
+	session, err := a.sess.Get(r, "carp")
+	if err != nil {
+		http.Error(w, "An Unknown Error Has Occured, Please Try Again Later", http.StatusInternalServerError)
+		return
+	}
+	secret, ok := session.Values[pendingMFASessionKey].(string)
+	if !ok || secret == "" || user.MFA != nil {
+		http.Redirect(w, r, "/admin/mfa", http.StatusFound)
+		return
+	}
+	step, ok := utils.ValidateTOTP(secret, r.FormValue("code"), time.Now())
+	if !ok {
+		a.renderMFAPage(w, r, user, secret, "That code did not match, please try again", nil)
+		return
+	}
+	codes, hashes, err := utils.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		a.l.Error("Unable to generate recovery codes", zap.Error(err))
+		http.Error(w, "An Unknown Error Has Occured, Please Try Again Later", http.StatusInternalServerError)
+		return
+	}
+	mfa := models.MFA{Secret: secret, RecoveryCodes: hashes, LastStep: step, EnrolledOn: time.Now()}
+	_, err = a.db.Collection("users").UpdateByID(mongoContext, user.ID, bson.M{"$set": bson.M{"mfa": mfa}})
+	if err != nil {
+		a.l.Error("Unable to save MFA enrollment", zap.Error(err))
+		http.Error(w, "An Unknown Error Has Occured, Please Try Again Later", http.StatusInternalServerError)
+		return
+	}
+	a.audit(r, user, models.AuditMFAEnrolled, "")
+	delete(session.Values, pendingMFASessionKey)
+	session.Values[stepUpSessionKey] = time.Now().Unix()
+	if err = session.Save(r, w); err != nil {
+		a.l.Error("Unable to save step-up to session", zap.Error(err))
+		http.Error(w, "An Unknown Error Has Occured, Please Try Again Later", http.StatusInternalServerError)
+		return
+	}
+	user.MFA = &mfa
+	a.renderMFAPage(w, r, user, "", "", codes)
+}
+
+func (a *Admin) renderMFAPage(w http.ResponseWriter, r *http.Request, user models.User, secret string, message string, recoveryCodes []string) {
+	csrfToken, err := utils.CSRFToken(r, w, a.sess)
+	if err != nil {
+		a.l.Error("Unable to issue CSRF token", zap.Error(err))
+		http.Error(w, "An Unknown Error Has Occured, Please Try Again Later", http.StatusInternalServerError)
+		return
+	}
+	uri := ""
+	if secret != "" {
+		mongoContext, mongoCancel := context.WithTimeout(r.Context(), time.Second*5)
+		defer mongoCancel()
+		emails, err := a.vault.Emails(mongoContext, []primitive.ObjectID{user.ID})
+		if err != nil {
+			a.l.Error("Unable to look up staff email", zap.Error(err))
+			http.Error(w, "An Unknown Error Has Occured, Please Try Again Later", http.StatusInternalServerError)
+			return
+		}
+		account, ok := emails[user.ID]
+		if !ok {
+			account = user.Pseudonym
+		}
+		uri = utils.TOTPProvisioningURI("C.A.R.P.", account, secret)
+	}
+	t := template.Must(template.New("mfa-page").ParseFS(*a.templates, "templates/mfa.html"))
+	err = t.ExecuteTemplate(w, "mfa.html", struct {
+		CSRFToken       string
+		Enrolled        bool
+		Secret          string
+		ProvisioningURI string
+		Message         string
+		RecoveryCodes   []string
+		Next            string
+	}{
+		CSRFToken:       csrfToken,
+		Enrolled:        user.MFA != nil,
+		Secret:          secret,
+		ProvisioningURI: uri,
+		Message:         message,
+		RecoveryCodes:   recoveryCodes,
+		Next:            safeNextPath(r.FormValue("next")),
+	})
+	if err != nil {
+		http.Error(w, "An Unknown Error Has Occured, Please Try Again Later", http.StatusInternalServerError)
+		return
+	}
+}
+
+// StepUpPage asks for a code from the authenticator app or a recovery code
+func (a *Admin) StepUpPage(w http.ResponseWriter, r *http.Request) {
+	a.renderStepUpPage(w, r, "")
+}
+
+// StepUp verifies the submitted second factor and marks the session as recently stepped up. Failures are audited and
+// after stepUpMaxFailures of them within stepUpFailWindow no code is checked until older failures age out, so the
+// six digit codes cannot be guessed.
+func (a *Admin) StepUp(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(userFromContext{}).(models.User)
+	mongoContext, mongoCancel := context.WithTimeout(r.Context(), time.Second*5)
+	defer mongoCancel()
+	if user.MFA == nil {
+		http.Redirect(w, r, "/admin/mfa", http.StatusFound)
+		return
+	}
+	failures, err := models.CountAudit(mongoContext, a.db, user.ID, models.AuditStepUpFailed, time.Now().Add(-stepUpFailWindow))
+	if err != nil {
+		a.l.Error("Unable to count failed step-up attempts", zap.Error(err))
+		http.Error(w, "An Unknown Error Has Occured, Please Try Again Later", http.StatusInternalServerError)
+		return
+	}
+	if failures >= stepUpMaxFailures {
+		a.audit(r, user, models.AuditStepUpLocked, "")
+		a.l.Warn("Step-up attempt while locked out", zap.String("Admin", user.ID.Hex()))
+		a.renderStepUpPage(w, r, fmt.Sprintf("Too many incorrect codes, please wait %d minutes and try again", int(stepUpFailWindow.Minutes())))
+		return
+	}
+	code := strings.TrimSpace(r.FormValue("code"))
+	action := models.AuditStepUp
+	if step, ok := utils.ValidateTOTP(user.MFA.Secret, code, time.Now()); ok {
+		// Each code may only be used once, so a shoulder-surfed code cannot be replayed
+		res, err := a.db.Collection("users").UpdateOne(mongoContext,
+			bson.M{"_id": user.ID, "mfa.last_step": bson.M{"$lt": step}},
+			bson.M{"$set": bson.M{"mfa.last_step": step}})
+		if err != nil {
+			a.l.Error("Unable to record used TOTP step", zap.Error(err))
+			http.Error(w, "An Unknown Error Has Occured, Please Try Again Later", http.StatusInternalServerError)
+			return
+		}
+		if res.ModifiedCount == 0 {
+			a.audit(r, user, models.AuditStepUpFailed, "reused code")
+			a.renderStepUpPage(w, r, "That code has already been used, wait for the next one")
+			return
+		}
+	} else {
+		res, err := a.db.Collection("users").UpdateOne(mongoContext,
+			bson.M{"_id": user.ID, "mfa.recovery_codes": utils.HashRecoveryCode(code)},
+			bson.M{"$pull": bson.M{"mfa.recovery_codes": utils.HashRecoveryCode(code)}})
+		if err != nil {
+			a.l.Error("Unable to redeem recovery code", zap.Error(err))
+			http.Error(w, "An Unknown Error Has Occured, Please Try Again Later", http.StatusInternalServerError)
+			return
+		}
+		if res.ModifiedCount == 0 {
+			a.audit(r, user, models.AuditStepUpFailed, "")
+			a.renderStepUpPage(w, r, "That code did not match, please try again")
+			return
+		}
+		action = models.AuditStepUpRecovery
+	}
+	session, err := a.sess.Get(r, "carp")
+	if err != nil {
+		http.Error(w, "An Unknown Error Has Occured, Please Try Again Later", http.StatusInternalServerError)
+		return
+	}
+	session.Values[stepUpSessionKey] = time.Now().Unix()
+	if err = session.Save(r, w); err != nil {
+		a.l.Error("Unable to save step-up to session", zap.Error(err))
+		http.Error(w, "An Unknown Error Has Occured, Please Try Again Later", http.StatusInternalServerError)
+		return
+	}
+	a.audit(r, user, action, safeNextPath(r.FormValue("next")))
+	http.Redirect(w, r, safeNextPath(r.FormValue("next")), http.StatusFound)
+}
+
+func (a *Admin) renderStepUpPage(w http.ResponseWriter, r *http.Request, message string) {
+	csrfToken, err := utils.CSRFToken(r, w, a.sess)
+	if err != nil {
+		a.l.Error("Unable to issue CSRF token", zap.Error(err))
+		http.Error(w, "An Unknown Error Has Occured, Please Try Again Later", http.StatusInternalServerError)
+		return
+	}
+	t := template.Must(template.New("stepup-page").ParseFS(*a.templates, "templates/stepup.html"))
+	err = t.ExecuteTemplate(w, "stepup.html", struct {
+		CSRFToken string
+		Message   string
+		Next      string
+	}{CSRFToken: csrfToken, Message: message, Next: safeNextPath(r.FormValue("next"))})
+	if err != nil {
+		http.Error(w, "An Unknown Error Has Occured, Please Try Again Later", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (a *Admin) audit(r *http.Request, user models.User, action string, detail string) {
+	mongoContext, mongoCancel := context.WithTimeout(r.Context(), time.Second*5)
+	defer mongoCancel()
+	if err := models.Audit(mongoContext, a.db, user.ID, action, detail, r.RemoteAddr); err != nil {
+		a.l.Error("Unable to write audit entry", zap.String("Action", action), zap.Error(err))
+	}
+}
+
+// safeNextPath only allows redirects to local paths so `next` cannot be abused as an open redirect
+func safeNextPath(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/admin"
+	}
+	return next
+}
@@ -9,7 +9,6 @@ import (
 	"time"
 
 	"github.com/gorilla/mux"
-	"github.com/gorilla/sessions"
 	"github.com/superc03/carp/models"
 	"github.com/superc03/carp/utils"
 	"go.mongodb.org/mongo-driver/bson"
@@ -21,23 +20,39 @@ import (
 type Survey struct {
 	l         *zap.Logger
 	db        *mongo.Database
-	sess      *sessions.CookieStore
+	sess      *utils.SessionStore
 	templates *embed.FS
+	events    *utils.Broadcaster
+	vault     *models.IdentityVault
 }
 
 func NewSurvey(
 	l *zap.Logger,
 	db *mongo.Database,
-	sess *sessions.CookieStore,
+	sess *utils.SessionStore,
 	templates *embed.FS,
+	events *utils.Broadcaster,
+	vault *models.IdentityVault,
 ) *Survey {
 	return &Survey{
-		l, db, sess, templates,
+		l, db, sess, templates, events, vault,
 	}
 }
 
 type userFromContext struct{}
 
+// recordDevice notes the browser a participant rated from, for the response quality checks. Failing to do so never
+// stops the survey.
+func (s *Survey) recordDevice(ctx context.Context, w http.ResponseWriter, r *http.Request, userID primitive.ObjectID) {
+	token, err := utils.DeviceToken(w, r)
+	if err == nil {
+		err = utils.RecordDevice(ctx, s.db, userID, s.vault.HashDevice(token))
+	}
+	if err != nil {
+		s.l.Error("Unable to record participant's device", zap.Error(err))
+	}
+}
+
 func (s *Survey) UserMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		userId, err := utils.ExtractUserID(r, s.sess)
@@ -45,6 +60,9 @@ func (s *Survey) UserMiddleware(next http.Handler) http.Handler {
 			http.Redirect(w, r, "/", http.StatusFound)
 			return
 		}
+		if err = s.sess.ReissueRotated(r, w, "carp"); err != nil {
+			s.l.Error("Unable to reissue session cookie with current key", zap.Error(err))
+		}
 		mongoContext, mongoCancel := context.WithTimeout(r.Context(), time.Second*5)
 		defer mongoCancel()
 		res := s.db.Collection("users").FindOne(mongoContext, primitive.M{"_id": userId})
@@ -106,12 +124,19 @@ func (s *Survey) QuestionPage(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "An Unknown Error Has Occured, Please Try Again Later", http.StatusBadRequest)
 			return
 		}
-		err = utils.SubmitRating(mongoContext, s.db, user.ID, scoredArticleId, scoredArticleNumericRating)
+		err = utils.SubmitRating(mongoContext, s.db, user.ID, scoredArticleId, scoredArticleNumericRating, len(user.Data)+1)
 		if err != nil {
 			s.l.Error("Unable to submit user rating", zap.Error(err))
 			http.Error(w, "An Unknown Error Has Occured, Please Try Again Later", http.StatusInternalServerError)
 			return
 		}
+		s.recordDevice(mongoContext, w, r, user.ID)
+		s.events.Emit(mongoContext, utils.Event{
+			Type:       utils.EventRating,
+			SurveyType: user.SurveyType,
+			ArticleID:  scoredArticleCode,
+			First:      user.StartedOn == nil && len(user.Data) == 0,
+		})
 	}
 
 	// Find and confirm article's existance
@@ -146,8 +171,19 @@ func (s *Survey) QuestionPage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err = utils.ShowArticle(mongoContext, s.db, user.ID, articleId); err != nil {
+		s.l.Error("Unable to record when article was shown", zap.Error(err))
+	}
+
+	csrfToken, err := utils.CSRFToken(r, w, s.sess)
+	if err != nil {
+		s.l.Error("Unable to issue CSRF token", zap.Error(err))
+		http.Error(w, "An Unknown Error Has Occured, Please Try Again Later", http.StatusInternalServerError)
+		return
+	}
 	t := template.Must(template.New("survey-question-page").ParseFS(*s.templates, "templates/question.html"))
 	err = t.ExecuteTemplate(w, "question.html", struct {
+		CSRFToken          string
 		LikenScaleValues   []int
 		UserImageShown     bool
 		ArticleHeadline    string
@@ -155,6 +191,7 @@ func (s *Survey) QuestionPage(w http.ResponseWriter, r *http.Request) {
 		NextPath           string
 		ArticleID          string
 	}{
+		CSRFToken:          csrfToken,
 		UserImageShown:     user.SurveyType == models.SurveyWithImage,
 		ArticleHeadline:    article.Title,
 		ArticlePictureCode: article.PictureCode,
@@ -187,12 +224,28 @@ func (s *Survey) CompletePage(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "An Unknown Error Has Occured, Please Try Again Later", http.StatusBadRequest)
 			return
 		}
-		err = utils.SubmitRating(mongoContext, s.db, user.ID, scoredArticleId, scoredArticleNumericRating)
+		err = utils.SubmitRating(mongoContext, s.db, user.ID, scoredArticleId, scoredArticleNumericRating, len(user.Data)+1)
 		if err != nil {
 			s.l.Error("Unable to submit user rating", zap.Error(err))
 			http.Error(w, "An Unknown Error Has Occured, Please Try Again Later", http.StatusInternalServerError)
 			return
 		}
+		s.recordDevice(mongoContext, w, r, user.ID)
+		s.events.Emit(mongoContext, utils.Event{
+			Type:       utils.EventRating,
+			SurveyType: user.SurveyType,
+			ArticleID:  scoredArticleCode,
+			First:      user.StartedOn == nil && len(user.Data) == 0,
+		})
+	}
+	completed, err := utils.CompleteSurvey(mongoContext, s.db, user.ID)
+	if err != nil {
+		s.l.Error("Unable to mark survey as completed", zap.Error(err))
+		http.Error(w, "An Unknown Error Has Occured, Please Try Again Later", http.StatusInternalServerError)
+		return
+	}
+	if completed {
+		s.events.Emit(mongoContext, utils.Event{Type: utils.EventCompletion, SurveyType: user.SurveyType})
 	}
 	// Delete the User Cookie upon completion
 	session, err := s.sess.Get(r, "carp")
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"context"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/superc03/carp/models"
+	"github.com/superc03/carp/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/zap"
+)
+
+// TokensPage lists API tokens and lets a study owner issue and revoke them
+func (a *Admin) TokensPage(w http.ResponseWriter, r *http.Request) {
+	a.renderTokensPage(w, r, "", "")
+}
+
+func (a *Admin) renderTokensPage(w http.ResponseWriter, r *http.Request, message string, plain string) {
+	mongoContext, mongoCancel := context.WithTimeout(r.Context(), time.Second*5)
+	defer mongoCancel()
+	tokens, err := models.ListAPITokens(mongoContext, a.db)
+	if err != nil {
+		a.l.Error("Unable to list API tokens", zap.Error(err))
+		http.Error(w, "An Unknown Error Has Occured, Please Try Again Later", http.StatusInternalServerError)
+		return
+	}
+	csrfToken, err := utils.CSRFToken(r, w, a.sess)
+	if err != nil {
+		a.l.Error("Unable to issue CSRF token", zap.Error(err))
+		http.Error(w, "An Unknown Error Has Occured, Please Try Again Later", http.StatusInternalServerError)
+		return
+	}
+	if plain != "" {
+		w.Header().Set("Cache-Control", "no-store")
+	}
+	t := template.Must(template.New("tokens-page").ParseFS(*a.templates, "templates/tokens.html"))
+	err = t.ExecuteTemplate(w, "tokens.html", struct {
+		CSRFToken   string
+		Message     string
+		Plain       string
+		Tokens      []models.APIToken
+		Scopes      []models.Scope
+		DefaultDays int
+		Now         time.Time
+	}{
+		CSRFToken:   csrfToken,
+		Message:     message,
+		Plain:       plain,
+		Tokens:      tokens,
+		Scopes:      models.Scopes,
+		DefaultDays: int(models.DefaultAPITokenTTL / (24 * time.Hour)),
+		Now:         time.Now(),
+	})
+	if err != nil {
+		a.l.Error("Unable to render API tokens page", zap.Error(err))
+		http.Error(w, "An Unknown Error Has Occured, Please Try Again Later", http.StatusInternalServerError)
+		return
+	}
+}
+
+// CreateToken issues a token with the submitted name, scopes and lifetime and shows its plain value once
+func (a *Admin) CreateToken(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(userFromContext{}).(models.User)
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "An Unknown Error Has Occured, Please Try Again Later", http.StatusBadRequest)
+		return
+	}
+	name := strings.TrimSpace(r.FormValue("name"))
+	if name == "" {
+		a.renderTokensPage(w, r, "Please name the token after what will use it", "")
+		return
+	}
+	scopes, err := models.ParseScopes(strings.Join(r.Form["scope"], ","))
+	if err != nil {
+		a.renderTokensPage(w, r, err.Error(), "")
+		return
+	}
+	days, err := strconv.Atoi(r.FormValue("days"))
+	if err != nil || days < 1 || days > 365 {
+		a.renderTokensPage(w, r, "Tokens must expire within 1 to 365 days", "")
+		return
+	}
+
+	mongoContext, mongoCancel := context.WithTimeout(r.Context(), time.Second*5)
+	defer mongoCancel()
+	plain, token, err := models.CreateAPIToken(mongoContext, a.db, name, scopes, time.Duration(days)*24*time.Hour, &user.ID)
+	if err != nil {
+		a.l.Error("Unable to create API token", zap.Error(err))
+		http.Error(w, "An Unknown Error Has Occured, Please Try Again Later", http.StatusInternalServerError)
+		return
+	}
+	a.audit(r, user, models.AuditTokenCreated, token.ID.Hex())
+	a.l.Info("API token created by admin", zap.String("Admin", user.ID.Hex()), zap.String("Token", token.ID.Hex()))
+	a.renderTokensPage(w, r, "", plain)
+}
+
+// RevokeToken stops the submitted token from being accepted
+func (a *Admin) RevokeToken(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(userFromContext{}).(models.User)
+	id, err := primitive.ObjectIDFromHex(r.FormValue("token"))
+	if err != nil {
+		http.Error(w, "An Unknown Error Has Occured, Please Try Again Later", http.StatusBadRequest)
+		return
+	}
+	mongoContext, mongoCancel := context.WithTimeout(r.Context(), time.Second*5)
+	defer mongoCancel()
+	err = models.RevokeAPIToken(mongoContext, a.db, id)
+	if err == mongo.ErrNoDocuments {
+		a.renderTokensPage(w, r, "That token no longer exists", "")
+		return
+	} else if err != nil {
+		a.l.Error("Unable to revoke API token", zap.Error(err))
+		http.Error(w, "An Unknown Error Has Occured, Please Try Again Later", http.StatusInternalServerError)
+		return
+	}
+	a.audit(r, user, models.AuditTokenRevoked, id.Hex())
+	a.l.Info("API token revoked by admin", zap.String("Admin", user.ID.Hex()), zap.String("Token", id.Hex()))
+	http.Redirect(w, r, "/admin/tokens", http.StatusFound)
+}
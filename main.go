@@ -3,15 +3,18 @@ package main
 import (
 	"context"
 	"embed"
+	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
-	"github.com/gorilla/securecookie"
 	"github.com/gorilla/sessions"
 	"github.com/superc03/carp/handlers"
+	"github.com/superc03/carp/models"
+	"github.com/superc03/carp/utils"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.uber.org/zap"
@@ -25,27 +28,79 @@ var templates embed.FS
 var static embed.FS
 
 var (
-	host         string
-	port         string
-	dbUrl        string
-	sessionKey   string
-	googleKey    string
-	googleSecret string
+	host                   string
+	port                   string
+	dbUrl                  string
+	sessionKey             string
+	sessionKeyPairs        [][]byte
+	sessionStore           string
+	sessionIdleTimeout     time.Duration
+	sessionAbsoluteTimeout time.Duration
+	googleKey              string
+	googleSecret           string
+	stepUpTTL              time.Duration
+	bootstrapAdmins        []string
+	identityKey            string
+	identityDatabase       string
+	location               *time.Location
+	eventChangeStreams     bool
 )
 
 func init() {
+	if dbUrl = os.Getenv("MONGODB_URL"); dbUrl == "" {
+		panic("Environmental variable `MONGODB_URL` has not been set.")
+	}
+	if identityKey = os.Getenv("IDENTITY_KEY"); identityKey == "" {
+		panic("Environmental variable `IDENTITY_KEY` has not been set.")
+	}
+	if err := utils.ValidateSecret("IDENTITY_KEY", identityKey); err != nil {
+		panic(err.Error())
+	}
+	// Identities belong in their own database so its access can be granted separately from the research data
+	if identityDatabase = os.Getenv("IDENTITY_DATABASE"); identityDatabase == "" {
+		identityDatabase = "carp_identity"
+	}
+	bootstrapAdmins = strings.FieldsFunc(os.Getenv("BOOTSTRAP_ADMINS"), func(r rune) bool {
+		return r == ',' || r == ' '
+	})
+	// Administrative commands only need the database
+	if len(os.Args) > 1 {
+		return
+	}
 	if port = os.Getenv("PORT"); port == "" {
 		panic("Environmental variable `PORT` has not been set.")
 	}
 	if host = os.Getenv("HOST"); host == "" {
 		host = "localhost"
 	}
-	if dbUrl = os.Getenv("MONGODB_URL"); dbUrl == "" {
-		panic("Environmental variable `MONGODB_URL` has not been set.")
-	}
 	if sessionKey = os.Getenv("SESSION_KEY"); sessionKey == "" {
 		panic("Enviornmental variable `SESSION_KEY` has not been set.")
 	}
+	// Previous keys stay valid for decoding so secrets can be rotated without logging everyone out
+	var err error
+	sessionKeyPairs, err = utils.SessionKeyPairs(
+		sessionKey,
+		os.Getenv("SESSION_ENCRYPTION_KEY"),
+		os.Getenv("SESSION_KEY_PREVIOUS"),
+		os.Getenv("SESSION_ENCRYPTION_KEY_PREVIOUS"),
+	)
+	if err != nil {
+		panic("Session keys are invalid: " + err.Error())
+	}
+	if sessionStore = os.Getenv("SESSION_STORE"); sessionStore == "" {
+		sessionStore = "mongo"
+	} else if sessionStore != "mongo" && sessionStore != "memory" {
+		panic("Environmental variable `SESSION_STORE` must be either `mongo` or `memory`.")
+	}
+	sessionIdleTimeout = durationFromEnv("SESSION_IDLE_TIMEOUT", 2*time.Hour)
+	sessionAbsoluteTimeout = durationFromEnv("SESSION_ABSOLUTE_TIMEOUT", 7*24*time.Hour)
+	stepUpTTL = durationFromEnv("STEP_UP_TTL", 15*time.Minute)
+	// Days on the dashboard are split in the study's local time zone rather than the server's
+	if location, err = time.LoadLocation(os.Getenv("TIMEZONE")); err != nil {
+		panic("Environmental variable `TIMEZONE` must be an IANA time zone such as `Europe/Berlin`.")
+	}
+	// Change streams keep live dashboards in sync across instances but need MongoDB to run as a replica set
+	eventChangeStreams = os.Getenv("EVENT_CHANGE_STREAMS") == "true"
 	if googleKey = os.Getenv("GOOGLE_KEY"); googleKey == "" {
 		panic("Enviornmental variable `GOOGLE_KEY` has not been set.")
 	}
@@ -54,6 +109,19 @@ func init() {
 	}
 }
 
+// durationFromEnv reads a duration such as `30m` from the environment, falling back to def when unset
+func durationFromEnv(name string, def time.Duration) time.Duration {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		panic(fmt.Sprintf("Environmental variable `%s` must be a positive duration such as `30m`.", name))
+	}
+	return d
+}
+
 func main() {
 	// Initialize Logger
 	l, err := zap.NewProduction()
@@ -61,16 +129,9 @@ func main() {
 		panic("Could not initialize logger.")
 	}
 
-	// Initialize Sessions
-	sess := &sessions.CookieStore{
-		Options: &sessions.Options{
-			Path:     "/",
-			HttpOnly: true,
-			Secure:   true,
-			SameSite: http.SameSiteDefaultMode,
-			MaxAge:   86400 * 7,
-		},
-		Codecs: securecookie.CodecsFromPairs([]byte(sessionKey)),
+	// Run an administrative command instead of the server when one is given
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(os.Args[1:]))
 	}
 
 	// Initialize Database
@@ -86,14 +147,77 @@ func main() {
 		l.Fatal("Could not connect to MongoDB", zap.Error(err))
 	}
 
+	vault, err := models.NewIdentityVault(dbContext, db.Database(identityDatabase), []byte(identityKey))
+	if err != nil {
+		l.Fatal("Could not open identity vault", zap.Error(err))
+	}
+
+	// Migrate legacy admin flags and emails, then grant configured bootstrap admins
+	if err = models.MigrateRoles(dbContext, db.Database("carp")); err != nil {
+		l.Fatal("Could not migrate user roles", zap.Error(err))
+	}
+	if err = models.MigrateIdentities(dbContext, db.Database("carp"), vault); err != nil {
+		l.Fatal("Could not move user emails into the identity vault", zap.Error(err))
+	}
+	for _, email := range bootstrapAdmins {
+		if err = models.SetRoleByEmail(dbContext, db.Database("carp"), vault, email, models.RoleSuperadmin); err != nil {
+			l.Fatal("Could not grant bootstrap admin", zap.String("Email", email), zap.Error(err))
+		}
+	}
+
+	// Initialize Sessions
+	var sessBackend utils.SessionBackend
+	if sessionStore == "memory" {
+		sessBackend = utils.NewMemorySessionBackend()
+	} else {
+		sessBackend, err = utils.NewMongoSessionBackend(dbContext, db.Database("carp"))
+		if err != nil {
+			l.Fatal("Could not initialize session store", zap.Error(err))
+		}
+	}
+	sess := utils.NewSessionStore(
+		sessBackend,
+		&sessions.Options{
+			Path:     "/",
+			HttpOnly: true,
+			Secure:   true,
+			SameSite: http.SameSiteLaxMode,
+		},
+		sessionIdleTimeout,
+		sessionAbsoluteTimeout,
+		sessionKeyPairs...,
+	)
+
+	// Initialize Live Events
+	events := utils.NewBroadcaster(l)
+	if eventChangeStreams {
+		events, err = utils.NewMongoBroadcaster(dbContext, l, db.Database("carp"))
+		if err != nil {
+			l.Fatal("Could not initialize live events", zap.Error(err))
+		}
+	}
+	eventsContext, eventsCancel := context.WithCancel(context.Background())
+	defer eventsCancel()
+	go events.Watch(eventsContext)
+
 	// Initialize Routes
-	sm := mux.NewRouter()
+	// The API authenticates with bearer tokens rather than cookies, so only the browser routes need CSRF tokens
+	root := mux.NewRouter()
+	apih := handlers.NewAPI(l, db.Database("carp"))
+	apiRouter := root.PathPrefix("/api/v1").Subrouter()
+	apih.Register(apiRouter)
 
-	hh := handlers.NewHome(l, db.Database("carp"), sess, &templates, googleKey, googleSecret, sessionKey, host, port)
+	sm := root.NewRoute().Subrouter()
+	sec := handlers.NewSecurity(l, sess, &templates)
+	sm.Use(sec.CSRFMiddleware)
+
+	hh := handlers.NewHome(l, db.Database("carp"), vault, sess, &templates, googleKey, googleSecret, sessionKey, host, port)
 	sm.HandleFunc("/", hh.LandingPage).Methods(http.MethodGet)
+	sm.HandleFunc("/login", hh.Login).Methods(http.MethodGet)
 	sm.HandleFunc("/auth", hh.GoogleAuth).Methods(http.MethodGet)
+	sm.HandleFunc("/logout", hh.Logout).Methods(http.MethodPost)
 
-	sh := handlers.NewSurvey(l, db.Database("carp"), sess, &templates)
+	sh := handlers.NewSurvey(l, db.Database("carp"), sess, &templates, events, vault)
 	surveyRouter := sm.PathPrefix("/survey").Subrouter()
 	surveyRouter.Use(sh.UserMiddleware)
 	surveyRouter.HandleFunc("/start", sh.StartPage).Methods(http.MethodGet)
@@ -102,20 +226,59 @@ func main() {
 
 	oh := handlers.NewOther(l, &templates, db.Database("carp"))
 	sm.HandleFunc("/wrong_account", oh.WrongAccountPage).Methods(http.MethodGet)
+	ah := handlers.NewAdmin(l, db.Database("carp"), vault, sess, &templates, stepUpTTL, location, events)
 	statsRouter := sm.PathPrefix("/statistics.csv").Subrouter()
-	statsRouter.Use(sh.UserMiddleware)
+	statsRouter.Use(sh.UserMiddleware, handlers.RequirePermission(models.PermExportData), ah.RequireStepUp)
 	statsRouter.HandleFunc("", oh.StatisticsPage)
 
+	adminRouter := sm.PathPrefix("/admin").Subrouter()
+	adminRouter.Use(sh.UserMiddleware, handlers.RequirePermission(models.PermViewProgress))
+	adminRouter.HandleFunc("", ah.HomePage).Methods(http.MethodGet)
+	adminRouter.HandleFunc("/events", ah.EventStream).Methods(http.MethodGet)
+	adminRouter.HandleFunc("/charts/enrollment.svg", ah.EnrollmentChart).Methods(http.MethodGet)
+	adminRouter.HandleFunc("/mfa", ah.MFAPage).Methods(http.MethodGet)
+	adminRouter.HandleFunc("/mfa", ah.EnrollMFA).Methods(http.MethodPost)
+	adminRouter.HandleFunc("/stepup", ah.StepUpPage).Methods(http.MethodGet)
+	adminRouter.HandleFunc("/stepup", ah.StepUp).Methods(http.MethodPost)
+	sessionsRouter := adminRouter.PathPrefix("/sessions").Subrouter()
+	sessionsRouter.Use(handlers.RequirePermission(models.PermManageSessions), ah.RequireStepUp)
+	sessionsRouter.HandleFunc("", ah.SessionsPage).Methods(http.MethodGet)
+	sessionsRouter.HandleFunc("/revoke", ah.RevokeSessions).Methods(http.MethodPost)
+	analysisRouter := adminRouter.PathPrefix("/analysis").Subrouter()
+	analysisRouter.Use(handlers.RequirePermission(models.PermExportData), ah.RequireStepUp)
+	analysisRouter.HandleFunc("", ah.AnalysisPage).Methods(http.MethodGet)
+	analysisRouter.HandleFunc("/items", ah.ItemsPage).Methods(http.MethodGet)
+	analysisRouter.HandleFunc("/irt", ah.IRTPage).Methods(http.MethodGet)
+	analysisRouter.Handle("/irt", handlers.RequirePermission(models.PermManageStudy)(http.HandlerFunc(ah.CalibrateArticles))).Methods(http.MethodPost)
+	analysisRouter.HandleFunc("/charts/{chart}.svg", ah.AnalysisChart).Methods(http.MethodGet)
+	analysisRouter.HandleFunc("/report.pdf", ah.StudyReport).Methods(http.MethodGet)
+	analysisRouter.HandleFunc("/quality", ah.QualityPage).Methods(http.MethodGet)
+	analysisRouter.Handle("/quality", handlers.RequirePermission(models.PermManageStudy)(http.HandlerFunc(ah.SaveQualityThresholds))).Methods(http.MethodPost)
+	exclusionsRouter := adminRouter.PathPrefix("/exclusions").Subrouter()
+	exclusionsRouter.Use(handlers.RequirePermission(models.PermExportData), ah.RequireStepUp)
+	exclusionsRouter.HandleFunc("", ah.ExclusionsPage).Methods(http.MethodGet)
+	exclusionsRouter.Handle("", handlers.RequirePermission(models.PermManageStudy)(http.HandlerFunc(ah.ExcludeParticipant))).Methods(http.MethodPost)
+	tokensRouter := adminRouter.PathPrefix("/tokens").Subrouter()
+	tokensRouter.Use(handlers.RequirePermission(models.PermManageStudy), ah.RequireStepUp)
+	tokensRouter.HandleFunc("", ah.TokensPage).Methods(http.MethodGet)
+	tokensRouter.HandleFunc("", ah.CreateToken).Methods(http.MethodPost)
+	tokensRouter.HandleFunc("/revoke", ah.RevokeToken).Methods(http.MethodPost)
+	rolesRouter := adminRouter.PathPrefix("/roles").Subrouter()
+	rolesRouter.Use(handlers.RequirePermission(models.PermManageRoles))
+	rolesRouter.HandleFunc("", ah.RolesPage).Methods(http.MethodGet)
+	rolesRouter.HandleFunc("", ah.GrantRole).Methods(http.MethodPost)
+
 	fileServer := http.FileServer(http.FS(static))
 	sm.PathPrefix("/static").Handler(http.StripPrefix("/", fileServer))
 
 	// Start HTTP Server
+	// Live event streams end themselves before the write timeout, exports need more than a second on larger studies
 	s := http.Server{
 		Addr:         ":" + port,
-		Handler:      sm,
+		Handler:      root,
 		IdleTimeout:  120 * time.Second,
 		ReadTimeout:  1 * time.Second,
-		WriteTimeout: 1 * time.Second,
+		WriteTimeout: 60 * time.Second,
 	}
 	go func() {
 		err := s.ListenAndServe()
@@ -125,7 +288,7 @@ func main() {
 	}()
 	l.Info("Server Started")
 	// Handle Graceful Server Shutdown
-	sigChan := make(chan os.Signal)
+	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, os.Kill)
 
 	sig := <-sigChan
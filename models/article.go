@@ -1,11 +1,93 @@
 package models
 
 import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type Article struct {
 	ID          primitive.ObjectID `bson:"_id,omitempty"`
 	Title       string             `bson:"title"`
 	PictureCode string             `bson:"picture_code"`
+	Veracity    Veracity           `bson:"veracity,omitempty"`
+	Source      string             `bson:"source,omitempty"`
+	Topic       string             `bson:"topic,omitempty"`
+	Lean        Lean               `bson:"lean,omitempty"`
+	Calibration *Calibration       `bson:"calibration,omitempty"`
+	// AttentionCheck is the rating an instructed-response article asks participants to give, such as "Please rate
+	// this headline as 5". It is nil for real headlines.
+	AttentionCheck *int `bson:"attention_check,omitempty"`
+}
+
+// Calibration holds an article's graded response model parameters, estimated from the ratings of a past study so
+// later studies can pick headlines by how believable and how informative they are. Thresholds are on the latent
+// scale, one between each pair of neighbouring points of the rating scale.
+type Calibration struct {
+	Discrimination float64   `bson:"discrimination" json:"discrimination"`
+	Thresholds     []float64 `bson:"thresholds" json:"thresholds"`
+	Location       float64   `bson:"location" json:"location"`
+	ScaleMin       int       `bson:"scale_min" json:"scale_min"`
+	ScaleMax       int       `bson:"scale_max" json:"scale_max"`
+	Respondents    int       `bson:"respondents" json:"respondents"`
+	CalibratedOn   time.Time `bson:"calibrated_on" json:"calibrated_on"`
+}
+
+// Veracity tells whether an article's headline is true or false, empty when it has not been labelled
+type Veracity string
+
+const (
+	VeracityTrue  Veracity = "true"
+	VeracityFalse Veracity = "false"
+)
+
+// Lean is the political leaning of an article's headline or source, empty when it has not been labelled
+type Lean string
+
+const (
+	LeanLeft    Lean = "left"
+	LeanCenter  Lean = "center"
+	LeanRight   Lean = "right"
+	LeanNeutral Lean = "neutral"
+)
+
+// Leans lists every lean in the order they are offered
+var Leans = []Lean{LeanLeft, LeanCenter, LeanRight, LeanNeutral}
+
+// ParseVeracity accepts `true`, `false` or an empty string for unlabelled articles
+func ParseVeracity(s string) (Veracity, error) {
+	switch v := Veracity(s); v {
+	case "", VeracityTrue, VeracityFalse:
+		return v, nil
+	}
+	return "", fmt.Errorf("unknown veracity `%s`", s)
+}
+
+// ParseLean accepts one of Leans or an empty string for unlabelled articles
+func ParseLean(s string) (Lean, error) {
+	if s == "" {
+		return "", nil
+	}
+	for _, l := range Leans {
+		if string(l) == s {
+			return l, nil
+		}
+	}
+	return "", fmt.Errorf("unknown lean `%s`", s)
+}
+
+// SaveCalibrations stores freshly estimated parameters on each article, keyed by article ID. Articles that are not
+// given keep their existing calibration.
+func SaveCalibrations(ctx context.Context, db *mongo.Database, calibrations map[primitive.ObjectID]Calibration) error {
+	for id, c := range calibrations {
+		_, err := db.Collection("articles").UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"calibration": c}})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
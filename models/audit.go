@@ -0,0 +1,50 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Audit actions
+const (
+	AuditMFAEnrolled         = "mfa_enrolled"
+	AuditStepUp              = "step_up"
+	AuditStepUpRecovery      = "step_up_recovery_code"
+	AuditStepUpFailed        = "step_up_failed"
+	AuditStepUpLocked        = "step_up_locked"
+	AuditTokenCreated        = "api_token_created"
+	AuditTokenRevoked        = "api_token_revoked"
+	AuditParticipantExcluded = "participant_excluded"
+	AuditParticipantIncluded = "participant_reinstated"
+)
+
+// AuditEntry records a security relevant action taken by a staff user, or a decision about who is in the data
+type AuditEntry struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty"`
+	UserID     primitive.ObjectID `bson:"user_id"`
+	Action     string             `bson:"action"`
+	Detail     string             `bson:"detail,omitempty"`
+	RemoteAddr string             `bson:"remote_addr,omitempty"`
+	CreatedOn  time.Time          `bson:"created_on"`
+}
+
+// Audit appends an entry to the `audit` collection
+func Audit(ctx context.Context, db *mongo.Database, userID primitive.ObjectID, action string, detail string, remoteAddr string) error {
+	_, err := db.Collection("audit").InsertOne(ctx, AuditEntry{
+		UserID:     userID,
+		Action:     action,
+		Detail:     detail,
+		RemoteAddr: remoteAddr,
+		CreatedOn:  time.Now(),
+	})
+	return err
+}
+
+// CountAudit counts a user's entries of an action since the given time, so repeated failures can be throttled
+func CountAudit(ctx context.Context, db *mongo.Database, userID primitive.ObjectID, action string, since time.Time) (int64, error) {
+	return db.Collection("audit").CountDocuments(ctx, bson.M{"user_id": userID, "action": action, "created_on": bson.M{"$gte": since}})
+}
@@ -0,0 +1,133 @@
+package models
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Dataset is everything an export needs: the study, its articles in a stable order and the participants matching
+// the export's filter. Attention checks are kept apart from the headlines in Articles, so they never count as ratings.
+type Dataset struct {
+	Study        *Study
+	Articles     []Article
+	Checks       []Article
+	Participants []User
+	Filter       ParticipantFilter
+	ExportedOn   time.Time
+}
+
+// LoadDataset gathers the study, articles and the participants matching the filter
+func LoadDataset(ctx context.Context, db *mongo.Database, f ParticipantFilter) (*Dataset, error) {
+	study, err := LoadStudy(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	cur, err := db.Collection("articles").Find(ctx, bson.D{}, options.Find().SetSort(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+	all := make([]Article, 0)
+	if err = cur.All(ctx, &all); err != nil {
+		return nil, err
+	}
+	articles, checks := make([]Article, 0, len(all)), make([]Article, 0)
+	for _, a := range all {
+		if a.AttentionCheck != nil {
+			checks = append(checks, a)
+		} else {
+			articles = append(articles, a)
+		}
+	}
+	participants, err := FindParticipants(ctx, db, f)
+	if err != nil {
+		return nil, err
+	}
+	return &Dataset{
+		Study:        study,
+		Articles:     articles,
+		Checks:       checks,
+		Participants: participants,
+		Filter:       f,
+		ExportedOn:   time.Now(),
+	}, nil
+}
+
+// SurveyLength is how many articles every participant is shown, attention checks included, which is what their
+// completion status is measured against
+func (d *Dataset) SurveyLength() int {
+	return len(d.Articles) + len(d.Checks)
+}
+
+// LongRow is a single rating in long (tidy) format, one row per participant and article
+type LongRow struct {
+	Pseudonym       string     `json:"pseudonym"`
+	Condition       string     `json:"condition"`
+	ArticleID       string     `json:"article_id"`
+	ArticleTitle    string     `json:"article_title"`
+	Dimension       string     `json:"dimension"`
+	Value           int        `json:"value"`
+	OrderIndex      *int       `json:"order_index"`
+	ShownOn         *time.Time `json:"shown_on"`
+	RatedOn         *time.Time `json:"rated_on"`
+	ArticleVeracity Veracity   `json:"article_veracity"`
+	Excluded        *bool      `json:"excluded,omitempty"`
+}
+
+// LongColumns names the LongRow fields in the order CSV exports write them. Columns added later go at the end so
+// scripts reading them by position keep working, exports that include excluded participants add an `excluded` column.
+var LongColumns = []string{"pseudonym", "condition", "article_id", "article_title", "dimension", "value", "order_index", "shown_on", "rated_on",
+	"article_veracity"}
+
+// LongRows flattens the dataset into one row per rating, ordered by participant and then by the order articles
+// were rated in. Ratings without a recorded position come last, in article order. Whether the participant is excluded
+// is only set when the filter includes excluded participants.
+func (d *Dataset) LongRows() []LongRow {
+	rows := make([]LongRow, 0, len(d.Participants)*len(d.Articles))
+	for _, u := range d.Participants {
+		var excluded *bool
+		if d.Filter.IncludeExcluded {
+			excluded = new(bool)
+			*excluded = u.Excluded
+		}
+		start := len(rows)
+		for _, a := range d.Articles {
+			id := a.ID.Hex()
+			value, ok := u.Rating(id)
+			if !ok {
+				continue
+			}
+			row := LongRow{
+				Pseudonym:       u.Pseudonym,
+				Condition:       ConditionCode(u.SurveyType),
+				ArticleID:       id,
+				ArticleTitle:    a.Title,
+				ArticleVeracity: a.Veracity,
+				Dimension:       d.Study.Dimension,
+				Value:           value,
+				Excluded:        excluded,
+			}
+			if meta, ok := u.Responses[id]; ok {
+				if meta.Order > 0 {
+					order := meta.Order
+					row.OrderIndex = &order
+				}
+				row.ShownOn = meta.ShownOn
+				row.RatedOn = meta.RatedOn
+			}
+			rows = append(rows, row)
+		}
+		own := rows[start:]
+		sort.SliceStable(own, func(i, j int) bool {
+			if own[i].OrderIndex == nil {
+				return false
+			}
+			return own[j].OrderIndex == nil || *own[i].OrderIndex < *own[j].OrderIndex
+		})
+	}
+	return rows
+}
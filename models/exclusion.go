@@ -0,0 +1,102 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ExclusionReason is why a participant was left out of the data
+type ExclusionReason string
+
+// Exclusion reasons
+const (
+	ExclusionTestAccount    ExclusionReason = "test_account"
+	ExclusionDuplicate      ExclusionReason = "duplicate"
+	ExclusionFailedChecks   ExclusionReason = "failed_checks"
+	ExclusionLowQuality     ExclusionReason = "low_quality"
+	ExclusionIneligible     ExclusionReason = "ineligible"
+	ExclusionWithdrawn      ExclusionReason = "withdrawn"
+	ExclusionTechnicalIssue ExclusionReason = "technical_issue"
+	ExclusionOther          ExclusionReason = "other"
+)
+
+// ExclusionReasons lists every reason in the order they are offered
+var ExclusionReasons = []ExclusionReason{
+	ExclusionTestAccount, ExclusionDuplicate, ExclusionFailedChecks, ExclusionLowQuality, ExclusionIneligible,
+	ExclusionWithdrawn, ExclusionTechnicalIssue, ExclusionOther,
+}
+
+// ParseExclusionReason accepts one of ExclusionReasons
+func ParseExclusionReason(s string) (ExclusionReason, error) {
+	for _, r := range ExclusionReasons {
+		if string(r) == s {
+			return r, nil
+		}
+	}
+	return "", fmt.Errorf("unknown exclusion reason `%s`", s)
+}
+
+// ExclusionEvent records a participant being excluded or reinstated. Events are only ever appended, so a
+// participant's events are the full history of decisions about them.
+type ExclusionEvent struct {
+	Excluded bool               `bson:"excluded" json:"excluded"`
+	Reason   ExclusionReason    `bson:"reason,omitempty" json:"reason,omitempty"`
+	Note     string             `bson:"note,omitempty" json:"note,omitempty"`
+	By       primitive.ObjectID `bson:"by" json:"-"`
+	On       time.Time          `bson:"on" json:"on"`
+}
+
+// Exclusion returns the event that excluded the participant, or nil when they are included
+func (u *User) Exclusion() *ExclusionEvent {
+	if !u.Excluded || len(u.Exclusions) == 0 {
+		return nil
+	}
+	return &u.Exclusions[len(u.Exclusions)-1]
+}
+
+// ExclusionCode is the reason the participant is excluded, empty when they are included
+func (u *User) ExclusionCode() string {
+	if e := u.Exclusion(); e != nil {
+		return string(e.Reason)
+	}
+	return ""
+}
+
+// RecordExclusion excludes or reinstates the participant with the given pseudonym and appends the decision to their
+// history. It returns mongo.ErrNoDocuments when there is no such participant.
+func RecordExclusion(ctx context.Context, db *mongo.Database, pseudonym string, e ExclusionEvent) error {
+	res, err := db.Collection("users").UpdateOne(ctx, bson.M{"pseudonym": pseudonym, "role": RoleParticipant}, bson.M{
+		"$set":  bson.M{"excluded": e.Excluded},
+		"$push": bson.M{"exclusions": e},
+	})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// ExclusionHistory returns every participant who has ever been excluded, most recently decided first
+func ExclusionHistory(ctx context.Context, db *mongo.Database) ([]User, error) {
+	cur, err := db.Collection("users").Find(ctx, bson.M{"role": RoleParticipant, "exclusions.0": bson.M{"$exists": true}})
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	users := make([]User, 0)
+	if err = cur.All(ctx, &users); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(users, func(i, j int) bool {
+		return users[i].Exclusions[len(users[i].Exclusions)-1].On.After(users[j].Exclusions[len(users[j].Exclusions)-1].On)
+	})
+	return users, nil
+}
@@ -0,0 +1,278 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Completion statuses participants can be filtered by
+const (
+	StatusNotStarted = "not_started"
+	StatusStarted    = "started"
+	StatusCompleted  = "completed"
+)
+
+// ParticipantFilter narrows down which participants an export or API request covers
+type ParticipantFilter struct {
+	SurveyType      *int
+	Status          string
+	From            *time.Time
+	To              *time.Time
+	IncludeExcluded bool
+}
+
+// ParseParticipantFilter reads `condition`, `status`, `from` and `to` from a query string. Dates are either
+// RFC 3339 timestamps or plain `2006-01-02` days, `to` days are inclusive. Excluded participants are left out unless
+// `excluded=include`.
+func ParseParticipantFilter(q url.Values) (ParticipantFilter, error) {
+	f := ParticipantFilter{}
+	if v := q.Get("condition"); v != "" {
+		surveyType, err := ParseCondition(v)
+		if err != nil {
+			return f, err
+		}
+		f.SurveyType = &surveyType
+	}
+	switch v := q.Get("status"); v {
+	case "", StatusNotStarted, StatusStarted, StatusCompleted:
+		f.Status = v
+	default:
+		return f, fmt.Errorf("unknown status `%s`", v)
+	}
+	switch v := q.Get("excluded"); v {
+	case "":
+	case "include":
+		f.IncludeExcluded = true
+	default:
+		return f, fmt.Errorf("unknown exclusion option `%s`, use include", v)
+	}
+	var err error
+	if f.From, err = parseFilterTime(q.Get("from"), false); err != nil {
+		return f, err
+	}
+	if f.To, err = parseFilterTime(q.Get("to"), true); err != nil {
+		return f, err
+	}
+	return f, nil
+}
+
+func parseFilterTime(v string, endOfDay bool) (*time.Time, error) {
+	if v == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return &t, nil
+	}
+	t, err := time.Parse("2006-01-02", v)
+	if err != nil {
+		return nil, fmt.Errorf("`%s` is not a date", v)
+	}
+	if endOfDay {
+		t = t.Add(24*time.Hour - time.Nanosecond)
+	}
+	return &t, nil
+}
+
+// Query builds the Mongo filter over `users` for participants matching f. Participants who completed the survey
+// before completion times were recorded are recognized by having rated all articleCount articles.
+func (f ParticipantFilter) Query(articleCount int64) bson.M {
+	query := bson.M{"role": RoleParticipant}
+	if !f.IncludeExcluded {
+		query["excluded"] = bson.M{"$ne": true}
+	}
+	if f.SurveyType != nil {
+		query["survey_type"] = *f.SurveyType
+	}
+	if f.From != nil || f.To != nil {
+		created := bson.M{}
+		if f.From != nil {
+			created["$gte"] = *f.From
+		}
+		if f.To != nil {
+			created["$lte"] = *f.To
+		}
+		query["created_on"] = created
+	}
+	answered := bson.M{"$size": bson.M{"$objectToArray": bson.M{"$ifNull": bson.A{"$survey_data", bson.M{}}}}}
+	completed := bson.A{
+		bson.M{"completed_on": bson.M{"$exists": true}},
+		bson.M{"$expr": bson.M{"$and": bson.A{
+			bson.M{"$gt": bson.A{articleCount, 0}},
+			bson.M{"$gte": bson.A{answered, articleCount}},
+		}}},
+	}
+	switch f.Status {
+	case StatusNotStarted:
+		query["$expr"] = bson.M{"$eq": bson.A{answered, 0}}
+	case StatusStarted:
+		query["$expr"] = bson.M{"$gt": bson.A{answered, 0}}
+		query["$nor"] = completed
+	case StatusCompleted:
+		query["$or"] = completed
+	}
+	return query
+}
+
+// Encode writes the filter back into query string form, used for pagination links
+func (f ParticipantFilter) Encode(q url.Values) {
+	if f.SurveyType != nil {
+		q.Set("condition", ConditionCode(*f.SurveyType))
+	}
+	if f.Status != "" {
+		q.Set("status", f.Status)
+	}
+	if f.From != nil {
+		q.Set("from", f.From.Format(time.RFC3339))
+	}
+	if f.To != nil {
+		q.Set("to", f.To.Format(time.RFC3339))
+	}
+	if f.IncludeExcluded {
+		q.Set("excluded", "include")
+	}
+}
+
+// String describes the filter for people, such as `condition with_image, status completed, excluded include`
+func (f ParticipantFilter) String() string {
+	q := url.Values{}
+	f.Encode(q)
+	parts := make([]string, 0, len(q))
+	for _, k := range []string{"condition", "status", "from", "to", "excluded"} {
+		if v := q.Get(k); v != "" {
+			parts = append(parts, k+" "+v)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// FindParticipants returns the participants matching the filter, oldest first
+func FindParticipants(ctx context.Context, db *mongo.Database, f ParticipantFilter) ([]User, error) {
+	articleCount, err := db.Collection("articles").CountDocuments(ctx, bson.D{})
+	if err != nil {
+		return nil, err
+	}
+	cur, err := db.Collection("users").Find(ctx, f.Query(articleCount), options.Find().SetSort(bson.D{{Key: "created_on", Value: 1}, {Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	users := make([]User, 0)
+	if err = cur.All(ctx, &users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// FindParticipantsPage returns at most limit participants matching the filter after skipping the first skip, oldest
+// first, along with how many match in total
+func FindParticipantsPage(ctx context.Context, db *mongo.Database, f ParticipantFilter, skip, limit int64) ([]User, int64, error) {
+	articleCount, err := db.Collection("articles").CountDocuments(ctx, bson.D{})
+	if err != nil {
+		return nil, 0, err
+	}
+	query := f.Query(articleCount)
+	total, err := db.Collection("users").CountDocuments(ctx, query)
+	if err != nil {
+		return nil, 0, err
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_on", Value: 1}, {Key: "_id", Value: 1}}).
+		SetSkip(skip).
+		SetLimit(limit)
+	cur, err := db.Collection("users").Find(ctx, query, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cur.Close(ctx)
+	users := make([]User, 0)
+	if err = cur.All(ctx, &users); err != nil {
+		return nil, 0, err
+	}
+	return users, total, nil
+}
+
+// Rating is one participant's rating of one article, as listed by FindRatingsPage
+type Rating struct {
+	Pseudonym  string `bson:"pseudonym"`
+	SurveyType int    `bson:"survey_type"`
+	ArticleID  string `bson:"article_id"`
+	Value      int    `bson:"value"`
+}
+
+// FindRatingsPage returns at most limit ratings by the participants matching the filter after skipping the first
+// skip, along with how many there are in total. Ratings are ordered like the participants, oldest first, then by
+// article. Only ratings of the given articles are listed, ratings of articles since deleted never are.
+func FindRatingsPage(
+	ctx context.Context,
+	db *mongo.Database,
+	f ParticipantFilter,
+	articleIDs []primitive.ObjectID,
+	skip, limit int64,
+) ([]Rating, int64, error) {
+	articleCount, err := db.Collection("articles").CountDocuments(ctx, bson.D{})
+	if err != nil {
+		return nil, 0, err
+	}
+	keys := make(bson.A, len(articleIDs))
+	for i, id := range articleIDs {
+		keys[i] = id.Hex()
+	}
+	// Ratings are keyed by hex article ID, which sorts like the IDs themselves
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: f.Query(articleCount)}},
+		{{Key: "$project", Value: bson.M{
+			"pseudonym":   1,
+			"survey_type": 1,
+			"created_on":  1,
+			"rating":      bson.M{"$objectToArray": bson.M{"$ifNull": bson.A{"$survey_data", bson.M{}}}},
+		}}},
+		{{Key: "$unwind", Value: "$rating"}},
+		{{Key: "$match", Value: bson.M{"rating.k": bson.M{"$in": keys}, "rating.v": bson.M{"$type": "number"}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "created_on", Value: 1}, {Key: "_id", Value: 1}, {Key: "rating.k", Value: 1}}}},
+		{{Key: "$facet", Value: bson.M{
+			"total": bson.A{bson.M{"$count": "n"}},
+			"items": bson.A{
+				bson.M{"$skip": skip},
+				bson.M{"$limit": limit},
+				bson.M{"$project": bson.M{
+					"_id":         0,
+					"pseudonym":   1,
+					"survey_type": 1,
+					"article_id":  "$rating.k",
+					"value":       bson.M{"$trunc": "$rating.v"},
+				}},
+			},
+		}}},
+	}
+	cur, err := db.Collection("users").Aggregate(ctx, pipeline, options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cur.Close(ctx)
+	var result []struct {
+		Total []struct {
+			N int64 `bson:"n"`
+		} `bson:"total"`
+		Items []Rating `bson:"items"`
+	}
+	if err = cur.All(ctx, &result); err != nil {
+		return nil, 0, err
+	}
+	ratings := make([]Rating, 0)
+	var total int64
+	if len(result) > 0 {
+		ratings = append(ratings, result[0].Items...)
+		if len(result[0].Total) > 0 {
+			total = result[0].Total[0].N
+		}
+	}
+	return ratings, total, nil
+}
@@ -0,0 +1,170 @@
+package models
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Identity links a Google account to a user record. Identities live in their own database so access to the research
+// data in `users` never implies access to who the participants are. Participants are only stored as a keyed hash of
+// their email, staff additionally keep their plain email so they can be listed and managed.
+type Identity struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	EmailHash string             `bson:"email_hash"`
+	Email     string             `bson:"email,omitempty"`
+	UserID    primitive.ObjectID `bson:"user_id"`
+	CreatedOn time.Time          `bson:"created_on"`
+}
+
+// IdentityVault maps emails to user records without the research data ever containing an email.
+type IdentityVault struct {
+	coll *mongo.Collection
+	key  []byte
+}
+
+// NewIdentityVault opens the `identities` collection of the given (separately permissioned) database. The key is
+// used to hash emails, so without it the stored hashes cannot be brute forced from a list of school emails.
+func NewIdentityVault(ctx context.Context, db *mongo.Database, key []byte) (*IdentityVault, error) {
+	coll := db.Collection("identities")
+	_, err := coll.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "email_hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "user_id", Value: 1}}, Options: options.Index().SetUnique(true)},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &IdentityVault{coll, key}, nil
+}
+
+// HashEmail returns the keyed hash under which the email is stored
+func (v *IdentityVault) HashEmail(email string) string {
+	mac := hmac.New(sha256.New, v.key)
+	mac.Write([]byte(normalizeEmail(email)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// HashDevice returns a keyed hash of the random token identifying a participant's browser, so the stored value
+// cannot be matched against the cookie. Participants only share one when they answered from the same browser, which
+// hints at one person answering twice.
+func (v *IdentityVault) HashDevice(deviceToken string) string {
+	mac := hmac.New(sha256.New, v.key)
+	mac.Write([]byte("device\x00" + deviceToken))
+	return hex.EncodeToString(mac.Sum(nil))[:32]
+}
+
+// Lookup returns the user ID linked to the email, or mongo.ErrNoDocuments when the email has never signed in
+func (v *IdentityVault) Lookup(ctx context.Context, email string) (primitive.ObjectID, error) {
+	identity := Identity{}
+	if err := v.coll.FindOne(ctx, bson.M{"email_hash": v.HashEmail(email)}).Decode(&identity); err != nil {
+		return primitive.NilObjectID, err
+	}
+	return identity.UserID, nil
+}
+
+// Link records that the email belongs to the user. The plain email is only kept when keepEmail is set.
+func (v *IdentityVault) Link(ctx context.Context, email string, userID primitive.ObjectID, keepEmail bool) error {
+	set := bson.M{"user_id": userID}
+	update := bson.M{"$set": set, "$setOnInsert": bson.M{"created_on": time.Now()}}
+	if keepEmail {
+		set["email"] = normalizeEmail(email)
+	} else {
+		update["$unset"] = bson.M{"email": ""}
+	}
+	_, err := v.coll.UpdateOne(ctx, bson.M{"email_hash": v.HashEmail(email)}, update, options.Update().SetUpsert(true))
+	return err
+}
+
+// RevealEmail keeps or forgets the plain email of an already linked user, used when staff roles change
+func (v *IdentityVault) RevealEmail(ctx context.Context, email string, keepEmail bool) error {
+	update := bson.M{"$unset": bson.M{"email": ""}}
+	if keepEmail {
+		update = bson.M{"$set": bson.M{"email": normalizeEmail(email)}}
+	}
+	_, err := v.coll.UpdateOne(ctx, bson.M{"email_hash": v.HashEmail(email)}, update)
+	return err
+}
+
+// Emails returns the plain emails stored for the given users. Participants have none and are left out.
+func (v *IdentityVault) Emails(ctx context.Context, userIDs []primitive.ObjectID) (map[primitive.ObjectID]string, error) {
+	cur, err := v.coll.Find(ctx, bson.M{"user_id": bson.M{"$in": userIDs}, "email": bson.M{"$exists": true}})
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	emails := make(map[primitive.ObjectID]string, len(userIDs))
+	for cur.Next(ctx) {
+		identity := Identity{}
+		if err := cur.Decode(&identity); err != nil {
+			return nil, err
+		}
+		emails[identity.UserID] = identity.Email
+	}
+	return emails, cur.Err()
+}
+
+// NewPseudonym returns a random participant code such as `P-K7Q2M9XA` which is safe to publish with the data
+func NewPseudonym() string {
+	b := make([]byte, 5)
+	rand.Read(b)
+	return "P-" + base32.StdEncoding.EncodeToString(b)
+}
+
+// MigrateIdentities moves emails left on user records from before the identity vault into it and gives those
+// users a pseudonym.
+func MigrateIdentities(ctx context.Context, db *mongo.Database, vault *IdentityVault) error {
+	users := db.Collection("users")
+	cur, err := users.Find(ctx, bson.M{"$or": bson.A{
+		bson.M{"email": bson.M{"$exists": true}},
+		bson.M{"pseudonym": bson.M{"$exists": false}},
+	}})
+	if err != nil {
+		return err
+	}
+	defer cur.Close(ctx)
+	for cur.Next(ctx) {
+		var legacy struct {
+			ID        primitive.ObjectID `bson:"_id"`
+			Email     string             `bson:"email"`
+			Pseudonym string             `bson:"pseudonym"`
+			Role      Role               `bson:"role"`
+		}
+		if err := cur.Decode(&legacy); err != nil {
+			return err
+		}
+		if legacy.Email != "" {
+			if err := vault.Link(ctx, legacy.Email, legacy.ID, legacy.Role.IsStaff()); err != nil {
+				return err
+			}
+		}
+		update := bson.M{"$unset": bson.M{"email": ""}}
+		if legacy.Pseudonym == "" {
+			update["$set"] = bson.M{"pseudonym": NewPseudonym()}
+		}
+		if _, err := users.UpdateByID(ctx, legacy.ID, update); err != nil {
+			return err
+		}
+	}
+	if err := cur.Err(); err != nil {
+		return err
+	}
+	_, err = users.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "pseudonym", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
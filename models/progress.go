@@ -0,0 +1,142 @@
+package models
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Progress summarizes how far data collection has come, for the admin dashboard
+type Progress struct {
+	LoggedIn         int
+	Started          int
+	Completed        int
+	MedianCompletion time.Duration
+	Enrollment       []DayCount
+	Conditions       []ConditionCount
+	Articles         []ArticleCount
+}
+
+// DayCount is the number of participants who first signed in on a day
+type DayCount struct {
+	Day        time.Time
+	Count      int
+	Cumulative int
+}
+
+// ConditionCount is the funnel of a single survey condition
+type ConditionCount struct {
+	SurveyType int
+	Name       string
+	LoggedIn   int
+	Started    int
+	Completed  int
+}
+
+// ArticleCount is the number of ratings an article has received
+type ArticleCount struct {
+	Article
+	Responses int
+}
+
+// Percent returns part as a whole number percentage of total, for bar widths
+func Percent(part int, total int) int {
+	if total == 0 {
+		return 0
+	}
+	return part * 100 / total
+}
+
+// LoadProgress aggregates the participants in `users` and the ratings they gave each article
+func LoadProgress(ctx context.Context, db *mongo.Database, loc *time.Location) (*Progress, error) {
+	articles := make([]Article, 0)
+	cur, err := db.Collection("articles").Find(ctx, bson.D{})
+	if err != nil {
+		return nil, err
+	}
+	if err = cur.All(ctx, &articles); err != nil {
+		return nil, err
+	}
+	cur, err = db.Collection("users").Find(ctx, bson.M{"role": RoleParticipant})
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	progress := &Progress{
+		Conditions: []ConditionCount{
+			{SurveyType: SurveyNoImage, Name: ConditionName(SurveyNoImage)},
+			{SurveyType: SurveyWithImage, Name: ConditionName(SurveyWithImage)},
+		},
+	}
+	responses := make(map[string]int, len(articles))
+	days := make(map[time.Time]int)
+	durations := make([]time.Duration, 0)
+	for cur.Next(ctx) {
+		var user User
+		if err = cur.Decode(&user); err != nil {
+			return nil, err
+		}
+		started := len(user.Data) > 0
+		// Users who finished before completion times were recorded count as complete once every article is rated
+		completed := user.CompletedOn != nil || (len(articles) > 0 && len(user.Data) >= len(articles))
+		progress.LoggedIn++
+		condition := &progress.Conditions[0]
+		if user.SurveyType == SurveyWithImage {
+			condition = &progress.Conditions[1]
+		}
+		condition.LoggedIn++
+		if started {
+			progress.Started++
+			condition.Started++
+		}
+		if completed {
+			progress.Completed++
+			condition.Completed++
+		}
+		if user.StartedOn != nil && user.CompletedOn != nil {
+			durations = append(durations, user.CompletedOn.Sub(*user.StartedOn))
+		}
+		for k := range user.Data {
+			responses[k]++
+		}
+		if !user.CreatedOn.IsZero() {
+			t := user.CreatedOn.In(loc)
+			days[time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)]++
+		}
+	}
+	if err = cur.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(durations) > 0 {
+		sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+		mid := len(durations) / 2
+		if len(durations)%2 == 0 {
+			progress.MedianCompletion = (durations[mid-1] + durations[mid]) / 2
+		} else {
+			progress.MedianCompletion = durations[mid]
+		}
+	}
+	for day, count := range days {
+		progress.Enrollment = append(progress.Enrollment, DayCount{Day: day, Count: count})
+	}
+	sort.Slice(progress.Enrollment, func(i, j int) bool {
+		return progress.Enrollment[i].Day.Before(progress.Enrollment[j].Day)
+	})
+	total := 0
+	for i := range progress.Enrollment {
+		total += progress.Enrollment[i].Count
+		progress.Enrollment[i].Cumulative = total
+	}
+	for _, a := range articles {
+		progress.Articles = append(progress.Articles, ArticleCount{Article: a, Responses: responses[a.ID.Hex()]})
+	}
+	sort.SliceStable(progress.Articles, func(i, j int) bool {
+		return progress.Articles[i].Responses > progress.Articles[j].Responses
+	})
+	return progress, nil
+}
@@ -0,0 +1,196 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Role determines what a signed-in user is allowed to do besides taking the survey
+type Role string
+
+const (
+	RoleParticipant Role = "participant"
+	RoleViewer      Role = "viewer"
+	RoleAnalyst     Role = "analyst"
+	RoleStudyOwner  Role = "study_owner"
+	RoleSuperadmin  Role = "superadmin"
+)
+
+// Roles lists every role from least to most privileged
+var Roles = []Role{RoleParticipant, RoleViewer, RoleAnalyst, RoleStudyOwner, RoleSuperadmin}
+
+// Permission is a single capability checked by route middleware
+type Permission string
+
+const (
+	// PermViewProgress allows seeing aggregate participation progress
+	PermViewProgress Permission = "view_progress"
+	// PermExportData allows downloading participant responses
+	PermExportData Permission = "export_data"
+	// PermManageSessions allows listing and revoking other users' sessions
+	PermManageSessions Permission = "manage_sessions"
+	// PermManageStudy allows changing the study itself
+	PermManageStudy Permission = "manage_study"
+	// PermManageRoles allows granting and revoking roles
+	PermManageRoles Permission = "manage_roles"
+)
+
+var rolePermissions = map[Role][]Permission{
+	RoleParticipant: {},
+	RoleViewer:      {PermViewProgress},
+	RoleAnalyst:     {PermViewProgress, PermExportData},
+	RoleStudyOwner:  {PermViewProgress, PermExportData, PermManageSessions, PermManageStudy},
+	RoleSuperadmin:  {PermViewProgress, PermExportData, PermManageSessions, PermManageStudy, PermManageRoles},
+}
+
+// Can reports whether the role grants the permission
+func (r Role) Can(p Permission) bool {
+	for _, v := range rolePermissions[r] {
+		if v == p {
+			return true
+		}
+	}
+	return false
+}
+
+// IsStaff reports whether the role belongs to the research team rather than a participant
+func (r Role) IsStaff() bool {
+	return r != RoleParticipant && r != ""
+}
+
+// ParseRole converts user input such as `study_owner` into a Role
+func ParseRole(s string) (Role, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	for _, r := range Roles {
+		if string(r) == s {
+			return r, nil
+		}
+	}
+	return "", fmt.Errorf("unknown role `%s`", s)
+}
+
+// ErrNoSuchUser is returned when taking a role away from an email nobody has signed in with
+var ErrNoSuchUser = errors.New("no such user")
+
+// SetRoleByEmail assigns a role to the user with the given email. Staff who have not signed in yet are created so
+// the role applies on their first login, but participants are only ever created by signing in, so revoking the role
+// of an unknown email returns ErrNoSuchUser. Staff keep their plain email in the identity vault, participants do not.
+func SetRoleByEmail(ctx context.Context, db *mongo.Database, vault *IdentityVault, email string, role Role) error {
+	if strings.TrimSpace(email) == "" {
+		return fmt.Errorf("email is required")
+	}
+	userID, err := vault.Lookup(ctx, email)
+	if err == mongo.ErrNoDocuments {
+		if !role.IsStaff() {
+			return ErrNoSuchUser
+		}
+		res, err := db.Collection("users").InsertOne(ctx, User{
+			Pseudonym:  NewPseudonym(),
+			Role:       role,
+			SurveyType: rand.Intn(2),
+			Data:       bson.M{},
+			CreatedOn:  time.Now(),
+			UpdatedOn:  time.Now(),
+		})
+		if err != nil {
+			return err
+		}
+		return vault.Link(ctx, email, res.InsertedID.(primitive.ObjectID), role.IsStaff())
+	} else if err != nil {
+		return err
+	}
+	if role != RoleSuperadmin {
+		if err = ensureAnotherSuperadmin(ctx, db, userID); err != nil {
+			return err
+		}
+	}
+	_, err = db.Collection("users").UpdateByID(ctx, userID, bson.M{"$set": bson.M{"role": role, "updated_on": time.Now()}})
+	if err != nil {
+		return err
+	}
+	return vault.RevealEmail(ctx, email, role.IsStaff())
+}
+
+// StaffMember is a staff user together with the email kept for them in the identity vault
+type StaffMember struct {
+	User
+	Email string
+}
+
+// StaffUsers lists every user holding a role other than participant
+func StaffUsers(ctx context.Context, db *mongo.Database, vault *IdentityVault) ([]StaffMember, error) {
+	cur, err := db.Collection("users").Find(ctx, bson.M{"role": bson.M{"$nin": []Role{RoleParticipant, ""}}})
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	users := make([]User, 0)
+	if err = cur.All(ctx, &users); err != nil {
+		return nil, err
+	}
+	ids := make([]primitive.ObjectID, len(users))
+	for i, u := range users {
+		ids[i] = u.ID
+	}
+	emails, err := vault.Emails(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	staff := make([]StaffMember, len(users))
+	for i, u := range users {
+		staff[i] = StaffMember{User: u, Email: emails[u.ID]}
+	}
+	sort.Slice(staff, func(i, j int) bool {
+		return staff[i].Email < staff[j].Email
+	})
+	return staff, nil
+}
+
+// MigrateRoles assigns roles to users created before roles existed, turning the legacy `is_admin` flag into the
+// superadmin role.
+func MigrateRoles(ctx context.Context, db *mongo.Database) error {
+	users := db.Collection("users")
+	_, err := users.UpdateMany(ctx, bson.M{"role": bson.M{"$exists": false}, "is_admin": true}, bson.M{
+		"$set":   bson.M{"role": RoleSuperadmin},
+		"$unset": bson.M{"is_admin": ""},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = users.UpdateMany(ctx, bson.M{"role": bson.M{"$exists": false}}, bson.M{
+		"$set":   bson.M{"role": RoleParticipant},
+		"$unset": bson.M{"is_admin": ""},
+	})
+	return err
+}
+
+// ensureAnotherSuperadmin refuses to demote the last remaining superadmin
+func ensureAnotherSuperadmin(ctx context.Context, db *mongo.Database, userID primitive.ObjectID) error {
+	user := User{}
+	err := db.Collection("users").FindOne(ctx, bson.M{"_id": userID}).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if user.Role != RoleSuperadmin {
+		return nil
+	}
+	count, err := db.Collection("users").CountDocuments(ctx, bson.M{"role": RoleSuperadmin})
+	if err != nil {
+		return err
+	}
+	if count <= 1 {
+		return fmt.Errorf("cannot remove the last superadmin")
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Session represents a server-side login session. The cookie handed to the browser only carries an opaque token,
+// the record itself is keyed by a hash of that token so a database dump cannot be replayed as a cookie.
+type Session struct {
+	ID         string             `bson:"_id"`
+	UserID     primitive.ObjectID `bson:"user_id,omitempty"`
+	Values     bson.M             `bson:"values"`
+	UserAgent  string             `bson:"user_agent"`
+	RemoteAddr string             `bson:"remote_addr"`
+	CreatedOn  time.Time          `bson:"created_on"`
+	LastSeenOn time.Time          `bson:"last_seen_on"`
+	ExpiresOn  time.Time          `bson:"expires_on"`
+	RevokedOn  *time.Time         `bson:"revoked_on,omitempty"`
+}
+
+// Active reports whether the session may still be used at the given time.
+func (s *Session) Active(now time.Time, idleTimeout time.Duration) bool {
+	if s.RevokedOn != nil {
+		return false
+	}
+	if !now.Before(s.ExpiresOn) {
+		return false
+	}
+	if idleTimeout > 0 && now.Sub(s.LastSeenOn) > idleTimeout {
+		return false
+	}
+	return true
+}
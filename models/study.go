@@ -0,0 +1,177 @@
+package models
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Study describes the study carp is collecting data for. It is read from the `studies` collection, falling back to
+// DefaultStudy when no document has been stored.
+type Study struct {
+	ID           string      `bson:"_id" json:"id"`
+	Title        string      `bson:"title" json:"title"`
+	Description  string      `bson:"description" json:"description"`
+	Investigator string      `bson:"investigator" json:"investigator"`
+	Dimension    string      `bson:"dimension" json:"dimension"`
+	Scale        Scale       `bson:"scale" json:"scale"`
+	Conditions   []Condition `bson:"conditions" json:"conditions"`
+	Quality      Quality     `bson:"quality" json:"quality"`
+}
+
+// Quality holds the thresholds at which a participant's responses are flagged as suspicious. Flags only inform
+// decisions, nobody is dropped from the data because of them.
+type Quality struct {
+	// SpeederShare flags participants who finished in less than this share of the median completion time
+	SpeederShare float64 `bson:"speeder_share" json:"speeder_share"`
+	// FastItemSeconds and FastItemShare flag participants who rated at least that share of articles within that
+	// many seconds of seeing them
+	FastItemSeconds float64 `bson:"fast_item_seconds" json:"fast_item_seconds"`
+	FastItemShare   float64 `bson:"fast_item_share" json:"fast_item_share"`
+	// MinRatings is how many ratings a participant needs before straight-lining and low variance are judged
+	MinRatings int `bson:"min_ratings" json:"min_ratings"`
+	// MinSD flags participants whose ratings vary less than this standard deviation
+	MinSD float64 `bson:"min_sd" json:"min_sd"`
+	// FailedChecks flags participants who failed at least this many attention checks
+	FailedChecks int `bson:"failed_checks" json:"failed_checks"`
+}
+
+// DefaultQuality are the thresholds used until the study stores its own
+var DefaultQuality = Quality{
+	SpeederShare:    0.5,
+	FastItemSeconds: 2,
+	FastItemShare:   0.5,
+	MinRatings:      3,
+	MinSD:           0.5,
+	FailedChecks:    1,
+}
+
+// WithDefaults fills thresholds that have not been set from DefaultQuality
+func (q Quality) WithDefaults() Quality {
+	if q.SpeederShare <= 0 {
+		q.SpeederShare = DefaultQuality.SpeederShare
+	}
+	if q.FastItemSeconds <= 0 {
+		q.FastItemSeconds = DefaultQuality.FastItemSeconds
+	}
+	if q.FastItemShare <= 0 {
+		q.FastItemShare = DefaultQuality.FastItemShare
+	}
+	if q.MinRatings <= 0 {
+		q.MinRatings = DefaultQuality.MinRatings
+	}
+	if q.MinSD <= 0 {
+		q.MinSD = DefaultQuality.MinSD
+	}
+	if q.FailedChecks <= 0 {
+		q.FailedChecks = DefaultQuality.FailedChecks
+	}
+	return q
+}
+
+// Scale is the Likert scale every article is rated on
+type Scale struct {
+	Min     int           `bson:"min" json:"min"`
+	Max     int           `bson:"max" json:"max"`
+	Anchors []ScaleAnchor `bson:"anchors" json:"anchors"`
+}
+
+// ScaleAnchor labels a single point of the scale
+type ScaleAnchor struct {
+	Value int    `bson:"value" json:"value"`
+	Label string `bson:"label" json:"label"`
+}
+
+// Condition is one of the groups participants are randomly assigned to
+type Condition struct {
+	SurveyType int    `bson:"survey_type" json:"survey_type"`
+	Code       string `bson:"code" json:"code"`
+	Name       string `bson:"name" json:"name"`
+}
+
+// ShowsImage reports whether participants in the condition see the article's picture next to its headline
+func (c Condition) ShowsImage() bool {
+	return c.SurveyType == SurveyWithImage
+}
+
+// DefaultStudy matches the instructions shown to participants on the start page
+var DefaultStudy = Study{
+	ID:           "default",
+	Title:        "Colin's AP Research Platform",
+	Description:  "Participants rate the believability of news headlines, shown with or without an accompanying image.",
+	Investigator: "Colin Clark",
+	Dimension:    "believability",
+	Scale: Scale{
+		Min: 1,
+		Max: 5,
+		Anchors: []ScaleAnchor{
+			{Value: 1, Label: "1 - Least believable"},
+			{Value: 2, Label: "2"},
+			{Value: 3, Label: "3"},
+			{Value: 4, Label: "4"},
+			{Value: 5, Label: "5 - Most believable"},
+		},
+	},
+	Conditions: []Condition{
+		{SurveyType: SurveyNoImage, Code: "no_image", Name: ConditionName(SurveyNoImage)},
+		{SurveyType: SurveyWithImage, Code: "with_image", Name: ConditionName(SurveyWithImage)},
+	},
+	Quality: DefaultQuality,
+}
+
+// LoadStudy returns the stored study description or DefaultStudy
+func LoadStudy(ctx context.Context, db *mongo.Database) (*Study, error) {
+	study := Study{}
+	err := db.Collection("studies").FindOne(ctx, bson.M{}).Decode(&study)
+	if err == mongo.ErrNoDocuments {
+		study = DefaultStudy
+		return &study, nil
+	} else if err != nil {
+		return nil, err
+	}
+	study.Quality = study.Quality.WithDefaults()
+	return &study, nil
+}
+
+// SaveQuality stores new quality thresholds on the study, storing DefaultStudy first if there is no study yet
+func SaveQuality(ctx context.Context, db *mongo.Database, q Quality) error {
+	study, err := LoadStudy(ctx, db)
+	if err != nil {
+		return err
+	}
+	study.Quality = q.WithDefaults()
+	_, err = db.Collection("studies").ReplaceOne(ctx, bson.M{"_id": study.ID}, study, options.Replace().SetUpsert(true))
+	return err
+}
+
+// ConditionCode returns the machine readable code of a survey type, such as `with_image`
+func ConditionCode(surveyType int) string {
+	if surveyType == SurveyWithImage {
+		return "with_image"
+	}
+	return "no_image"
+}
+
+// ParseCondition accepts a condition code or survey type number
+func ParseCondition(s string) (int, error) {
+	switch s {
+	case "no_image", "0":
+		return SurveyNoImage, nil
+	case "with_image", "1":
+		return SurveyWithImage, nil
+	}
+	return 0, fmt.Errorf("unknown condition `%s`", s)
+}
+
+// AnchorLabel returns the label of a scale point, or the number itself when the point is unlabeled
+func (s Scale) AnchorLabel(value int) string {
+	for _, a := range s.Anchors {
+		if a.Value == value {
+			return a.Label
+		}
+	}
+	return fmt.Sprintf("%d", value)
+}
@@ -0,0 +1,215 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// APITokenPrefix starts every API token so leaked tokens are easy to recognize
+const APITokenPrefix = "carp_"
+
+// DefaultAPITokenTTL is how long tokens stay valid when no expiry is given
+const DefaultAPITokenTTL = 90 * 24 * time.Hour
+
+// Scope is a single capability granted to an API token
+type Scope string
+
+const (
+	// ScopeReadResponses allows reading the study, articles, participants and their ratings
+	ScopeReadResponses Scope = "responses:read"
+	// ScopeManageArticles allows adding, editing and removing articles
+	ScopeManageArticles Scope = "articles:write"
+	// ScopeManageParticipants allows changing participants' conditions
+	ScopeManageParticipants Scope = "participants:write"
+)
+
+// Scopes lists every scope a token can be granted
+var Scopes = []Scope{ScopeReadResponses, ScopeManageArticles, ScopeManageParticipants}
+
+// ErrNoScopes is returned when a token would be created without any scope
+var ErrNoScopes = errors.New("an API token needs at least one scope")
+
+// ParseScopes converts a comma separated list such as `responses:read,articles:write` into scopes
+func ParseScopes(s string) ([]Scope, error) {
+	scopes := make([]Scope, 0)
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		found := false
+		for _, scope := range Scopes {
+			if string(scope) == part {
+				scopes = append(scopes, scope)
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown scope `%s`", part)
+		}
+	}
+	if len(scopes) == 0 {
+		return nil, ErrNoScopes
+	}
+	return scopes, nil
+}
+
+// APIToken grants programmatic access to the JSON API. Only a hash of the token is stored.
+type APIToken struct {
+	ID         primitive.ObjectID  `bson:"_id,omitempty"`
+	Name       string              `bson:"name"`
+	Hash       string              `bson:"hash"`
+	Scopes     []Scope             `bson:"scopes"`
+	CreatedBy  *primitive.ObjectID `bson:"created_by,omitempty"`
+	CreatedOn  time.Time           `bson:"created_on"`
+	ExpiresOn  time.Time           `bson:"expires_on"`
+	LastUsedOn *time.Time          `bson:"last_used_on,omitempty"`
+	RevokedOn  *time.Time          `bson:"revoked_on,omitempty"`
+}
+
+// Active reports whether the token may still be used
+func (t *APIToken) Active(now time.Time) bool {
+	return t.RevokedOn == nil && now.Before(t.ExpiresOn)
+}
+
+// State describes the token as `active`, `expired` or `revoked`
+func (t *APIToken) State(now time.Time) string {
+	if t.RevokedOn != nil {
+		return "revoked"
+	}
+	if !now.Before(t.ExpiresOn) {
+		return "expired"
+	}
+	return "active"
+}
+
+// Has reports whether the token was granted the scope
+func (t *APIToken) Has(scope Scope) bool {
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// APITokenUse records a single authenticated API request
+type APITokenUse struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty"`
+	TokenID    primitive.ObjectID `bson:"token_id"`
+	Method     string             `bson:"method"`
+	Path       string             `bson:"path"`
+	Status     int                `bson:"status"`
+	RemoteAddr string             `bson:"remote_addr,omitempty"`
+	UsedOn     time.Time          `bson:"used_on"`
+}
+
+// CreateAPIToken stores a new token and returns its plain value, which cannot be recovered afterwards. createdBy is
+// nil for tokens issued from the command line.
+func CreateAPIToken(ctx context.Context, db *mongo.Database, name string, scopes []Scope, ttl time.Duration, createdBy *primitive.ObjectID) (string, *APIToken, error) {
+	if len(scopes) == 0 {
+		return "", nil, ErrNoScopes
+	}
+	if ttl <= 0 {
+		ttl = DefaultAPITokenTTL
+	}
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", nil, err
+	}
+	plain := APITokenPrefix + base64.RawURLEncoding.EncodeToString(b)
+	now := time.Now()
+	token := &APIToken{
+		Name:      name,
+		Hash:      HashAPIToken(plain),
+		Scopes:    scopes,
+		CreatedBy: createdBy,
+		CreatedOn: now,
+		ExpiresOn: now.Add(ttl),
+	}
+	coll := db.Collection("api_tokens")
+	_, err := coll.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "hash", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	res, err := coll.InsertOne(ctx, token)
+	if err != nil {
+		return "", nil, err
+	}
+	token.ID = res.InsertedID.(primitive.ObjectID)
+	return plain, token, nil
+}
+
+// FindAPIToken returns the active token matching the plain value, or mongo.ErrNoDocuments
+func FindAPIToken(ctx context.Context, db *mongo.Database, plain string) (*APIToken, error) {
+	if !strings.HasPrefix(plain, APITokenPrefix) {
+		return nil, mongo.ErrNoDocuments
+	}
+	token := APIToken{}
+	if err := db.Collection("api_tokens").FindOne(ctx, bson.M{"hash": HashAPIToken(plain)}).Decode(&token); err != nil {
+		return nil, err
+	}
+	if !token.Active(time.Now()) {
+		return nil, mongo.ErrNoDocuments
+	}
+	return &token, nil
+}
+
+// ListAPITokens returns every token, newest first
+func ListAPITokens(ctx context.Context, db *mongo.Database) ([]APIToken, error) {
+	cur, err := db.Collection("api_tokens").Find(ctx, bson.D{}, options.Find().SetSort(bson.M{"created_on": -1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	tokens := make([]APIToken, 0)
+	if err = cur.All(ctx, &tokens); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// RevokeAPIToken stops a token from being accepted. Revoking an already revoked token is a no-op.
+func RevokeAPIToken(ctx context.Context, db *mongo.Database, id primitive.ObjectID) error {
+	res, err := db.Collection("api_tokens").UpdateOne(ctx,
+		bson.M{"_id": id},
+		bson.M{"$min": bson.M{"revoked_on": time.Now()}},
+	)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// RecordAPITokenUse logs a request made with the token and bumps its last used timestamp
+func RecordAPITokenUse(ctx context.Context, db *mongo.Database, use APITokenUse) error {
+	if _, err := db.Collection("api_tokens").UpdateByID(ctx, use.TokenID, bson.M{"$max": bson.M{"last_used_on": use.UsedOn}}); err != nil {
+		return err
+	}
+	_, err := db.Collection("api_token_usage").InsertOne(ctx, use)
+	return err
+}
+
+// HashAPIToken hashes a plain token for storage and lookup. Tokens are random, so no salt or stretching is needed.
+func HashAPIToken(plain string) string {
+	sum := sha256.Sum256([]byte(plain))
+	return hex.EncodeToString(sum[:])
+}
@@ -10,15 +10,41 @@ import (
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
-// User represents a survey participant who has signed-in with their Google account
+// User represents a survey participant who has signed-in with their Google account. Their email is only kept in the
+// IdentityVault, the user record is identified by a random pseudonym. Devices holds IdentityVault.HashDevice of every
+// device they rated from, so participants sharing a device can be spotted without storing addresses. Excluded
+// participants are left out of exports and analyses, Exclusions holds every decision to exclude or reinstate them.
 type User struct {
-	ID         primitive.ObjectID `bson:"_id,omitempty"`
-	Email      string             `bson:"email"`
-	IsAdmin    bool               `bson:"is_admin,"`
-	SurveyType int                `bson:"survey_type,"`
-	Data       bson.M             `bson:"survey_data"`
-	CreatedOn  time.Time          `bson:"created_on,omitempty"`
-	UpdatedOn  time.Time          `bson:"updated_on,omitempty"`
+	ID          primitive.ObjectID  `bson:"_id,omitempty"`
+	Pseudonym   string              `bson:"pseudonym"`
+	Role        Role                `bson:"role"`
+	SurveyType  int                 `bson:"survey_type,"`
+	Data        bson.M              `bson:"survey_data"`
+	Responses   map[string]Response `bson:"survey_meta,omitempty"`
+	MFA         *MFA                `bson:"mfa,omitempty"`
+	CreatedOn   time.Time           `bson:"created_on,omitempty"`
+	UpdatedOn   time.Time           `bson:"updated_on,omitempty"`
+	StartedOn   *time.Time          `bson:"started_on,omitempty"`
+	CompletedOn *time.Time          `bson:"completed_on,omitempty"`
+	Devices     []string            `bson:"devices,omitempty"`
+	Excluded    bool                `bson:"excluded,omitempty"`
+	Exclusions  []ExclusionEvent    `bson:"exclusions,omitempty"`
+}
+
+// MFA holds a staff user's authenticator app enrollment used for step-up authentication
+type MFA struct {
+	Secret        string    `bson:"secret"`
+	RecoveryCodes []string  `bson:"recovery_codes"`
+	LastStep      int64     `bson:"last_step"`
+	EnrolledOn    time.Time `bson:"enrolled_on"`
+}
+
+// Response holds when and in which position an article was rated, keyed by article ID like the ratings in Data.
+// Ratings submitted before this was recorded have no Response.
+type Response struct {
+	Order   int        `bson:"order"`
+	ShownOn *time.Time `bson:"shown_on,omitempty"`
+	RatedOn *time.Time `bson:"rated_on,omitempty"`
 }
 
 func (u *User) NextArticlePath(ctx context.Context, db *mongo.Database, notIncluding *primitive.ObjectID) (string, error) {
@@ -67,3 +93,38 @@ const (
 	SurveyNoImage   = 0
 	SurveyWithImage = 1
 )
+
+// Rating returns the score given to an article and whether the article has been rated. Scores are stored as
+// whichever integer type the driver decoded them into.
+func (u *User) Rating(articleID string) (int, bool) {
+	switch v := u.Data[articleID].(type) {
+	case int32:
+		return int(v), true
+	case int64:
+		return int(v), true
+	case int:
+		return v, true
+	case float64:
+		return int(v), true
+	}
+	return 0, false
+}
+
+// Status reports how far the user has come through a survey of articleCount articles
+func (u *User) Status(articleCount int) string {
+	if u.CompletedOn != nil || (articleCount > 0 && len(u.Data) >= articleCount) {
+		return StatusCompleted
+	}
+	if len(u.Data) > 0 {
+		return StatusStarted
+	}
+	return StatusNotStarted
+}
+
+// ConditionName describes a survey type for people reading results
+func ConditionName(surveyType int) string {
+	if surveyType == SurveyWithImage {
+		return "With Image"
+	}
+	return "No Image"
+}
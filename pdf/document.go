@@ -0,0 +1,239 @@
+// Package pdf writes simple PDF documents of text and vector shapes using the standard fonts, without any external
+// tools. Positions are given in points from the top left corner of the page.
+package pdf
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"time"
+)
+
+// US Letter page size in points
+const (
+	LetterWidth  = 612.0
+	LetterHeight = 792.0
+)
+
+// Point is a position on a page
+type Point struct {
+	X float64
+	Y float64
+}
+
+// Document is a PDF being put together page by page
+type Document struct {
+	Width   float64
+	Height  float64
+	Title   string
+	Author  string
+	Created time.Time
+	pages   []*Page
+}
+
+// New starts a document whose pages are width by height points
+func New(width float64, height float64) *Document {
+	return &Document{Width: width, Height: height, Created: time.Now()}
+}
+
+// Page is a single page, drawn on in order
+type Page struct {
+	doc     *Document
+	content bytes.Buffer
+}
+
+// AddPage appends an empty page
+func (d *Document) AddPage() *Page {
+	p := &Page{doc: d}
+	d.pages = append(d.pages, p)
+	return p
+}
+
+// Pages returns the pages added so far
+func (d *Document) Pages() []*Page {
+	return d.pages
+}
+
+// Text writes a single line of text with its baseline starting at x, y
+func (p *Page) Text(x float64, y float64, text string, font Font, size float64, color string) {
+	fmt.Fprintf(&p.content, "BT %s rg /F%d %s Tf %s %s Td (", rgb(color), font+1, number(size), number(x), number(p.doc.Height-y))
+	for _, b := range encode(text) {
+		if b == '(' || b == ')' || b == '\\' {
+			p.content.WriteByte('\\')
+		}
+		p.content.WriteByte(b)
+	}
+	p.content.WriteString(") Tj ET\n")
+}
+
+// Line draws a straight line, dashed or solid
+func (p *Page) Line(x1 float64, y1 float64, x2 float64, y2 float64, color string, width float64, dashed bool) {
+	p.Polyline([]Point{{x1, y1}, {x2, y2}}, color, width, dashed)
+}
+
+// Polyline draws connected line segments through points
+func (p *Page) Polyline(points []Point, color string, width float64, dashed bool) {
+	if len(points) < 2 {
+		return
+	}
+	if dashed {
+		p.content.WriteString("[4 3] 0 d ")
+	}
+	fmt.Fprintf(&p.content, "%s RG %s w %s %s m", rgb(color), number(width), number(points[0].X), number(p.doc.Height-points[0].Y))
+	for _, pt := range points[1:] {
+		fmt.Fprintf(&p.content, " %s %s l", number(pt.X), number(p.doc.Height-pt.Y))
+	}
+	p.content.WriteString(" S")
+	if dashed {
+		p.content.WriteString(" [] 0 d")
+	}
+	p.content.WriteString("\n")
+}
+
+// Rect fills a rectangle whose top left corner is at x, y
+func (p *Page) Rect(x float64, y float64, width float64, height float64, fill string) {
+	fmt.Fprintf(&p.content, "%s rg %s %s %s %s re f\n", rgb(fill), number(x), number(p.doc.Height-y-height), number(width), number(height))
+}
+
+// Circle fills a circle, approximated with four Bézier curves
+func (p *Page) Circle(x float64, y float64, radius float64, fill string) {
+	const k = 0.5523
+	cx, cy, r := x, p.doc.Height-y, radius
+	fmt.Fprintf(&p.content, "%s rg %s %s m", rgb(fill), number(cx+r), number(cy))
+	curves := [][6]float64{
+		{cx + r, cy + k*r, cx + k*r, cy + r, cx, cy + r},
+		{cx - k*r, cy + r, cx - r, cy + k*r, cx - r, cy},
+		{cx - r, cy - k*r, cx - k*r, cy - r, cx, cy - r},
+		{cx + k*r, cy - r, cx + r, cy - k*r, cx + r, cy},
+	}
+	for _, c := range curves {
+		fmt.Fprintf(&p.content, " %s %s %s %s %s %s c", number(c[0]), number(c[1]), number(c[2]), number(c[3]), number(c[4]), number(c[5]))
+	}
+	p.content.WriteString(" f\n")
+}
+
+// Write encodes the document
+func (d *Document) Write(w io.Writer) error {
+	out := &countingWriter{w: bufio.NewWriter(w)}
+	var offsets []int64
+	object := func(body func()) {
+		offsets = append(offsets, out.n)
+		fmt.Fprintf(out, "%d 0 obj\n", len(offsets))
+		body()
+		out.WriteString("\nendobj\n")
+	}
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	// Objects 1 to 5 are the catalog, page tree, both fonts and document information, each page is followed by its
+	// content stream
+	pageIDs := make([]string, len(d.pages))
+	for i := range d.pages {
+		pageIDs[i] = fmt.Sprintf("%d 0 R", 6+2*i)
+	}
+	object(func() { out.WriteString("<< /Type /Catalog /Pages 2 0 R >>") })
+	object(func() {
+		fmt.Fprintf(out, "<< /Type /Pages /Count %d /Kids [", len(d.pages))
+		for i, id := range pageIDs {
+			if i > 0 {
+				out.WriteString(" ")
+			}
+			out.WriteString(id)
+		}
+		out.WriteString("] >>")
+	})
+	for _, font := range baseFonts {
+		object(func() {
+			fmt.Fprintf(out, "<< /Type /Font /Subtype /Type1 /BaseFont /%s /Encoding /WinAnsiEncoding >>", font)
+		})
+	}
+	object(func() {
+		fmt.Fprintf(out, "<< /Title %s /Author %s /Producer (carp) /CreationDate (D:%s) >>", literal(d.Title), literal(d.Author),
+			d.Created.UTC().Format("20060102150405Z"))
+	})
+	for i, p := range d.pages {
+		var stream bytes.Buffer
+		z := zlib.NewWriter(&stream)
+		if _, err := z.Write(p.content.Bytes()); err != nil {
+			return err
+		}
+		if err := z.Close(); err != nil {
+			return err
+		}
+		object(func() {
+			fmt.Fprintf(out, "<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %s %s] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+				number(d.Width), number(d.Height), 7+2*i)
+		})
+		object(func() {
+			fmt.Fprintf(out, "<< /Length %d /Filter /FlateDecode >>\nstream\n", stream.Len())
+			out.Write(stream.Bytes())
+			out.WriteString("\nendstream")
+		})
+	}
+
+	xref := out.n
+	fmt.Fprintf(out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(out, "trailer\n<< /Size %d /Root 1 0 R /Info 5 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	if out.err != nil {
+		return out.err
+	}
+	return out.w.Flush()
+}
+
+// countingWriter tracks the byte offset objects start at, for the cross-reference table, and keeps the first error
+type countingWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (c *countingWriter) Write(b []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	n, err := c.w.Write(b)
+	c.n += int64(n)
+	c.err = err
+	return n, err
+}
+
+func (c *countingWriter) WriteString(s string) (int, error) {
+	return c.Write([]byte(s))
+}
+
+// literal encodes text as a PDF string
+func literal(text string) string {
+	var b bytes.Buffer
+	b.WriteByte('(')
+	for _, c := range encode(text) {
+		if c == '(' || c == ')' || c == '\\' {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(c)
+	}
+	b.WriteByte(')')
+	return b.String()
+}
+
+// rgb turns a `#rrggbb` colour into PDF colour components, falling back to black
+func rgb(hex string) string {
+	if len(hex) != 7 || hex[0] != '#' {
+		return "0 0 0"
+	}
+	v, err := strconv.ParseUint(hex[1:], 16, 32)
+	if err != nil {
+		return "0 0 0"
+	}
+	return fmt.Sprintf("%s %s %s", number(float64(v>>16)/255), number(float64(v>>8&0xff)/255), number(float64(v&0xff)/255))
+}
+
+// number prints a coordinate with at most three decimals
+func number(v float64) string {
+	return strconv.FormatFloat(math.Round(v*1000)/1000, 'f', -1, 64)
+}
@@ -0,0 +1,79 @@
+package pdf
+
+// Font is one of the standard fonts every PDF reader provides, so nothing needs to be embedded
+type Font int
+
+// Fonts
+const (
+	Regular Font = iota
+	Bold
+)
+
+var baseFonts = []string{"Helvetica", "Helvetica-Bold"}
+
+// Glyph widths of the printable ASCII characters from space to tilde, in thousandths of the font size, as published
+// in the Adobe font metrics of the standard fonts
+var asciiWidths = [][]int{
+	{
+		278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+		556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+		1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+		667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+		333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+		556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+	},
+	{
+		278, 333, 474, 556, 556, 889, 722, 238, 333, 333, 389, 584, 278, 333, 278, 278,
+		556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 333, 333, 584, 584, 584, 611,
+		975, 722, 722, 722, 722, 667, 611, 778, 722, 278, 556, 722, 611, 833, 722, 778,
+		667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 333, 278, 333, 584, 556,
+		333, 556, 611, 556, 611, 556, 333, 611, 611, 278, 278, 556, 278, 889, 611, 611,
+		611, 611, 389, 556, 333, 611, 556, 778, 556, 556, 500, 389, 280, 389, 584,
+	},
+}
+
+// winAnsi maps the characters outside Latin-1 that the Windows encoding of the standard fonts provides
+var winAnsi = map[rune]byte{
+	'€': 0x80, '‚': 0x82, '„': 0x84, '…': 0x85, '†': 0x86, '‡': 0x87, '‰': 0x89, '‹': 0x8b, '‘': 0x91, '’': 0x92,
+	'“': 0x93, '”': 0x94, '•': 0x95, '–': 0x96, '—': 0x97, '™': 0x99, '›': 0x9b,
+}
+
+// Widths of the characters above ASCII that reports are likely to use, anything else is measured like a digit
+var extraWidths = map[byte]int{0x85: 1000, 0x91: 222, 0x92: 222, 0x93: 333, 0x94: 333, 0x95: 350, 0x96: 556, 0x97: 1000, 0xb1: 584, 0xd7: 584}
+
+// encode converts text to the fonts' Windows encoding. Minus signs become hyphens and primes apostrophes, other
+// characters the fonts cannot show become question marks.
+func encode(text string) []byte {
+	out := make([]byte, 0, len(text))
+	for _, r := range text {
+		switch {
+		case r == '−':
+			out = append(out, '-')
+		case r == '′':
+			out = append(out, '\'')
+		case r < 0x80 || (r >= 0xa0 && r <= 0xff):
+			out = append(out, byte(r))
+		case winAnsi[r] != 0:
+			out = append(out, winAnsi[r])
+		default:
+			out = append(out, '?')
+		}
+	}
+	return out
+}
+
+// TextWidth measures text set in font at size points
+func TextWidth(text string, font Font, size float64) float64 {
+	total := 0
+	for _, b := range encode(text) {
+		switch {
+		case b >= 32 && b <= 126:
+			total += asciiWidths[font][b-32]
+		case extraWidths[b] != 0:
+			total += extraWidths[b]
+		default:
+			total += 556
+		}
+	}
+	return float64(total) * size / 1000
+}
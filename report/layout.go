@@ -0,0 +1,272 @@
+package report
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/superc03/carp/chart"
+	"github.com/superc03/carp/pdf"
+)
+
+// Page geometry and type sizes, in points
+const (
+	margin     = 54.0
+	footerGap  = 24.0
+	bodySize   = 10.0
+	tableSize  = 9.0
+	lineHeight = 14.0
+	rowHeight  = 15.0
+)
+
+// layout flows text, tables and charts down the pages of a document, starting a new page whenever the next block
+// does not fit
+type layout struct {
+	doc  *pdf.Document
+	page *pdf.Page
+	y    float64
+}
+
+func newLayout(title string) *layout {
+	l := &layout{doc: pdf.New(pdf.LetterWidth, pdf.LetterHeight)}
+	l.doc.Title = title
+	l.newPage()
+	return l
+}
+
+func (l *layout) width() float64 {
+	return l.doc.Width - 2*margin
+}
+
+func (l *layout) bottom() float64 {
+	return l.doc.Height - margin - footerGap
+}
+
+func (l *layout) newPage() {
+	l.page = l.doc.AddPage()
+	l.y = margin
+}
+
+// ensure starts a new page unless height more points fit on this one
+func (l *layout) ensure(height float64) {
+	if l.y+height > l.bottom() && l.y > margin {
+		l.newPage()
+	}
+}
+
+// title writes the report's title with a line of details below it
+func (l *layout) title(text string, subtitle string) {
+	for _, line := range wrap(text, pdf.Bold, 20, l.width()) {
+		l.y += 24
+		l.page.Text(margin, l.y, line, pdf.Bold, 20, chart.ColorText)
+	}
+	l.y += 18
+	l.page.Text(margin, l.y, subtitle, pdf.Regular, bodySize, chart.ColorMuted)
+	l.y += 10
+	l.page.Line(margin, l.y, margin+l.width(), l.y, chart.ColorGrid, 1, false)
+	l.y += 6
+}
+
+// heading starts a section, keeping it on the same page as the first lines below it
+func (l *layout) heading(text string) {
+	l.ensure(70)
+	if l.y > margin {
+		l.y += 16
+	}
+	l.y += 16
+	l.page.Text(margin, l.y, text, pdf.Bold, 14, chart.ColorText)
+	l.y += 6
+}
+
+// subheading introduces a table or chart within a section
+func (l *layout) subheading(text string) {
+	l.ensure(50)
+	l.y += 18
+	l.page.Text(margin, l.y, text, pdf.Bold, 11, chart.ColorText)
+	l.y += 2
+}
+
+// paragraph wraps text to the page width, keeping the line breaks it already has
+func (l *layout) paragraph(text string, color string) {
+	l.y += 4
+	for _, block := range strings.Split(strings.TrimSpace(text), "\n") {
+		for _, line := range wrap(block, pdf.Regular, bodySize, l.width()) {
+			l.ensure(lineHeight)
+			l.y += lineHeight
+			l.page.Text(margin, l.y, line, pdf.Regular, bodySize, color)
+		}
+	}
+}
+
+// field writes a bold label followed by its value
+func (l *layout) field(label string, value string) {
+	l.ensure(lineHeight)
+	l.y += lineHeight
+	l.page.Text(margin, l.y, label, pdf.Bold, bodySize, chart.ColorText)
+	indent := 110.0
+	lines := wrap(value, pdf.Regular, bodySize, l.width()-indent)
+	for i, line := range lines {
+		if i > 0 {
+			l.ensure(lineHeight)
+			l.y += lineHeight
+		}
+		l.page.Text(margin+indent, l.y, line, pdf.Regular, bodySize, chart.ColorText)
+	}
+}
+
+// column is a table column. A Width of zero takes whatever the other columns leave, numbers are aligned right.
+type column struct {
+	Title string
+	Width float64
+	Right bool
+}
+
+// table draws rows of cells below a header, repeating the header when the table continues on a new page. Cells too
+// wide for their column are shortened, the last `totals` rows are set apart in bold.
+func (l *layout) table(columns []column, rows [][]string, totals int) {
+	widths := make([]float64, len(columns))
+	fixed := 0.0
+	for _, c := range columns {
+		fixed += c.Width
+	}
+	for i, c := range columns {
+		widths[i] = c.Width
+		if c.Width == 0 {
+			widths[i] = l.width() - fixed
+		}
+	}
+	row := func(cells []string, font pdf.Font, color string) {
+		x := margin
+		for i, cell := range cells {
+			cell = truncate(cell, font, tableSize, widths[i]-6)
+			if columns[i].Right {
+				l.page.Text(x+widths[i]-pdf.TextWidth(cell, font, tableSize), l.y, cell, font, tableSize, color)
+			} else {
+				l.page.Text(x, l.y, cell, font, tableSize, color)
+			}
+			x += widths[i]
+		}
+	}
+	header := func() {
+		titles := make([]string, len(columns))
+		for i, c := range columns {
+			titles[i] = c.Title
+		}
+		l.y += rowHeight
+		row(titles, pdf.Bold, chart.ColorMuted)
+		l.y += 5
+		l.page.Line(margin, l.y, margin+l.width(), l.y, chart.ColorAxis, 0.75, false)
+	}
+	l.y += 4
+	l.ensure(rowHeight*2 + 5)
+	header()
+	for i, cells := range rows {
+		if l.y+rowHeight > l.bottom() {
+			l.newPage()
+			header()
+		}
+		font := pdf.Regular
+		if i == len(rows)-totals {
+			l.y += 4
+			l.page.Line(margin, l.y, margin+l.width(), l.y, chart.ColorGrid, 0.75, false)
+		}
+		if i >= len(rows)-totals {
+			font = pdf.Bold
+		}
+		l.y += rowHeight
+		row(cells, font, chart.ColorText)
+	}
+	l.y += 5
+	l.page.Line(margin, l.y, margin+l.width(), l.y, chart.ColorAxis, 0.75, false)
+}
+
+// chart draws a chart across the page width, shrinking it when it is taller than a page
+func (l *layout) chart(c *chart.Canvas) {
+	scale := math.Min(l.width()/c.Width, (l.bottom()-margin-12)/c.Height)
+	l.ensure(c.Height*scale + 12)
+	l.y += 12
+	left := margin + (l.width()-c.Width*scale)/2
+	top := l.y
+	at := func(p chart.Point) (float64, float64) {
+		return left + p.X*scale, top + p.Y*scale
+	}
+	for _, e := range c.Elements {
+		switch e.Kind {
+		case chart.KindLine, chart.KindPolyline:
+			points := make([]pdf.Point, len(e.Points))
+			for i, p := range e.Points {
+				points[i].X, points[i].Y = at(p)
+			}
+			l.page.Polyline(points, e.Stroke, e.StrokeWidth*scale, e.Dashed)
+		case chart.KindRect:
+			x, y := at(e.Points[0])
+			l.page.Rect(x, y, e.Width*scale, e.Height*scale, e.Fill)
+		case chart.KindCircle:
+			x, y := at(e.Points[0])
+			l.page.Circle(x, y, e.Radius*scale, e.Fill)
+		case chart.KindText:
+			font := pdf.Regular
+			if e.Bold {
+				font = pdf.Bold
+			}
+			x, y := at(e.Points[0])
+			size := e.Size * scale
+			switch e.Anchor {
+			case chart.AnchorMiddle:
+				x -= pdf.TextWidth(e.Text, font, size) / 2
+			case chart.AnchorEnd:
+				x -= pdf.TextWidth(e.Text, font, size)
+			}
+			l.page.Text(x, y, e.Text, font, size, e.Fill)
+		}
+	}
+	l.y += c.Height * scale
+}
+
+// footers numbers every page once the document is complete
+func (l *layout) footers(label string) {
+	pages := l.doc.Pages()
+	y := l.doc.Height - margin/2
+	for i, p := range pages {
+		p.Text(margin, y, truncate(label, pdf.Regular, 8, l.width()-80), pdf.Regular, 8, chart.ColorMuted)
+		number := fmt.Sprintf("Page %d of %d", i+1, len(pages))
+		p.Text(margin+l.width()-pdf.TextWidth(number, pdf.Regular, 8), y, number, pdf.Regular, 8, chart.ColorMuted)
+	}
+}
+
+// wrap breaks text into lines no wider than width, splitting only between words
+func wrap(text string, font pdf.Font, size float64, width float64) []string {
+	lines := make([]string, 0, 1)
+	line := ""
+	for _, word := range strings.Fields(text) {
+		next := word
+		if line != "" {
+			next = line + " " + word
+		}
+		if line != "" && pdf.TextWidth(next, font, size) > width {
+			lines = append(lines, line)
+			next = word
+		}
+		line = next
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// truncate shortens text with an ellipsis so it fits within width
+func truncate(text string, font pdf.Font, size float64, width float64) string {
+	if pdf.TextWidth(text, font, size) <= width {
+		return text
+	}
+	runes := []rune(text)
+	for len(runes) > 0 {
+		runes = runes[:len(runes)-1]
+		shortened := strings.TrimSpace(string(runes)) + "…"
+		if pdf.TextWidth(shortened, font, size) <= width {
+			return shortened
+		}
+	}
+	return "…"
+}
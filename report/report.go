@@ -0,0 +1,339 @@
+// Package report lays out a printable study report for a research panel as PDF: the study description, sample sizes,
+// exclusions, descriptive statistics, the main tests and the charts, all from the stored responses
+package report
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/superc03/carp/analysis"
+	"github.com/superc03/carp/chart"
+	"github.com/superc03/carp/models"
+)
+
+// Write lays out the report of a dataset loaded with its excluded participants. Excluded participants are only
+// counted, the descriptives, tests and charts cover everyone else, with headline p-values adjusted by correction and
+// bootstrap intervals drawn from seed. enrollment is the study's sign-ins per day.
+func Write(w io.Writer, d *models.Dataset, correction analysis.Correction, seed int64, enrollment []models.DayCount) error {
+	included := *d
+	included.Filter.IncludeExcluded = false
+	included.Participants = make([]models.User, 0, len(d.Participants))
+	for _, u := range d.Participants {
+		if !u.Excluded {
+			included.Participants = append(included.Participants, u)
+		}
+	}
+	results, err := analysis.Analyze(&included, correction)
+	if err != nil {
+		return err
+	}
+	results.Bootstrap(seed)
+
+	generated := d.ExportedOn.Format("January 2, 2006 at 15:04")
+	l := newLayout(d.Study.Title)
+	l.title(d.Study.Title, "Study report generated "+generated)
+	writeStudy(l, &included, results)
+	writeSample(l, d)
+	writeExclusions(l, d)
+	writeDescriptives(l, results)
+	writeTests(l, results, seed)
+	l.heading("Charts")
+	l.chart(chart.RatingDistribution(&included))
+	l.chart(chart.ForestPlot(results))
+	l.chart(chart.Enrollment(enrollment))
+	l.footers(d.Study.Title + " · generated " + generated)
+	return l.doc.Write(w)
+}
+
+func writeStudy(l *layout, d *models.Dataset, r *analysis.Report) {
+	l.heading("Study description")
+	if d.Study.Investigator != "" {
+		l.field("Investigator", d.Study.Investigator)
+	}
+	filter := r.Filter
+	if filter == "" {
+		filter = "all participants"
+	}
+	l.field("Participants", filter)
+	scale := d.Study.Scale
+	l.field("Measure", fmt.Sprintf("%s, rated from %s to %s", d.Study.Dimension, scalePoint(scale, scale.Min), scalePoint(scale, scale.Max)))
+	conditions := make([]string, len(d.Study.Conditions))
+	for i, c := range d.Study.Conditions {
+		conditions[i] = c.Name
+		switch c.SurveyType {
+		case r.Reference.SurveyType:
+			conditions[i] += " (reference)"
+		case r.Treatment.SurveyType:
+			conditions[i] += " (treatment)"
+		}
+	}
+	l.field("Conditions", strings.Join(conditions, ", "))
+	headlines := plural(len(d.Articles), "headline")
+	if analysis.HasVeracity(d) {
+		veracity := map[models.Veracity]int{}
+		for _, a := range d.Articles {
+			veracity[a.Veracity]++
+		}
+		headlines += fmt.Sprintf(", %d true and %d false", veracity[models.VeracityTrue], veracity[models.VeracityFalse])
+	}
+	if len(d.Checks) > 0 {
+		headlines += ", plus " + plural(len(d.Checks), "attention check")
+	}
+	l.field("Materials", headlines)
+	if strings.TrimSpace(d.Study.Description) != "" {
+		l.paragraph(d.Study.Description, chart.ColorText)
+	}
+}
+
+func writeSample(l *layout, d *models.Dataset) {
+	l.heading("Sample")
+	l.paragraph("Everyone who signed in, by condition. Excluded participants are left out of every analysis below, "+
+		"the completion counts are of the analysed participants.", chart.ColorMuted)
+	articleCount := d.SurveyLength()
+	rows := make([][]string, 0, len(d.Study.Conditions)+1)
+	total := make([]int, 6)
+	for _, c := range d.Study.Conditions {
+		counts := make([]int, 6)
+		for _, u := range d.Participants {
+			if u.SurveyType != c.SurveyType {
+				continue
+			}
+			counts[0]++
+			if u.Excluded {
+				counts[1]++
+				continue
+			}
+			counts[2]++
+			switch u.Status(articleCount) {
+			case models.StatusCompleted:
+				counts[3]++
+			case models.StatusStarted:
+				counts[4]++
+			default:
+				counts[5]++
+			}
+		}
+		rows = append(rows, countRow(c.Name, counts))
+		for i := range counts {
+			total[i] += counts[i]
+		}
+	}
+	rows = append(rows, countRow("Total", total))
+	l.table([]column{{Title: "Condition"}, {"Signed in", 62, true}, {"Excluded", 62, true}, {"Analysed", 62, true},
+		{"Completed", 62, true}, {"Partial", 62, true}, {"Not started", 62, true}}, rows, 1)
+}
+
+func writeExclusions(l *layout, d *models.Dataset) {
+	l.heading("Exclusions")
+	counts := map[models.ExclusionReason][]int{}
+	excluded := 0
+	for _, u := range d.Participants {
+		if !u.Excluded {
+			continue
+		}
+		excluded++
+		reason := models.ExclusionReason(u.ExclusionCode())
+		if counts[reason] == nil {
+			counts[reason] = make([]int, len(d.Study.Conditions)+1)
+		}
+		for i, c := range d.Study.Conditions {
+			if u.SurveyType == c.SurveyType {
+				counts[reason][i]++
+			}
+		}
+		counts[reason][len(d.Study.Conditions)]++
+	}
+	if excluded == 0 {
+		l.paragraph("No participants were excluded.", chart.ColorText)
+		return
+	}
+	l.paragraph(fmt.Sprintf("%s excluded, by the reason recorded when they were.", plural(excluded, "participant was",
+		"participants were")), chart.ColorMuted)
+	columns := []column{{Title: "Reason"}}
+	for _, c := range d.Study.Conditions {
+		columns = append(columns, column{c.Name, 90, true})
+	}
+	columns = append(columns, column{"Total", 60, true})
+	rows := make([][]string, 0, len(counts)+1)
+	total := make([]int, len(d.Study.Conditions)+1)
+	// Participants excluded before reasons were recorded have none
+	reasons := append(append([]models.ExclusionReason{}, models.ExclusionReasons...), "")
+	for _, reason := range reasons {
+		if counts[reason] == nil {
+			continue
+		}
+		label := "Not recorded"
+		if reason != "" {
+			label = strings.ToUpper(string(reason[:1])) + strings.ReplaceAll(string(reason[1:]), "_", " ")
+		}
+		rows = append(rows, countRow(label, counts[reason]))
+		for i, n := range counts[reason] {
+			total[i] += n
+		}
+	}
+	rows = append(rows, countRow("Total", total))
+	l.table(columns, rows, 1)
+}
+
+func writeDescriptives(l *layout, r *analysis.Report) {
+	l.heading("Descriptive statistics")
+	l.subheading("All headlines")
+	l.paragraph("Each participant's mean rating over the headlines they rated.", chart.ColorMuted)
+	rows := make([][]string, len(r.Overall.Groups))
+	for i, g := range r.Overall.Groups {
+		rows[i] = []string{conditionName(r, i), strconv.Itoa(g.N), number(g.Mean), number(g.SD), number(g.Median)}
+	}
+	l.table([]column{{Title: "Condition"}, {"n", 60, true}, {"Mean", 70, true}, {"SD", 70, true}, {"Median", 70, true}}, rows, 0)
+
+	l.subheading("Per headline")
+	rows = make([][]string, len(r.Articles))
+	for i, a := range r.Articles {
+		rows[i] = []string{a.Title}
+		for _, g := range a.Groups {
+			rows[i] = append(rows[i], strconv.Itoa(g.N), meanSD(g))
+		}
+	}
+	l.table([]column{{Title: "Headline"}, {"n", 36, true}, {r.Reference.Name + " M (SD)", 110, true}, {"n", 36, true},
+		{r.Treatment.Name + " M (SD)", 110, true}}, rows, 0)
+}
+
+func writeTests(l *layout, r *analysis.Report, seed int64) {
+	l.heading("Main tests")
+	confidence := int(math.Round(r.Confidence * 100))
+	if t := r.Overall.Welch; t != nil {
+		summary := fmt.Sprintf("Over all headlines, participants in the %s condition rated headlines %s points %s on average than "+
+			"those in the %s condition, %d%% CI [%s, %s], Welch's t(%.1f) = %s, p %s.", r.Treatment.Name, number(math.Abs(t.Difference)),
+			direction(t.Difference), r.Reference.Name, confidence, number(t.CILow), number(t.CIHigh), t.DF, number(t.T), pEquals(t.P))
+		if e := r.Overall.Effect; e != nil {
+			summary += fmt.Sprintf(" Hedges' g = %s, %d%% CI [%s, %s].", number(e.HedgesG), confidence, number(e.GLow), number(e.GHigh))
+		}
+		if u := r.Overall.MannWhitney; u != nil {
+			summary += fmt.Sprintf(" A Mann-Whitney test agrees at p %s.", pEquals(u.P))
+		}
+		if b := r.Overall.Bootstrap; b != nil {
+			summary += fmt.Sprintf(" The bootstrap BCa interval of the difference is [%s, %s] from %d resamples with seed %d.",
+				number(b.BCaLow), number(b.BCaHigh), r.Resamples, seed)
+		}
+		l.paragraph(summary, chart.ColorText)
+	} else {
+		l.paragraph("There are not yet enough participants in both conditions to compare them.", chart.ColorText)
+	}
+	l.paragraph(fmt.Sprintf("Differences are %s minus %s in scale points. The headline p-values form one family adjusted "+
+		"with the %s correction, g is Hedges' g and U the Mann-Whitney test.", r.Treatment.Name, r.Reference.Name,
+		r.Correction.Name()), chart.ColorMuted)
+
+	columns := []column{{Title: "Comparison"}, {fmt.Sprintf("Difference [%d%% CI]", confidence), 96, true}, {"t (df)", 60, true},
+		{"p", 36, true}, {"p adj.", 38, true}, {"g [CI]", 92, true}, {"U p", 36, true}}
+	l.subheading("Overall")
+	l.table(columns, [][]string{testRow(r.Overall, false)}, 0)
+	l.subheading("Per headline")
+	rows := make([][]string, len(r.Articles))
+	for i, a := range r.Articles {
+		rows[i] = testRow(a, true)
+	}
+	l.table(columns, rows, 0)
+	if len(r.Discernment) > 0 {
+		l.subheading("Discernment")
+		l.paragraph("How well participants told true headlines from false ones, compared between the conditions.", chart.ColorMuted)
+		rows = make([][]string, len(r.Discernment))
+		for i, c := range r.Discernment {
+			rows[i] = testRow(c, false)
+		}
+		l.table(columns, rows, 0)
+	}
+}
+
+// testRow summarises a comparison's tests, with an adjusted p-value only when it belongs to the adjusted family
+func testRow(c analysis.Comparison, adjusted bool) []string {
+	row := []string{c.Title, "—", "—", "—", "—", "—", "—"}
+	if t := c.Welch; t != nil {
+		row[1] = fmt.Sprintf("%s [%s, %s]", number(t.Difference), number(t.CILow), number(t.CIHigh))
+		row[2] = fmt.Sprintf("%s (%.1f)", number(t.T), t.DF)
+		row[3] = pValue(t.P)
+		if adjusted {
+			row[4] = pValue(t.AdjustedP)
+		}
+	}
+	if e := c.Effect; e != nil {
+		row[5] = fmt.Sprintf("%s [%s, %s]", number(e.HedgesG), number(e.GLow), number(e.GHigh))
+	}
+	if u := c.MannWhitney; u != nil {
+		row[6] = pValue(u.P)
+	}
+	return row
+}
+
+// scalePoint names a point of the scale by its number and label, unless the label already includes the number
+func scalePoint(s models.Scale, value int) string {
+	label := s.AnchorLabel(value)
+	if strings.Contains(label, strconv.Itoa(value)) {
+		return label
+	}
+	return fmt.Sprintf("%d (%s)", value, label)
+}
+
+func countRow(label string, counts []int) []string {
+	row := []string{label}
+	for _, n := range counts {
+		row = append(row, strconv.Itoa(n))
+	}
+	return row
+}
+
+func conditionName(r *analysis.Report, group int) string {
+	if group == 0 {
+		return r.Reference.Name
+	}
+	return r.Treatment.Name
+}
+
+func meanSD(g analysis.Descriptives) string {
+	if g.N == 0 {
+		return "—"
+	}
+	return fmt.Sprintf("%s (%s)", number(g.Mean), number(g.SD))
+}
+
+func direction(difference float64) string {
+	if difference < 0 {
+		return "lower"
+	}
+	return "higher"
+}
+
+// plural counts things, with an explicit plural form when adding an s is wrong
+func plural(n int, singular string, forms ...string) string {
+	if n == 1 {
+		return "1 " + singular
+	}
+	if len(forms) > 0 {
+		return strconv.Itoa(n) + " " + forms[0]
+	}
+	return strconv.Itoa(n) + " " + singular + "s"
+}
+
+// number prints a statistic with two decimals, without a minus sign when it rounds to zero
+func number(v float64) string {
+	if math.Abs(v) < 0.005 {
+		v = 0
+	}
+	return fmt.Sprintf("%.2f", v)
+}
+
+// pValue prints tiny p-values as a bound rather than rounding them to zero
+func pValue(p float64) string {
+	if p < 0.001 {
+		return "< .001"
+	}
+	return fmt.Sprintf("%.3f", p)
+}
+
+func pEquals(p float64) string {
+	if p < 0.001 {
+		return "< .001"
+	}
+	return "= " + pValue(p)
+}
@@ -0,0 +1,66 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+
+	"github.com/gorilla/sessions"
+)
+
+const (
+	// CSRFFormField is the hidden form field carrying the CSRF token
+	CSRFFormField = "csrf_token"
+	// CSRFHeader may carry the CSRF token instead of the form field, for scripted requests
+	CSRFHeader = "X-CSRF-Token"
+
+	csrfSessionKey = "csrf"
+)
+
+// RandomToken returns n bytes from the system's secure random source, encoded for use in URLs and forms.
+func RandomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// CSRFToken returns the CSRF token of the current session, creating and saving one if the session has none yet.
+// Pages rendering a form pass the result to their template as the `csrf_token` hidden field.
+func CSRFToken(r *http.Request, w http.ResponseWriter, sess sessions.Store) (string, error) {
+	session, err := sess.Get(r, "carp")
+	if err != nil {
+		return "", err
+	}
+	if token, ok := session.Values[csrfSessionKey].(string); ok && token != "" {
+		return token, nil
+	}
+	token, err := RandomToken(32)
+	if err != nil {
+		return "", err
+	}
+	session.Values[csrfSessionKey] = token
+	if err = session.Save(r, w); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// ValidCSRFToken reports whether the request carries the CSRF token of its session.
+func ValidCSRFToken(r *http.Request, sess sessions.Store) bool {
+	session, err := sess.Get(r, "carp")
+	if err != nil {
+		return false
+	}
+	expected, ok := session.Values[csrfSessionKey].(string)
+	if !ok || expected == "" {
+		return false
+	}
+	given := r.Header.Get(CSRFHeader)
+	if given == "" {
+		given = r.PostFormValue(CSRFFormField)
+	}
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(given)) == 1
+}
@@ -0,0 +1,32 @@
+package utils
+
+import (
+	"net/http"
+	"time"
+)
+
+// deviceCookie names the cookie identifying a browser across sign ins
+const deviceCookie = "carp_device"
+
+// DeviceToken returns the random token identifying the browser a request came from, issuing one that lasts a year when
+// the browser has none. Unlike the session it survives signing out, so two accounts answering from one browser share
+// it, while classmates behind one network on identical computers do not.
+func DeviceToken(w http.ResponseWriter, r *http.Request) (string, error) {
+	if c, err := r.Cookie(deviceCookie); err == nil && len(c.Value) >= 16 {
+		return c.Value, nil
+	}
+	token, err := RandomToken(16)
+	if err != nil {
+		return "", err
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     deviceCookie,
+		Value:    token,
+		Path:     "/",
+		MaxAge:   int((365 * 24 * time.Hour).Seconds()),
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return token, nil
+}
@@ -0,0 +1,134 @@
+package utils
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+// Event types pushed to the live dashboard
+const (
+	EventRating     = "rating"
+	EventCompletion = "completion"
+)
+
+// Event is a participant action shown live on the dashboard. It deliberately carries no participant identifier.
+type Event struct {
+	Type       string    `bson:"type" json:"type"`
+	SurveyType int       `bson:"survey_type" json:"survey_type"`
+	ArticleID  string    `bson:"article_id,omitempty" json:"article_id,omitempty"`
+	First      bool      `bson:"first,omitempty" json:"first,omitempty"`
+	At         time.Time `bson:"at" json:"at"`
+}
+
+// Broadcaster fans events out to every connected dashboard. With a Mongo collection attached, events are written
+// there instead and every instance relays them from a change stream, so dashboards see activity from all instances.
+type Broadcaster struct {
+	l    *zap.Logger
+	mu   sync.Mutex
+	subs map[chan Event]struct{}
+	coll *mongo.Collection
+}
+
+// NewBroadcaster creates an in-process broadcaster.
+func NewBroadcaster(l *zap.Logger) *Broadcaster {
+	return &Broadcaster{l: l, subs: make(map[chan Event]struct{})}
+}
+
+// NewMongoBroadcaster creates a broadcaster relaying through the `events` collection, which requires a replica set.
+// Events are kept for an hour so a briefly disconnected watcher can resume.
+func NewMongoBroadcaster(ctx context.Context, l *zap.Logger, db *mongo.Database) (*Broadcaster, error) {
+	coll := db.Collection("events")
+	_, err := coll.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(3600),
+	})
+	if err != nil {
+		return nil, err
+	}
+	b := NewBroadcaster(l)
+	b.coll = coll
+	return b, nil
+}
+
+// Subscribe registers a listener. The returned function must be called to unsubscribe.
+func (b *Broadcaster) Subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, 32)
+	b.mu.Lock()
+	b.subs[ch] = struct{}{}
+	b.mu.Unlock()
+	return ch, func() {
+		b.mu.Lock()
+		delete(b.subs, ch)
+		b.mu.Unlock()
+	}
+}
+
+// Emit publishes an event from the submission path. Failing to publish never fails the participant's request.
+func (b *Broadcaster) Emit(ctx context.Context, e Event) {
+	e.At = time.Now()
+	if b.coll == nil {
+		b.publish(e)
+		return
+	}
+	if _, err := b.coll.InsertOne(ctx, e); err != nil {
+		b.l.Warn("Unable to publish live event", zap.Error(err))
+	}
+}
+
+// Watch relays events inserted by any instance to local subscribers until ctx is cancelled. It is a no-op for
+// in-process broadcasters.
+func (b *Broadcaster) Watch(ctx context.Context) {
+	if b.coll == nil {
+		return
+	}
+	pipeline := mongo.Pipeline{bson.D{{Key: "$match", Value: bson.M{"operationType": "insert"}}}}
+	var resumeToken bson.Raw
+	for ctx.Err() == nil {
+		opts := options.ChangeStream()
+		if resumeToken != nil {
+			opts.SetResumeAfter(resumeToken)
+		}
+		stream, err := b.coll.Watch(ctx, pipeline, opts)
+		if err != nil {
+			b.l.Warn("Unable to watch live events, retrying", zap.Error(err))
+			select {
+			case <-ctx.Done():
+			case <-time.After(5 * time.Second):
+			}
+			continue
+		}
+		for stream.Next(ctx) {
+			var change struct {
+				FullDocument Event `bson:"fullDocument"`
+			}
+			if err := stream.Decode(&change); err != nil {
+				b.l.Warn("Unable to decode live event", zap.Error(err))
+				continue
+			}
+			resumeToken = stream.ResumeToken()
+			b.publish(change.FullDocument)
+		}
+		if err := stream.Err(); err != nil && ctx.Err() == nil {
+			b.l.Warn("Live event stream interrupted, resuming", zap.Error(err))
+		}
+		stream.Close(context.Background())
+	}
+}
+
+// publish hands the event to every subscriber, dropping it for subscribers too slow to keep up
+func (b *Broadcaster) publish(e Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subs {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
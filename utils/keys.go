@@ -0,0 +1,78 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"strings"
+)
+
+const (
+	// MinSecretLength is the shortest secret accepted for session signing or encryption
+	MinSecretLength = 32
+	// minDistinctSecretChars guards against secrets like `aaaa...` or `abababab...`
+	minDistinctSecretChars = 12
+)
+
+var placeholderSecrets = []string{"changeme", "secret", "password", "example", "sessionkey", "carp"}
+
+// ValidateSecret rejects secrets which are too short, too repetitive or obviously placeholders.
+func ValidateSecret(name string, secret string) error {
+	if len(secret) < MinSecretLength {
+		return fmt.Errorf("`%s` must be at least %d characters long", name, MinSecretLength)
+	}
+	distinct := make(map[rune]struct{})
+	for _, c := range secret {
+		distinct[c] = struct{}{}
+	}
+	if len(distinct) < minDistinctSecretChars {
+		return fmt.Errorf("`%s` is too repetitive, generate it with `openssl rand -base64 48`", name)
+	}
+	lower := strings.ToLower(secret)
+	for _, p := range placeholderSecrets {
+		if strings.Count(lower, p)*len(p) > len(secret)/2 {
+			return fmt.Errorf("`%s` looks like a placeholder value", name)
+		}
+	}
+	return nil
+}
+
+// SessionKeyPairs validates the current and previous session secrets and returns them as securecookie key pairs.
+// The current pair comes first so new cookies are always issued with it, while cookies issued with the previous
+// pair keep decoding until it is removed from the environment. Encryption keys are stretched to AES-256 keys.
+func SessionKeyPairs(hashKey, encryptionKey, previousHashKey, previousEncryptionKey string) ([][]byte, error) {
+	if err := ValidateSecret("SESSION_KEY", hashKey); err != nil {
+		return nil, err
+	}
+	if err := ValidateSecret("SESSION_ENCRYPTION_KEY", encryptionKey); err != nil {
+		return nil, err
+	}
+	if hashKey == encryptionKey {
+		return nil, fmt.Errorf("`SESSION_KEY` and `SESSION_ENCRYPTION_KEY` must differ")
+	}
+	pairs := [][]byte{[]byte(hashKey), aesKey(encryptionKey)}
+	if previousHashKey == "" {
+		if previousEncryptionKey != "" {
+			return nil, fmt.Errorf("`SESSION_ENCRYPTION_KEY_PREVIOUS` requires `SESSION_KEY_PREVIOUS`")
+		}
+		return pairs, nil
+	}
+	if err := ValidateSecret("SESSION_KEY_PREVIOUS", previousHashKey); err != nil {
+		return nil, err
+	}
+	if previousHashKey == hashKey {
+		return nil, fmt.Errorf("`SESSION_KEY_PREVIOUS` must differ from `SESSION_KEY`")
+	}
+	if previousEncryptionKey == "" {
+		// Cookies signed before encryption was enabled
+		return append(pairs, []byte(previousHashKey), nil), nil
+	}
+	if err := ValidateSecret("SESSION_ENCRYPTION_KEY_PREVIOUS", previousEncryptionKey); err != nil {
+		return nil, err
+	}
+	return append(pairs, []byte(previousHashKey), aesKey(previousEncryptionKey)), nil
+}
+
+func aesKey(secret string) []byte {
+	sum := sha256.Sum256([]byte(secret))
+	return sum[:]
+}
@@ -2,14 +2,28 @@ package utils
 
 import (
 	"context"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
-func SubmitRating(ctx context.Context, db *mongo.Database, userID primitive.ObjectID, articleID primitive.ObjectID, score int) error {
-	_, err := db.Collection("users").UpdateByID(ctx, userID, bson.M{"$set": bson.M{"survey_data." + articleID.Hex(): score}})
+// SubmitRating stores a score along with when it was given. order is the position of the article in the
+// participant's survey, a resubmitted rating keeps the position it was first given in.
+func SubmitRating(ctx context.Context, db *mongo.Database, userID primitive.ObjectID, articleID primitive.ObjectID, score int, order int) error {
+	now := time.Now()
+	_, err := db.Collection("users").UpdateByID(ctx, userID, bson.M{
+		"$set": bson.M{
+			"survey_data." + articleID.Hex():               score,
+			"survey_meta." + articleID.Hex() + ".rated_on": now,
+			"updated_on": now,
+		},
+		"$min": bson.M{
+			"survey_meta." + articleID.Hex() + ".order": order,
+			"started_on": now,
+		},
+	})
 	if err != nil {
 		return err
 	}
@@ -18,3 +32,42 @@ func SubmitRating(ctx context.Context, db *mongo.Database, userID primitive.Obje
 	// }
 	return nil
 }
+
+// ShowArticle records when an article was first shown to a participant
+func ShowArticle(ctx context.Context, db *mongo.Database, userID primitive.ObjectID, articleID primitive.ObjectID) error {
+	_, err := db.Collection("users").UpdateByID(ctx, userID, bson.M{
+		"$min": bson.M{"survey_meta." + articleID.Hex() + ".shown_on": time.Now()},
+	})
+	return err
+}
+
+// CompleteSurvey stamps the completion time on a user who has rated every article. It reports whether this call
+// completed the survey, so completions are only counted once.
+func CompleteSurvey(ctx context.Context, db *mongo.Database, userID primitive.ObjectID) (bool, error) {
+	var user struct {
+		Data bson.M `bson:"survey_data"`
+	}
+	if err := db.Collection("users").FindOne(ctx, bson.M{"_id": userID}).Decode(&user); err != nil {
+		return false, err
+	}
+	articleCount, err := db.Collection("articles").CountDocuments(ctx, bson.D{})
+	if err != nil {
+		return false, err
+	}
+	if int64(len(user.Data)) < articleCount {
+		return false, nil
+	}
+	res, err := db.Collection("users").UpdateOne(ctx,
+		bson.M{"_id": userID, "completed_on": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"completed_on": time.Now()}})
+	if err != nil {
+		return false, err
+	}
+	return res.ModifiedCount == 1, nil
+}
+
+// RecordDevice adds a device hash to the ones a participant has rated from
+func RecordDevice(ctx context.Context, db *mongo.Database, userID primitive.ObjectID, device string) error {
+	_, err := db.Collection("users").UpdateByID(ctx, userID, bson.M{"$addToSet": bson.M{"devices": device}})
+	return err
+}
@@ -13,7 +13,7 @@ import (
 // Errors if unable to extract ObjectID for whatever reason.
 func ExtractUserID(
 	r *http.Request,
-	sess *sessions.CookieStore,
+	sess sessions.Store,
 ) (*primitive.ObjectID, error) {
 	session, err := sess.Get(r, "carp")
 	if err != nil {
@@ -0,0 +1,113 @@
+package utils
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/superc03/carp/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MemorySessionBackend keeps sessions in process memory. Sessions are lost on restart and are not shared between
+// instances, so it is meant for development and single instance deployments.
+type MemorySessionBackend struct {
+	mu       sync.Mutex
+	sessions map[string]models.Session
+}
+
+func NewMemorySessionBackend() *MemorySessionBackend {
+	return &MemorySessionBackend{sessions: make(map[string]models.Session)}
+}
+
+func (m *MemorySessionBackend) Load(ctx context.Context, id string) (*models.Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	session, ok := m.sessions[id]
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+	session.Values = copyValues(session.Values)
+	return &session, nil
+}
+
+func (m *MemorySessionBackend) Store(ctx context.Context, session *models.Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.prune(time.Now())
+	stored := *session
+	stored.Values = copyValues(session.Values)
+	m.sessions[session.ID] = stored
+	return nil
+}
+
+func (m *MemorySessionBackend) Touch(ctx context.Context, id string, seen time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	session, ok := m.sessions[id]
+	if !ok {
+		return ErrSessionNotFound
+	}
+	session.LastSeenOn = seen
+	m.sessions[id] = session
+	return nil
+}
+
+func (m *MemorySessionBackend) Revoke(ctx context.Context, id string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	session, ok := m.sessions[id]
+	if !ok || session.RevokedOn != nil {
+		return ErrSessionNotFound
+	}
+	session.RevokedOn = &at
+	m.sessions[id] = session
+	return nil
+}
+
+func (m *MemorySessionBackend) RevokeUser(ctx context.Context, userID primitive.ObjectID, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, session := range m.sessions {
+		if session.UserID == userID && session.RevokedOn == nil {
+			session.RevokedOn = &at
+			m.sessions[id] = session
+		}
+	}
+	return nil
+}
+
+func (m *MemorySessionBackend) ListUser(ctx context.Context, userID primitive.ObjectID) ([]models.Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sessions := make([]models.Session, 0)
+	for _, session := range m.sessions {
+		if session.UserID == userID {
+			session.Values = copyValues(session.Values)
+			sessions = append(sessions, session)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastSeenOn.After(sessions[j].LastSeenOn)
+	})
+	return sessions, nil
+}
+
+// prune drops sessions past their absolute expiry, mirroring the TTL index of the Mongo backend.
+func (m *MemorySessionBackend) prune(now time.Time) {
+	for id, session := range m.sessions {
+		if !now.Before(session.ExpiresOn) {
+			delete(m.sessions, id)
+		}
+	}
+}
+
+func copyValues(values bson.M) bson.M {
+	out := make(bson.M, len(values))
+	for k, v := range values {
+		out[k] = v
+	}
+	return out
+}
@@ -0,0 +1,81 @@
+package utils
+
+import (
+	"context"
+	"time"
+
+	"github.com/superc03/carp/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoSessionBackend keeps sessions in the `sessions` collection so they survive restarts and are shared
+// between instances.
+type MongoSessionBackend struct {
+	coll *mongo.Collection
+}
+
+// NewMongoSessionBackend creates the backend and ensures expired sessions are removed by a TTL index.
+func NewMongoSessionBackend(ctx context.Context, db *mongo.Database) (*MongoSessionBackend, error) {
+	coll := db.Collection("sessions")
+	_, err := coll.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "expires_on", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+		{Keys: bson.D{{Key: "user_id", Value: 1}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &MongoSessionBackend{coll}, nil
+}
+
+func (m *MongoSessionBackend) Load(ctx context.Context, id string) (*models.Session, error) {
+	session := models.Session{}
+	err := m.coll.FindOne(ctx, bson.M{"_id": id}).Decode(&session)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrSessionNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (m *MongoSessionBackend) Store(ctx context.Context, session *models.Session) error {
+	_, err := m.coll.ReplaceOne(ctx, bson.M{"_id": session.ID}, session, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (m *MongoSessionBackend) Touch(ctx context.Context, id string, seen time.Time) error {
+	_, err := m.coll.UpdateByID(ctx, id, bson.M{"$set": bson.M{"last_seen_on": seen}})
+	return err
+}
+
+func (m *MongoSessionBackend) Revoke(ctx context.Context, id string, at time.Time) error {
+	res, err := m.coll.UpdateOne(ctx, bson.M{"_id": id, "revoked_on": nil}, bson.M{"$set": bson.M{"revoked_on": at}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+func (m *MongoSessionBackend) RevokeUser(ctx context.Context, userID primitive.ObjectID, at time.Time) error {
+	_, err := m.coll.UpdateMany(ctx, bson.M{"user_id": userID, "revoked_on": nil}, bson.M{"$set": bson.M{"revoked_on": at}})
+	return err
+}
+
+func (m *MongoSessionBackend) ListUser(ctx context.Context, userID primitive.ObjectID) ([]models.Session, error) {
+	cur, err := m.coll.Find(ctx, bson.M{"user_id": userID}, options.Find().SetSort(bson.M{"last_seen_on": -1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	sessions := make([]models.Session, 0)
+	if err = cur.All(ctx, &sessions); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
@@ -0,0 +1,237 @@
+package utils
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+	"github.com/superc03/carp/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ErrSessionNotFound is returned by a SessionBackend when no record exists for the requested session.
+var ErrSessionNotFound = errors.New("session not found")
+
+// rotatedCookie marks sessions whose cookie was decoded with a previous key pair. It is never persisted.
+type rotatedCookie struct{}
+
+// SessionBackend persists server-side session records.
+type SessionBackend interface {
+	Load(ctx context.Context, id string) (*models.Session, error)
+	Store(ctx context.Context, session *models.Session) error
+	Touch(ctx context.Context, id string, seen time.Time) error
+	Revoke(ctx context.Context, id string, at time.Time) error
+	RevokeUser(ctx context.Context, userID primitive.ObjectID, at time.Time) error
+	ListUser(ctx context.Context, userID primitive.ObjectID) ([]models.Session, error)
+}
+
+// SessionStore is a gorilla sessions.Store which keeps session values on the server, so sessions can be listed
+// and revoked. The cookie only holds a signed random token identifying the record.
+type SessionStore struct {
+	Codecs          []securecookie.Codec
+	Options         *sessions.Options
+	Backend         SessionBackend
+	IdleTimeout     time.Duration
+	AbsoluteTimeout time.Duration
+}
+
+// NewSessionStore creates a store on top of the given backend. The cookie lives as long as the absolute timeout.
+func NewSessionStore(
+	backend SessionBackend,
+	options *sessions.Options,
+	idleTimeout time.Duration,
+	absoluteTimeout time.Duration,
+	keyPairs ...[]byte,
+) *SessionStore {
+	opts := *options
+	opts.MaxAge = int(absoluteTimeout.Seconds())
+	codecs := securecookie.CodecsFromPairs(keyPairs...)
+	for _, c := range codecs {
+		if sc, ok := c.(*securecookie.SecureCookie); ok {
+			sc.MaxAge(opts.MaxAge)
+		}
+	}
+	return &SessionStore{
+		Codecs:          codecs,
+		Options:         &opts,
+		Backend:         backend,
+		IdleTimeout:     idleTimeout,
+		AbsoluteTimeout: absoluteTimeout,
+	}
+}
+
+// Get returns a session for the given name after adding it to the request registry.
+func (s *SessionStore) Get(r *http.Request, name string) (*sessions.Session, error) {
+	return sessions.GetRegistry(r).Get(s, name)
+}
+
+// New returns the session referenced by the request cookie, or a fresh session when the cookie is missing,
+// tampered with, expired or revoked.
+func (s *SessionStore) New(r *http.Request, name string) (*sessions.Session, error) {
+	session := sessions.NewSession(s, name)
+	opts := *s.Options
+	session.Options = &opts
+	session.IsNew = true
+	c, err := r.Cookie(name)
+	if err != nil {
+		return session, nil
+	}
+	var token string
+	rotated := false
+	if err = securecookie.DecodeMulti(name, c.Value, &token, s.Codecs[:1]...); err != nil {
+		if err = securecookie.DecodeMulti(name, c.Value, &token, s.Codecs...); err != nil {
+			// A cookie we cannot decode is treated like no cookie at all
+			return session, nil
+		}
+		rotated = true
+	}
+	record, err := s.Backend.Load(r.Context(), hashSessionToken(token))
+	if err == ErrSessionNotFound {
+		return session, nil
+	} else if err != nil {
+		return session, err
+	}
+	now := time.Now()
+	if !record.Active(now, s.IdleTimeout) {
+		return session, nil
+	}
+	// Only write the last seen time back once a minute to avoid a database write per request
+	if now.Sub(record.LastSeenOn) > time.Minute {
+		if err = s.Backend.Touch(r.Context(), record.ID, now); err != nil {
+			return session, err
+		}
+	}
+	session.ID = token
+	for k, v := range record.Values {
+		session.Values[k] = v
+	}
+	if rotated {
+		session.Values[rotatedCookie{}] = true
+	}
+	session.IsNew = false
+	return session, nil
+}
+
+// Save persists the session record and writes the cookie. Setting Options.MaxAge below zero revokes the session.
+func (s *SessionStore) Save(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	now := time.Now()
+	if session.Options.MaxAge < 0 {
+		if session.ID != "" {
+			if err := s.Backend.Revoke(r.Context(), hashSessionToken(session.ID), now); err != nil && err != ErrSessionNotFound {
+				return err
+			}
+		}
+		http.SetCookie(w, sessions.NewCookie(session.Name(), "", session.Options))
+		return nil
+	}
+	record := &models.Session{
+		Values:     bson.M{},
+		UserAgent:  r.UserAgent(),
+		RemoteAddr: r.RemoteAddr,
+		CreatedOn:  now,
+		LastSeenOn: now,
+		ExpiresOn:  now.Add(s.AbsoluteTimeout),
+	}
+	if session.ID == "" {
+		token, err := RandomToken(32)
+		if err != nil {
+			return err
+		}
+		session.ID = token
+	} else if existing, err := s.Backend.Load(r.Context(), hashSessionToken(session.ID)); err == nil {
+		// Keep the original lifetime so saving a session never extends its absolute timeout
+		record.CreatedOn = existing.CreatedOn
+		record.ExpiresOn = existing.ExpiresOn
+		record.RevokedOn = existing.RevokedOn
+	} else if err != ErrSessionNotFound {
+		return err
+	}
+	record.ID = hashSessionToken(session.ID)
+	delete(session.Values, rotatedCookie{})
+	for k, v := range session.Values {
+		record.Values[fmt.Sprintf("%v", k)] = v
+	}
+	if id, ok := session.Values["_id"].(string); ok {
+		if userID, err := primitive.ObjectIDFromHex(id); err == nil {
+			record.UserID = userID
+		}
+	}
+	if err := s.Backend.Store(r.Context(), record); err != nil {
+		return err
+	}
+	encoded, err := securecookie.EncodeMulti(session.Name(), session.ID, s.Codecs...)
+	if err != nil {
+		return err
+	}
+	opts := *session.Options
+	opts.MaxAge = int(time.Until(record.ExpiresOn).Seconds())
+	http.SetCookie(w, sessions.NewCookie(session.Name(), encoded, &opts))
+	return nil
+}
+
+// Regenerate revokes the session's record and empties it, so the next Save issues a new token. Call it whenever a
+// session gains privileges, like on sign in, so a token planted or observed beforehand never becomes authenticated.
+func (s *SessionStore) Regenerate(r *http.Request, session *sessions.Session) error {
+	if session.ID != "" {
+		if err := s.Backend.Revoke(r.Context(), hashSessionToken(session.ID), time.Now()); err != nil && err != ErrSessionNotFound {
+			return err
+		}
+	}
+	session.ID = ""
+	session.IsNew = true
+	for k := range session.Values {
+		delete(session.Values, k)
+	}
+	return nil
+}
+
+// ReissueRotated re-encodes the session cookie with the current key pair when the request carried a cookie issued
+// with a previous key, so a key rotation completes for everyone who is active before the previous key is removed.
+func (s *SessionStore) ReissueRotated(r *http.Request, w http.ResponseWriter, name string) error {
+	session, err := s.Get(r, name)
+	if err != nil {
+		return err
+	}
+	if session.Values[rotatedCookie{}] == nil {
+		return nil
+	}
+	return session.Save(r, w)
+}
+
+// Revoke ends a single session by its record ID, as listed by ActiveSessions.
+func (s *SessionStore) Revoke(ctx context.Context, id string) error {
+	return s.Backend.Revoke(ctx, id, time.Now())
+}
+
+// RevokeUser ends every session belonging to the given user.
+func (s *SessionStore) RevokeUser(ctx context.Context, userID primitive.ObjectID) error {
+	return s.Backend.RevokeUser(ctx, userID, time.Now())
+}
+
+// ActiveSessions lists the sessions of a user which have not expired, idled out or been revoked.
+func (s *SessionStore) ActiveSessions(ctx context.Context, userID primitive.ObjectID) ([]models.Session, error) {
+	all, err := s.Backend.ListUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	active := make([]models.Session, 0, len(all))
+	for _, v := range all {
+		if v.Active(now, s.IdleTimeout) {
+			active = append(active, v)
+		}
+	}
+	return active, nil
+}
+
+func hashSessionToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}